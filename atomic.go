@@ -0,0 +1,117 @@
+package vfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+)
+
+// Implemented by `FileSystem`s where `Create` is already atomic, so readers
+// only ever see a file once it's been completely written
+type AtomicCreator interface {
+	CreateAtomic(path string) (io.WriteCloser, error)
+}
+
+// Creates a file which readers won't see until it has been completely written.
+// The content is written to a temporary file next to path, which is moved over
+// path on Close. If a Write or the Close fails, the temporary file is removed.
+// A writer which is never closed leaves its temporary file behind. If the
+// `FileSystem` is an `AtomicCreator` its implementation is used instead.
+func CreateAtomic(fs FileSystem, path string) (io.WriteCloser, error) {
+	if ac, ok := fs.(AtomicCreator); ok {
+		return ac.CreateAtomic(path)
+	}
+	return createAtomicFile(fs, path)
+}
+
+func createAtomicFile(fs FileSystem, path string) (*atomicFile, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path = pathpkg.Clean("/" + path)
+	name, err := tempName()
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := pathpkg.Join(pathpkg.Dir(path),
+		fmt.Sprintf(".%s.%s.tmp", pathpkg.Base(path), name))
+
+	w, err := fs.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &atomicFile{
+		fs:      fs,
+		w:       w,
+		path:    path,
+		tmpPath: tmpPath,
+	}, nil
+}
+
+// A random name for a temporary file. It comes from crypto/rand, which unlike
+// math/rand can't hand other processes the same sequence of names.
+func tempName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type atomicFile struct {
+	fs      FileSystem
+	w       io.WriteCloser
+	path    string
+	tmpPath string
+	err     error
+}
+
+func (af *atomicFile) Write(p []byte) (int, error) {
+	if af.err != nil {
+		return 0, af.err
+	}
+
+	n, err := af.w.Write(p)
+	if err != nil {
+		af.abort(err)
+	}
+	return n, err
+}
+
+func (af *atomicFile) Close() error {
+	if af.err != nil {
+		return af.err
+	}
+
+	if err := af.w.Close(); err != nil {
+		af.abort(err)
+		return err
+	}
+	if err := af.fs.Move(af.tmpPath, af.path); err != nil {
+		af.abort(err)
+		return err
+	}
+
+	af.err = os.ErrClosed
+	return nil
+}
+
+// Gives up on the write without moving the temporary file over path
+func (af *atomicFile) Abort() error {
+	if af.err != nil {
+		return af.err
+	}
+	af.abort(os.ErrClosed)
+	return nil
+}
+
+// Gives up on the write, removing the temporary file. Every later call fails
+// with err.
+func (af *atomicFile) abort(err error) {
+	af.err = err
+	abortWriter(af.fs, af.tmpPath, af.w)
+}
@@ -0,0 +1,134 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Fails every Write
+type failingWriter struct {
+	io.WriteCloser
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+type failingCreate struct {
+	FileSystem
+}
+
+func (f failingCreate) Create(path string) (io.WriteCloser, error) {
+	w, err := f.FileSystem.Create(path)
+	return failingWriter{w}, err
+}
+
+var _ = Describe("CreateAtomic", func() {
+
+	read := func(fs FileSystem, path string) string {
+		r, err := fs.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		bs, _ := ioutil.ReadAll(r)
+		return string(bs)
+	}
+
+	entries := func(fs FileSystem, path string) []string {
+		infos, err := fs.Readdir(path)
+		Expect(err).ToNot(HaveOccurred())
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+
+	itShouldBeAtomic := func(newFS func() FileSystem) {
+		var fs FileSystem
+
+		BeforeEach(func() {
+			fs = newFS()
+			Expect(fs.Copy("/directory/root.txt", strings.NewReader("hi, root"))).To(Succeed())
+		})
+
+		It("should not show the new content until Close", func() {
+			w, err := CreateAtomic(fs, "/directory/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = w.Write([]byte("half of "))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read(fs, "/directory/root.txt")).To(Equal("hi, root"))
+
+			_, err = w.Write([]byte("the new root"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read(fs, "/directory/root.txt")).To(Equal("hi, root"))
+
+			Expect(w.Close()).To(Succeed())
+			Expect(read(fs, "/directory/root.txt")).To(Equal("half of the new root"))
+			Expect(entries(fs, "/directory")).To(Equal([]string{"root.txt"}))
+		})
+
+		It("should not show a new file until Close", func() {
+			w, err := CreateAtomic(fs, "/directory/new.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			w.Write([]byte("new"))
+			_, err = fs.Stat("/directory/new.txt")
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+
+			Expect(w.Close()).To(Succeed())
+			Expect(read(fs, "/directory/new.txt")).To(Equal("new"))
+		})
+
+		It("should remove the temporary file when a Write fails", func() {
+			w, err := CreateAtomic(failingCreate{fs}, "/directory/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = w.Write([]byte("the new root"))
+			Expect(err).To(HaveOccurred())
+			Expect(w.Close()).ToNot(Succeed())
+
+			Expect(read(fs, "/directory/root.txt")).To(Equal("hi, root"))
+			Expect(entries(fs, "/directory")).To(Equal([]string{"root.txt"}))
+		})
+
+		It("should fail a second Close", func() {
+			w, err := CreateAtomic(fs, "/directory/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(w.Close()).To(Succeed())
+			Expect(w.Close()).To(MatchError(os.ErrClosed))
+		})
+	}
+
+	Describe("Mem", func() {
+		itShouldBeAtomic(func() FileSystem {
+			return Mem()
+		})
+	})
+
+	Describe("OS", func() {
+		var root string
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		itShouldBeAtomic(func() FileSystem {
+			var err error
+			root, err = ioutil.TempDir("", "vfs-atomic")
+			Expect(err).ToNot(HaveOccurred())
+
+			fs, err := OS(root)
+			Expect(err).ToNot(HaveOccurred())
+			return fs
+		})
+	})
+
+})
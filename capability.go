@@ -0,0 +1,162 @@
+package vfs
+
+import (
+	"os"
+	pathpkg "path"
+	"time"
+)
+
+// An optional feature a `FileSystem` can have, beyond the methods every one
+// implements
+type Capability int
+
+const (
+	CapAtomicCreate      Capability = iota // `AtomicCreator`
+	CapExclusiveCreate                     // `ExclusiveCreator`
+	CapChtimes                             // `Chtimer`
+	CapTouch                               // `Toucher`
+	CapRemoveAll                           // `RemoveAller`
+	CapReaddirStream                       // `ReaddirStreamer`
+	CapReaddirUnsorted                     // `UnsortedReaddirer`
+	CapChecksum                            // `Checksummer`
+	CapDiskUsage                           // `DiskUsager`
+	CapGlob                                // `Globber`
+	CapLock                                // `Locker`
+	CapWatch                               // `Watcher`
+	CapVersions                            // `Versioner`
+	CapPresign                             // `Presigner`
+	CapOpenRange                           // `RangeOpener`
+	CapReaddirBestEffort                   // `BestEffortReaddirer`
+)
+
+var capabilityNames = []string{
+	"AtomicCreate",
+	"ExclusiveCreate",
+	"Chtimes",
+	"Touch",
+	"RemoveAll",
+	"ReaddirStream",
+	"ReaddirUnsorted",
+	"Checksum",
+	"DiskUsage",
+	"Glob",
+	"Lock",
+	"Watch",
+	"Versions",
+	"Presign",
+	"OpenRange",
+	"ReaddirBestEffort",
+}
+
+func (c Capability) String() string {
+	if c < 0 || int(c) >= len(capabilityNames) {
+		return "Capability(?)"
+	}
+	return capabilityNames[c]
+}
+
+// Whether fs is the interface behind a capability
+func (c Capability) implementedBy(fs FileSystem) bool {
+	var ok bool
+	switch c {
+	case CapAtomicCreate:
+		_, ok = fs.(AtomicCreator)
+	case CapExclusiveCreate:
+		_, ok = fs.(ExclusiveCreator)
+	case CapChtimes:
+		_, ok = fs.(Chtimer)
+	case CapTouch:
+		_, ok = fs.(Toucher)
+	case CapRemoveAll:
+		_, ok = fs.(RemoveAller)
+	case CapReaddirStream:
+		_, ok = fs.(ReaddirStreamer)
+	case CapReaddirUnsorted:
+		_, ok = fs.(UnsortedReaddirer)
+	case CapChecksum:
+		_, ok = fs.(Checksummer)
+	case CapDiskUsage:
+		_, ok = fs.(DiskUsager)
+	case CapGlob:
+		_, ok = fs.(Globber)
+	case CapLock:
+		_, ok = fs.(Locker)
+	case CapWatch:
+		_, ok = fs.(Watcher)
+	case CapVersions:
+		_, ok = fs.(Versioner)
+	case CapPresign:
+		_, ok = fs.(Presigner)
+	case CapOpenRange:
+		_, ok = fs.(RangeOpener)
+	case CapReaddirBestEffort:
+		_, ok = fs.(BestEffortReaddirer)
+	}
+	return ok
+}
+
+// Implemented by `FileSystem`s which know better than their methods what they
+// support, like a backend with a method that always fails with
+// `ErrNotSupported`
+type CapabilityReporter interface {
+	Capabilities() []Capability
+}
+
+// The capabilities of a `FileSystem`. Those of a `CapabilityReporter` are what
+// it reports; otherwise, they're the interfaces it implements.
+func Capabilities(fs FileSystem) []Capability {
+	if cr, ok := fs.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+
+	var caps []Capability
+	for c := range capabilityNames {
+		if Capability(c).implementedBy(fs) {
+			caps = append(caps, Capability(c))
+		}
+	}
+	return caps
+}
+
+// Reports whether a `FileSystem` has a capability, so generic code can fall
+// back to something else when it doesn't
+func Supports(fs FileSystem, c Capability) bool {
+	for _, have := range Capabilities(fs) {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Implemented by `FileSystem`s which can hand out URLs to read a file directly
+// from the backend without credentials, until the URL expires
+type Presigner interface {
+	PresignURL(path string, expiry time.Duration) (string, error)
+}
+
+// A `Subtree` only has the capabilities of the `FileSystem` beneath it which
+// it passes through
+func (s *subtree) Capabilities() []Capability {
+	var caps []Capability
+	for _, c := range Capabilities(s.fs) {
+		if c.implementedBy(s) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// Presigns with the underlying `FileSystem`, if it's a `Presigner`
+func (s *subtree) PresignURL(path string, expiry time.Duration) (string, error) {
+	presigner, ok := s.fs.(Presigner)
+	if !ok {
+		return "", &os.PathError{
+			Op:   "presign",
+			Path: pathpkg.Clean("/" + path),
+			Err:  ErrNotSupported,
+		}
+	}
+	url, err := presigner.PresignURL(s.mapPath(path), expiry)
+	return url, s.unmapError(err)
+}
@@ -0,0 +1,109 @@
+package vfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capabilities", func() {
+	It("should report what Mem implements", func() {
+		fs := Mem()
+
+		Expect(Capabilities(fs)).To(ConsistOf(
+			CapChtimes,
+			CapReaddirUnsorted,
+			CapLock,
+			CapWatch,
+			CapOpenRange,
+		))
+		Expect(Supports(fs, CapLock)).To(BeTrue())
+		Expect(Supports(fs, CapPresign)).To(BeFalse())
+	})
+
+	It("should report what OS implements through its Subtree", func() {
+		root, err := ioutil.TempDir("", "vfs-capability")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(root)
+
+		fs, err := OS(root)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Capabilities(fs)).To(ConsistOf(
+			CapExclusiveCreate,
+			CapChtimes,
+			CapReaddirUnsorted,
+			CapLock,
+			CapWatch,
+			CapReaddirBestEffort,
+		))
+		Expect(Supports(fs, CapPresign)).To(BeFalse())
+	})
+
+	It("should only report what a Subtree passes through", func() {
+		tree, err := Subtree(Versioned(Mem()), "/")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Supports(Versioned(Mem()), CapVersions)).To(BeTrue())
+		Expect(Supports(tree, CapVersions)).To(BeFalse())
+	})
+
+	It("should prefer what a CapabilityReporter reports", func() {
+		fs := &reportingFS{Mem(), []Capability{CapPresign}}
+		Expect(fs.Mkdir("/assets")).To(Succeed())
+
+		Expect(Capabilities(fs)).To(Equal([]Capability{CapPresign}))
+		Expect(Supports(fs, CapLock)).To(BeFalse())
+
+		tree, err := Subtree(fs, "/assets")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(Capabilities(tree)).To(Equal([]Capability{CapPresign}))
+	})
+
+	It("should presign through a Subtree beneath its root", func() {
+		fs := &presigningFS{Mem()}
+		Expect(fs.Mkdir("/assets")).To(Succeed())
+		tree, err := Subtree(fs, "/assets")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Supports(tree, CapPresign)).To(BeTrue())
+		Expect(tree.(Presigner).PresignURL("logo.png", time.Minute)).To(
+			Equal("https://example.com/assets/logo.png?expires=1m0s"))
+	})
+
+	It("should not presign through a Subtree of a backend which can't", func() {
+		fs := Mem()
+		Expect(fs.Mkdir("/assets")).To(Succeed())
+		tree, err := Subtree(fs, "/assets")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = tree.(Presigner).PresignURL("logo.png", time.Minute)
+		Expect(errors.Is(err, ErrNotSupported)).To(BeTrue())
+	})
+
+	It("should name each capability", func() {
+		Expect(CapPresign.String()).To(Equal("Presign"))
+		Expect(Capability(-1).String()).To(Equal("Capability(?)"))
+	})
+})
+
+type reportingFS struct {
+	FileSystem
+	caps []Capability
+}
+
+func (r *reportingFS) Capabilities() []Capability {
+	return r.caps
+}
+
+type presigningFS struct {
+	FileSystem
+}
+
+func (p *presigningFS) PresignURL(path string, expiry time.Duration) (string, error) {
+	return "https://example.com" + path + "?expires=" + expiry.String(), nil
+}
@@ -0,0 +1,168 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+// Returned, wrapped in an `*os.PathError`, when a path could name more than one
+// entry of a directory which differ only in case
+var ErrAmbiguous = errors.New("Ambiguous path")
+
+// Wraps a `FileSystem` so paths are looked up ignoring case, like on Windows.
+// Each element of a path is matched against the entries of its directory, and
+// the underlying `FileSystem` is handed the entries' real names. An exact match
+// is always taken first; otherwise, two entries which differ only in case are
+// `ErrAmbiguous`. Create, Copy, Mkdir and the destination of Move keep the
+// casing they're given for the name they create, but find its parent ignoring
+// case.
+func CaseInsensitive(fs FileSystem) FileSystem {
+	return &caseInsensitive{fs}
+}
+
+type caseInsensitive struct {
+	fs FileSystem
+}
+
+// The real path of an existing entry. Elements which can't be found are kept as
+// they were asked for, so the underlying `FileSystem` reports them missing.
+func (ci *caseInsensitive) resolve(op, path string) (string, error) {
+	path = pathpkg.Clean("/" + path)
+	if _, err := ci.fs.Stat(path); err == nil {
+		return path, nil
+	}
+
+	resolved := "/"
+	parts := strings.Split(path[1:], "/")
+	for i, part := range parts {
+		name, err := ci.match(resolved, part)
+		if err != nil {
+			return "", &os.PathError{Op: op, Path: path, Err: err}
+		}
+		if name == "" {
+			return pathpkg.Join(append([]string{resolved}, parts[i:]...)...), nil
+		}
+		resolved = pathpkg.Join(resolved, name)
+	}
+	return resolved, nil
+}
+
+// The real path of a parent, joined to the name as it was asked for
+func (ci *caseInsensitive) resolveParent(op, path string) (string, error) {
+	path = pathpkg.Clean("/" + path)
+	if path == "/" {
+		return path, nil
+	}
+	dir, err := ci.resolve(op, pathpkg.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return pathpkg.Join(dir, pathpkg.Base(path)), nil
+}
+
+// The entry of dir matching name ignoring case, or "" if there isn't one
+func (ci *caseInsensitive) match(dir, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	infos, err := ci.fs.Readdir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var match string
+	for _, info := range infos {
+		switch {
+		case info.Name() == name:
+			return name, nil
+		case !strings.EqualFold(info.Name(), name):
+		case match != "":
+			return "", ErrAmbiguous
+		default:
+			match = info.Name()
+		}
+	}
+	return match, nil
+}
+
+func (ci *caseInsensitive) URL() *url.URL {
+	return ci.fs.URL()
+}
+
+func (ci *caseInsensitive) Open(path string) (ReadSeekCloser, error) {
+	path, err := ci.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return ci.fs.Open(path)
+}
+
+func (ci *caseInsensitive) Create(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path, err := ci.resolveParent("create", path)
+	if err != nil {
+		return nil, err
+	}
+	return ci.fs.Create(path)
+}
+
+func (ci *caseInsensitive) Copy(path string, source io.Reader) error {
+	if err := checkFilePath("create", path); err != nil {
+		return err
+	}
+	path, err := ci.resolveParent("create", path)
+	if err != nil {
+		return err
+	}
+	return ci.fs.Copy(path, source)
+}
+
+func (ci *caseInsensitive) Move(srcPath, destPath string) error {
+	srcPath, err := ci.resolve("move", srcPath)
+	if err != nil {
+		return err
+	}
+	destPath, err = ci.resolveParent("move", destPath)
+	if err != nil {
+		return err
+	}
+	return ci.fs.Move(srcPath, destPath)
+}
+
+func (ci *caseInsensitive) Remove(path string) error {
+	path, err := ci.resolve("remove", path)
+	if err != nil {
+		return err
+	}
+	return ci.fs.Remove(path)
+}
+
+func (ci *caseInsensitive) Stat(path string) (os.FileInfo, error) {
+	path, err := ci.resolve("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	return ci.fs.Stat(path)
+}
+
+func (ci *caseInsensitive) Readdir(path string) ([]os.FileInfo, error) {
+	path, err := ci.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return ci.fs.Readdir(path)
+}
+
+func (ci *caseInsensitive) Mkdir(path string) error {
+	path, err := ci.resolveParent("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return ci.fs.Mkdir(path)
+}
@@ -0,0 +1,95 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CaseInsensitive", func() {
+	var backend, fs FileSystem
+
+	BeforeEach(func() {
+		backend = Mem(
+			Dir("Directory",
+				File("Child.txt", []byte("hi, child")),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+		fs = CaseInsensitive(backend)
+	})
+
+	It("should open a file with any casing", func() {
+		Expect(ReadFile(fs, "/ROOT.TXT")).To(Equal([]byte("hi, root")))
+		Expect(ReadFile(fs, "/directory/child.TXT")).To(Equal([]byte("hi, child")))
+	})
+
+	It("should stat and list with the real names", func() {
+		info, err := fs.Stat("/DIRECTORY/CHILD.TXT")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Name()).To(Equal("Child.txt"))
+
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Name()).To(Equal("Child.txt"))
+	})
+
+	It("should create with the casing asked for in an existing directory", func() {
+		Expect(fs.Copy("/DIRECTORY/New.txt", strings.NewReader("new"))).To(Succeed())
+		Expect(ReadFile(backend, "/Directory/New.txt")).To(Equal([]byte("new")))
+
+		Expect(fs.Mkdir("/directory/Sub")).To(Succeed())
+		info, err := backend.Stat("/Directory/Sub")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+	})
+
+	It("should move and remove ignoring case", func() {
+		Expect(fs.Move("/ROOT.txt", "/directory/Moved.txt")).To(Succeed())
+		Expect(ReadFile(backend, "/Directory/Moved.txt")).To(Equal([]byte("hi, root")))
+
+		Expect(fs.Remove("/DIRECTORY/MOVED.TXT")).To(Succeed())
+		_, err := backend.Stat("/Directory/Moved.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should return ErrAmbiguous for names differing only in case", func() {
+		Expect(backend.Copy("/ROOT.txt", strings.NewReader("shouting"))).To(Succeed())
+
+		_, err := fs.Open("/Root.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/Root.txt",
+			Err:  ErrAmbiguous,
+		}))
+	})
+
+	It("should prefer an exact match", func() {
+		Expect(backend.Copy("/ROOT.txt", strings.NewReader("shouting"))).To(Succeed())
+		Expect(ReadFile(fs, "/ROOT.txt")).To(Equal([]byte("shouting")))
+		Expect(ReadFile(fs, "/root.txt")).To(Equal([]byte("hi, root")))
+	})
+
+	It("should return ErrNoFile for a missing path", func() {
+		_, err := fs.Open("/directory/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/Directory/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+	It("should return the error of a directory it can't read", func() {
+		fs = CaseInsensitive(&failingReaddir{backend, "/Directory"})
+
+		_, err := fs.Open("/directory/child.txt")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("nope"))
+		Expect(errors.Is(err, ErrNoFile)).To(BeFalse())
+	})
+
+})
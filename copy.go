@@ -0,0 +1,191 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	pathpkg "path"
+	"sync"
+)
+
+// Copies srcPath from src to dstPath in dst. A directory is copied with
+// everything beneath it, creating dstPath and any directories it needs; a file
+// is copied on its own. Files already in dst are overwritten. If it fails
+// part-way through, what was already copied is left behind. Progress can be
+// followed with `WithProgress`, which reports the paths of files in src.
+func CopyAll(
+	dst FileSystem,
+	dstPath string,
+	src FileSystem,
+	srcPath string,
+	opts ...func(*copyOptions),
+) error {
+	var o copyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	copyFn := func(dstPath, srcPath string) error {
+		return copyFile(dst, dstPath, src, srcPath)
+	}
+	if o.progress != nil {
+		total, err := DiskUsage(src, srcPath)
+		if err != nil {
+			return err
+		}
+		p := &progress{fn: o.progress, total: total}
+		copyFn = func(dstPath, srcPath string) error {
+			return p.copyFile(dst, dstPath, src, srcPath, srcPath)
+		}
+	}
+	return copyTree(dst, dstPath, src, srcPath, copyFn)
+}
+
+// Copies like `CopyAll`, but copies files on up to workers goroutines at once.
+// All the directories are made first, so each file's directory exists before
+// it's copied. This helps most when each copy is a round-trip, like copying
+// lots of small files to S3.
+//
+// Both `FileSystem`s must be safe for concurrent use: src is read and dst is
+// written from several goroutines at the same time. The first error stops any
+// copies which haven't started yet and is returned.
+func CopyAllConcurrent(
+	dst FileSystem,
+	dstPath string,
+	src FileSystem,
+	srcPath string,
+	workers int,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type copyJob struct{ dstPath, srcPath string }
+	var jobs []copyJob
+	err := copyTree(dst, dstPath, src, srcPath, func(dstPath, srcPath string) error {
+		jobs = append(jobs, copyJob{dstPath, srcPath})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		running sync.WaitGroup
+		once    sync.Once
+		copyErr error
+		queue   = make(chan copyJob)
+		done    = make(chan struct{})
+	)
+
+	running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer running.Done()
+			for job := range queue {
+				if err := copyFile(dst, job.dstPath, src, job.srcPath); err != nil {
+					once.Do(func() {
+						copyErr = err
+						close(done)
+					})
+				}
+			}
+		}()
+	}
+
+queueing:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-done:
+			break queueing
+		}
+	}
+	close(queue)
+	running.Wait()
+
+	return copyErr
+}
+
+// Copies like `CopyAll`, then gives each file copied the modTime it has in src,
+// so tools comparing modTimes can tell it's unchanged. Directories get the
+// time they were copied. dst must support `CapChtimes`, or nothing is copied.
+func CopyPreserving(dst FileSystem, dstPath string, src FileSystem, srcPath string) error {
+	ct, ok := dst.(Chtimer)
+	if !ok || !Supports(dst, CapChtimes) {
+		return &os.PathError{Op: "chtimes", Path: dstPath, Err: ErrNotSupported}
+	}
+
+	return copyTree(dst, dstPath, src, srcPath, func(dstPath, srcPath string) error {
+		if err := copyFile(dst, dstPath, src, srcPath); err != nil {
+			return err
+		}
+		info, err := src.Stat(srcPath)
+		if err != nil {
+			return err
+		}
+		return ct.Chtimes(dstPath, info.ModTime(), info.ModTime())
+	})
+}
+
+// Makes the directories of the tree at srcPath in dst, and calls copyFn for
+// each file in it
+func copyTree(
+	dst FileSystem,
+	dstPath string,
+	src FileSystem,
+	srcPath string,
+	copyFn func(dstPath, srcPath string) error,
+) error {
+	info, err := src.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFn(dstPath, srcPath)
+	}
+	if err := MkdirAll(dst, dstPath); err != nil {
+		return err
+	}
+	return copyDir(dst, dstPath, src, srcPath, copyFn)
+}
+
+// Copies the children of a directory into one which already exists in dst
+func copyDir(
+	dst FileSystem,
+	dstPath string,
+	src FileSystem,
+	srcPath string,
+	copyFn func(dstPath, srcPath string) error,
+) error {
+	infos, err := src.Readdir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, child := range infos {
+		childDst := pathpkg.Join(dstPath, child.Name())
+		childSrc := pathpkg.Join(srcPath, child.Name())
+		if !child.IsDir() {
+			if err := copyFn(childDst, childSrc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := dst.Mkdir(childDst); err != nil && !errors.Is(err, ErrExist) {
+			return err
+		}
+		if err := copyDir(dst, childDst, src, childSrc, copyFn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(dst FileSystem, dstPath string, src FileSystem, srcPath string) error {
+	r, err := src.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Copy(dstPath, r)
+}
@@ -0,0 +1,33 @@
+package vfs
+
+import (
+	"testing"
+)
+
+func benchmarkCopyAll(b *testing.B, copyAll func(dst, src FileSystem) error) {
+	src := largeDirFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dst, err := OS(b.TempDir())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := copyAll(dst, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCopyAll(b *testing.B) {
+	benchmarkCopyAll(b, func(dst, src FileSystem) error {
+		return CopyAll(dst, "/", src, "/")
+	})
+}
+
+func BenchmarkCopyAllConcurrent(b *testing.B) {
+	benchmarkCopyAll(b, func(dst, src FileSystem) error {
+		return CopyAllConcurrent(dst, "/", src, "/", 8)
+	})
+}
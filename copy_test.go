@@ -0,0 +1,188 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Fails every Copy, counting how many were tried
+type failingCopyFS struct {
+	FileSystem
+	copies int32
+}
+
+func (fs *failingCopyFS) Copy(path string, source io.Reader) error {
+	atomic.AddInt32(&fs.copies, 1)
+	return errors.New("copy failed")
+}
+
+var _ = Describe("CopyAll", func() {
+	var src FileSystem
+
+	BeforeEach(func() {
+		src = Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				File("child.txt", []byte("hi, child")),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+	})
+
+	It("should copy a directory with everything beneath it", func() {
+		dst := Mem()
+		Expect(CopyAll(dst, "/backup/copy", src, "/")).To(Succeed())
+
+		Expect(ReadFile(dst, "/backup/copy/root.txt")).To(Equal([]byte("hi, root")))
+		Expect(ReadFile(dst, "/backup/copy/directory/child.txt")).
+			To(Equal([]byte("hi, child")))
+		info, err := dst.Stat("/backup/copy/directory/sub_directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+	})
+
+	It("should copy a single file", func() {
+		dst := Mem()
+		Expect(CopyAll(dst, "/copied.txt", src, "/directory/child.txt")).To(Succeed())
+		Expect(ReadFile(dst, "/copied.txt")).To(Equal([]byte("hi, child")))
+	})
+
+	It("should fail for a missing source", func() {
+		err := CopyAll(Mem(), "/", src, "/missing")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should report progress up to the size of everything copied", func() {
+		large := bytes.Repeat([]byte("x"), 100*1024)
+		Expect(src.Copy("/directory/large.bin", bytes.NewReader(large))).To(Succeed())
+		Expect(src.Copy("/empty.txt", bytes.NewReader(nil))).To(Succeed())
+		size := int64(len("hi, child") + len("hi, root") + len(large))
+
+		var done []int64
+		var paths []string
+		progress := func(path string, bytesDone, bytesTotal int64) {
+			Expect(bytesTotal).To(Equal(size))
+			done = append(done, bytesDone)
+			paths = append(paths, path)
+		}
+		Expect(CopyAll(Mem(), "/", src, "/", WithProgress(progress))).To(Succeed())
+
+		Expect(len(done)).To(BeNumerically(">", 4))
+		for i := 1; i < len(done); i++ {
+			Expect(done[i]).To(BeNumerically(">=", done[i-1]))
+		}
+		Expect(done[len(done)-1]).To(Equal(size))
+		Expect(paths).To(ContainElement("/directory/large.bin"))
+		Expect(paths).To(ContainElement("/empty.txt"))
+	})
+})
+
+var _ = Describe("CopyAllConcurrent", func() {
+	var (
+		root string
+		dst  FileSystem
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-copy")
+		Expect(err).ToNot(HaveOccurred())
+		dst, err = OS(root)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should copy every file of a large tree", func() {
+		Expect(CopyAllConcurrent(dst, "/copy", largeDirFS(), "/", 8)).To(Succeed())
+
+		infos, err := dst.Readdir("/copy/large_directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1100))
+	})
+
+	It("should make directories before copying the files in them", func() {
+		src := Mem(Dir("a", Dir("b", Dir("c", File("deep.txt", []byte("deep"))))))
+		Expect(CopyAllConcurrent(dst, "/", src, "/", 4)).To(Succeed())
+		Expect(ReadFile(dst, "/a/b/c/deep.txt")).To(Equal([]byte("deep")))
+	})
+
+	It("should stop at the first error", func() {
+		failing := &failingCopyFS{FileSystem: dst}
+		err := CopyAllConcurrent(failing, "/copy", largeDirFS(), "/", 4)
+		Expect(err).To(MatchError("copy failed"))
+		Expect(atomic.LoadInt32(&failing.copies)).To(BeNumerically("<", 1100))
+	})
+})
+
+var _ = Describe("CopyPreserving", func() {
+	var (
+		src   FileSystem
+		mtime time.Time
+	)
+
+	BeforeEach(func() {
+		mtime = time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+		src = Mem(
+			Dir("directory",
+				FileWithModTime("child.txt", []byte("hi, child"), mtime.Add(time.Hour)),
+			),
+			FileWithModTime("root.txt", []byte("hi, root"), mtime),
+		)
+	})
+
+	It("should give each file its modTime in the source", func() {
+		dst := Mem()
+		Expect(CopyPreserving(dst, "/copy", src, "/")).To(Succeed())
+
+		Expect(ReadFile(dst, "/copy/root.txt")).To(Equal([]byte("hi, root")))
+		info, err := dst.Stat("/copy/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", mtime))
+
+		info, err = dst.Stat("/copy/directory/child.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", mtime.Add(time.Hour)))
+	})
+
+	It("should preserve the modTime on disk", func() {
+		root, err := ioutil.TempDir("", "vfs-copy")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(root)
+		dst, err := OS(root)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(CopyPreserving(dst, "/root.txt", src, "/root.txt")).To(Succeed())
+
+		info, err := dst.Stat("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", mtime))
+	})
+
+	It("should copy nothing when the destination can't set times", func() {
+		dst := &failingCopyFS{FileSystem: Mem()}
+		err := CopyPreserving(dst, "/copy", src, "/")
+		Expect(errors.Is(err, ErrNotSupported)).To(BeTrue())
+		Expect(dst.copies).To(BeZero())
+	})
+
+	It("should copy nothing into a Subtree which can't set times", func() {
+		inner := &failingCopyFS{FileSystem: Mem(Dir("backup"))}
+		dst, err := Subtree(inner, "/backup")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = CopyPreserving(dst, "/copy", src, "/")
+		Expect(errors.Is(err, ErrNotSupported)).To(BeTrue())
+		Expect(inner.copies).To(BeZero())
+	})
+})
@@ -0,0 +1,333 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strconv"
+	"sync"
+)
+
+// Wraps a backend so files with the same content share a single copy of it.
+// The content of every file is stored once, named by its SHA-256, and the path
+// written to holds a small pointer to it. Each copy of some content is counted,
+// and the content is removed along with its last pointer.
+//
+// The backend is laid out as:
+//
+//	/files/...           the tree of pointers, one for each file written
+//	/blobs/ab/abcdef...  content, named by its digest
+//	/refs/abcdef...      how many pointers each blob has
+//	/tmp/...             content still being written
+//
+// A `Dedup` is safe for concurrent use, but its counts are only locked within
+// it, so a backend must only be written to by one `Dedup` at a time.
+func Dedup(backend FileSystem) FileSystem {
+	// Without it an empty backend can't list its root
+	MkdirAll(backend, "/files")
+
+	return &dedup{
+		backend: backend,
+		files:   &subtree{backend, "/files"},
+	}
+}
+
+type dedup struct {
+	backend FileSystem
+	files   *subtree
+
+	// Held while pointers and their counts change, so each count is read and
+	// rewritten in one step
+	sync.Mutex
+}
+
+func blobPath(digest string) string {
+	return pathpkg.Join("/blobs", digest[:2], digest)
+}
+
+func refsPath(digest string) string {
+	return pathpkg.Join("/refs", digest)
+}
+
+// A pointer holds the digest of a file's content and its size, so the size can
+// be reported without opening the content
+type dedupPointer struct {
+	digest string
+	size   int64
+}
+
+func (d *dedup) pointer(path string) (*dedupPointer, error) {
+	content, err := ReadFile(d.files, path)
+	if err != nil {
+		return nil, err
+	}
+	var p dedupPointer
+	if _, err := fmt.Sscanf(string(content), "%s %d", &p.digest, &p.size); err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return &p, nil
+}
+
+// Adds delta to the count of pointers to digest, removing the blob once none
+// are left
+func (d *dedup) ref(digest string, delta int) error {
+	var refs int
+	content, err := ReadFile(d.backend, refsPath(digest))
+	switch {
+	case err == nil:
+		if refs, err = strconv.Atoi(string(content)); err != nil {
+			return err
+		}
+	case !errors.Is(err, ErrNoFile):
+		return err
+	}
+
+	refs += delta
+	if refs > 0 {
+		return d.backend.Copy(refsPath(digest), bytes.NewBufferString(strconv.Itoa(refs)))
+	}
+	if err := d.backend.Remove(blobPath(digest)); err != nil && !errors.Is(err, ErrNoFile) {
+		return err
+	}
+	if err := d.backend.Remove(refsPath(digest)); err != nil && !errors.Is(err, ErrNoFile) {
+		return err
+	}
+	return nil
+}
+
+func (d *dedup) URL() *url.URL {
+	return d.backend.URL()
+}
+
+func (d *dedup) Open(path string) (ReadSeekCloser, error) {
+	p, err := d.pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	return d.backend.Open(blobPath(p.digest))
+}
+
+// Content is written to a temporary file while it's hashed, then moved into
+// place on Close unless a blob with the same digest is already stored
+func (d *dedup) Create(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path = pathpkg.Clean("/" + path)
+	name, err := tempName()
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := "/tmp/" + name
+
+	w, err := d.backend.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupFile{
+		d:       d,
+		w:       w,
+		hash:    sha256.New(),
+		path:    path,
+		tmpPath: tmpPath,
+	}, nil
+}
+
+func (d *dedup) Copy(path string, source io.Reader) error {
+	dest, err := d.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := copyBuffer(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (d *dedup) Remove(path string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	info, err := d.files.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return d.files.Remove(path)
+	}
+
+	p, err := d.pointer(path)
+	if err != nil {
+		return err
+	}
+	if err := d.files.Remove(path); err != nil {
+		return err
+	}
+	return d.ref(p.digest, -1)
+}
+
+// Moves the pointer, leaving the content where it is. A file moved over
+// releases the content it pointed to.
+func (d *dedup) Move(srcPath, destPath string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if pathpkg.Clean("/"+srcPath) == pathpkg.Clean("/"+destPath) {
+		return d.files.Move(srcPath, destPath)
+	}
+
+	replaced, err := d.pointer(destPath)
+	if err != nil && !errors.Is(err, ErrNoFile) && !errors.Is(err, ErrIsDir) {
+		return err
+	}
+	if err := d.files.Move(srcPath, destPath); err != nil {
+		return err
+	}
+	if replaced != nil {
+		return d.ref(replaced.digest, -1)
+	}
+	return nil
+}
+
+func (d *dedup) Stat(path string) (os.FileInfo, error) {
+	info, err := d.files.Stat(path)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	return d.fileInfo(pathpkg.Dir(pathpkg.Clean("/"+path)), info)
+}
+
+func (d *dedup) Readdir(path string) ([]os.FileInfo, error) {
+	infos, err := d.files.Readdir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		if infos[i], err = d.fileInfo(path, info); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (d *dedup) Mkdir(path string) error {
+	return d.files.Mkdir(path)
+}
+
+// Gives the `FileInfo` of a pointer in dir the size of its content
+func (d *dedup) fileInfo(dir string, info os.FileInfo) (os.FileInfo, error) {
+	p, err := d.pointer(pathpkg.Join(dir, info.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return &dedupFileInfo{info, p.size}, nil
+}
+
+type dedupFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *dedupFileInfo) Size() int64 {
+	return fi.size
+}
+
+type dedupFile struct {
+	d       *dedup
+	w       io.WriteCloser
+	hash    hash.Hash
+	size    int64
+	path    string
+	tmpPath string
+	err     error
+}
+
+func (df *dedupFile) Write(p []byte) (int, error) {
+	if df.err != nil {
+		return 0, df.err
+	}
+
+	n, err := df.w.Write(p)
+	df.hash.Write(p[:n])
+	df.size += int64(n)
+	if err != nil {
+		df.abort(err)
+	}
+	return n, err
+}
+
+func (df *dedupFile) Close() error {
+	if df.err != nil {
+		return df.err
+	}
+	if err := df.w.Close(); err != nil {
+		df.abort(err)
+		return err
+	}
+
+	digest := hex.EncodeToString(df.hash.Sum(nil))
+	df.d.Lock()
+	defer df.d.Unlock()
+
+	if err := df.store(digest); err != nil {
+		df.abort(err)
+		return err
+	}
+	df.err = os.ErrClosed
+
+	replaced, err := df.d.pointer(df.path)
+	if err != nil && !errors.Is(err, ErrNoFile) {
+		return err
+	}
+	pointer := fmt.Sprintf("%s %d", digest, df.size)
+	if err := df.d.files.Copy(df.path, bytes.NewBufferString(pointer)); err != nil {
+		return err
+	}
+	if err := df.d.ref(digest, 1); err != nil {
+		return err
+	}
+	if replaced != nil {
+		return df.d.ref(replaced.digest, -1)
+	}
+	return nil
+}
+
+// Moves the written content into place as the blob for digest, or drops it if
+// that blob is already stored
+func (df *dedupFile) store(digest string) error {
+	backend, blob := df.d.backend, blobPath(digest)
+
+	_, err := backend.Stat(blob)
+	switch {
+	case err == nil:
+		return backend.Remove(df.tmpPath)
+	case !errors.Is(err, ErrNoFile):
+		return err
+	}
+
+	if err := MkdirAll(backend, pathpkg.Dir(blob)); err != nil {
+		return err
+	}
+	return backend.Move(df.tmpPath, blob)
+}
+
+// Gives up on the write, removing the temporary file. Every later call fails
+// with err.
+func (df *dedupFile) abort(err error) {
+	df.err = err
+	df.w.Close()
+	df.d.backend.Remove(df.tmpPath)
+}
@@ -0,0 +1,193 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dedup", func() {
+	var backend, fs FileSystem
+
+	BeforeEach(func() {
+		backend = Mem()
+		fs = Dedup(backend)
+	})
+
+	blobs := func() []string {
+		paths, err := Find(backend, "/blobs", func(path string, info os.FileInfo) bool {
+			return !info.IsDir()
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return paths
+	}
+
+	It("should store identical content once", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("same"))).To(Succeed())
+		Expect(fs.Copy("/directory/b.txt", strings.NewReader("same"))).To(Succeed())
+
+		Expect(blobs()).To(HaveLen(1))
+		Expect(ReadFile(fs, "/a.txt")).To(Equal([]byte("same")))
+		Expect(ReadFile(fs, "/directory/b.txt")).To(Equal([]byte("same")))
+	})
+
+	It("should store different content separately", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("one"))).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("two"))).To(Succeed())
+		Expect(blobs()).To(HaveLen(2))
+	})
+
+	It("should name blobs by their SHA-256", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("hi"))).To(Succeed())
+		Expect(blobs()).To(Equal([]string{
+			"/blobs/8f/8f434346648f6b96df89dda901c5176b10a6d83961dd3c1ac88b59b2dc327aa4",
+		}))
+	})
+
+	It("should not leave temporary files behind", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("same"))).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("same"))).To(Succeed())
+		Expect(backend.Readdir("/tmp")).To(BeEmpty())
+	})
+
+	It("should report the size of the content", func() {
+		Expect(fs.Copy("/directory/a.txt", strings.NewReader("hi, child"))).To(Succeed())
+
+		info, err := fs.Stat("/directory/a.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Size()).To(Equal(int64(9)))
+		Expect(info.Name()).To(Equal("a.txt"))
+
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Size()).To(Equal(int64(9)))
+
+		infos, err = fs.Readdir("/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].IsDir()).To(BeTrue())
+	})
+
+	It("should only remove content with its last file", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("same"))).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("same"))).To(Succeed())
+
+		Expect(fs.Remove("/a.txt")).To(Succeed())
+		Expect(blobs()).To(HaveLen(1))
+		Expect(ReadFile(fs, "/b.txt")).To(Equal([]byte("same")))
+
+		Expect(fs.Remove("/b.txt")).To(Succeed())
+		Expect(blobs()).To(BeEmpty())
+		Expect(backend.Readdir("/refs")).To(BeEmpty())
+	})
+
+	It("should count content written and removed concurrently", func() {
+		// Mem isn't safe for concurrent writes of its own
+		root, err := ioutil.TempDir("", "vfs-dedup")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(root)
+		backend, err = OS(root)
+		Expect(err).ToNot(HaveOccurred())
+		fs = Dedup(backend)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(path string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(fs.Copy(path, strings.NewReader("same"))).To(Succeed())
+			}(fmt.Sprintf("/%d.txt", i))
+		}
+		wg.Wait()
+		refs, err := backend.Readdir("/refs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(refs).To(HaveLen(1))
+		Expect(ReadFile(backend, "/refs/"+refs[0].Name())).To(Equal([]byte("20")))
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(path string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(fs.Remove(path)).To(Succeed())
+			}(fmt.Sprintf("/%d.txt", i))
+		}
+		wg.Wait()
+		Expect(blobs()).To(BeEmpty())
+		Expect(backend.Readdir("/refs")).To(BeEmpty())
+	})
+
+	It("should release content which is overwritten", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("old"))).To(Succeed())
+		Expect(fs.Copy("/a.txt", strings.NewReader("new"))).To(Succeed())
+
+		Expect(blobs()).To(HaveLen(1))
+		Expect(ReadFile(fs, "/a.txt")).To(Equal([]byte("new")))
+	})
+
+	It("should keep content rewritten to the same path", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("same"))).To(Succeed())
+		Expect(fs.Copy("/a.txt", strings.NewReader("same"))).To(Succeed())
+
+		Expect(blobs()).To(HaveLen(1))
+		Expect(ReadFile(fs, "/a.txt")).To(Equal([]byte("same")))
+	})
+
+	It("should move files without touching their content", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("moved"))).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("replaced"))).To(Succeed())
+
+		Expect(fs.Move("/a.txt", "/b.txt")).To(Succeed())
+		Expect(blobs()).To(HaveLen(1))
+		Expect(ReadFile(fs, "/b.txt")).To(Equal([]byte("moved")))
+
+		Expect(fs.Move("/b.txt", "/b.txt")).To(Succeed())
+		Expect(blobs()).To(HaveLen(1))
+	})
+
+	It("should write through Create", func() {
+		w, err := fs.Create("/a.txt")
+		Expect(err).ToNot(HaveOccurred())
+		w.Write([]byte("hi, "))
+		w.Write([]byte("root"))
+		Expect(w.Close()).To(Succeed())
+		Expect(w.Close()).To(MatchError(os.ErrClosed))
+
+		r, err := fs.Open("/a.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("hi, root")))
+	})
+
+	It("should return ErrNoFile with the logical path", func() {
+		_, err := fs.Open("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+
+		err = fs.Remove("/missing.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should manage directories in the tree of files", func() {
+		Expect(fs.Mkdir("/directory")).To(Succeed())
+		info, err := fs.Stat("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+
+		Expect(fs.Remove("/directory")).To(Succeed())
+		_, err = backend.Stat("/files/directory")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+})
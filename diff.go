@@ -0,0 +1,144 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+)
+
+// How a path differs between two `FileSystem`s
+type DiffKind int
+
+const (
+	// Only in the second `FileSystem`
+	Added DiffKind = iota
+	// Only in the first `FileSystem`
+	Removed
+	// In both, but a file in one and a directory in the other, or files with
+	// different content
+	Changed
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	case Changed:
+		return "Changed"
+	default:
+		return "Unknown"
+	}
+}
+
+type DiffEntry struct {
+	Path string
+	Kind DiffKind
+}
+
+// Compares the trees of two `FileSystem`s, which can be different backends,
+// and returns every path which differs, sorted by path. Files of the same size
+// have their content compared, stopping at the first difference.
+func Diff(a, b FileSystem) ([]DiffEntry, error) {
+	aInfos, err := walkInfos(a)
+	if err != nil {
+		return nil, err
+	}
+	bInfos, err := walkInfos(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []DiffEntry
+	for path, aInfo := range aInfos {
+		bInfo, ok := bInfos[path]
+		if !ok {
+			diffs = append(diffs, DiffEntry{path, Removed})
+			continue
+		}
+
+		changed, err := infoChanged(a, b, path, aInfo, bInfo)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			diffs = append(diffs, DiffEntry{path, Changed})
+		}
+	}
+	for path := range bInfos {
+		if _, ok := aInfos[path]; !ok {
+			diffs = append(diffs, DiffEntry{path, Added})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// Lists the whole tree by path. A directory which can't be read fails the
+// listing, rather than looking empty.
+func walkInfos(fs FileSystem) (map[string]os.FileInfo, error) {
+	infos := map[string]os.FileInfo{}
+	err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		infos[path] = info
+		return nil
+	})
+	return infos, err
+}
+
+func infoChanged(a, b FileSystem, path string, aInfo, bInfo os.FileInfo) (bool, error) {
+	switch {
+	case aInfo.IsDir() != bInfo.IsDir():
+		return true, nil
+	case aInfo.IsDir():
+		return false, nil
+	case aInfo.Size() != bInfo.Size():
+		return true, nil
+	}
+
+	same, err := sameContent(a, b, path)
+	return !same, err
+}
+
+// Reads both files a chunk at a time, stopping at the first difference
+func sameContent(a, b FileSystem, path string) (bool, error) {
+	ra, err := a.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer ra.Close()
+
+	rb, err := b.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer rb.Close()
+
+	pooledA, pooledB := getBuffer(), getBuffer()
+	defer putBuffer(pooledA)
+	defer putBuffer(pooledB)
+	bufA, bufB := *pooledA, *pooledB
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+
+		aDone := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		bDone := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !aDone:
+			return false, errA
+		case errB != nil && !bDone:
+			return false, errB
+		case aDone || bDone:
+			return aDone == bDone, nil
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package vfs
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	var original *MemNode
+
+	BeforeEach(func() {
+		original = Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				File("child.txt", []byte("hi, child")),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+			File("large.bin", bytes.Repeat([]byte("x"), 100*1024)),
+		).(*MemNode)
+	})
+
+	It("should find no differences in a clone", func() {
+		diffs, err := Diff(original, original.Clone())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+	})
+
+	It("should fail when a directory can't be read", func() {
+		failing := &failingReaddir{original.Clone(), "/directory"}
+
+		_, err := Diff(original, failing)
+		Expect(err).To(HaveOccurred())
+		_, err = Diff(failing, original)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should report added, removed and changed paths", func() {
+		modified := original.Clone()
+		Expect(modified.Copy("/directory/new.txt", bytes.NewReader([]byte("new")))).To(Succeed())
+		Expect(modified.Remove("/empty_directory")).To(Succeed())
+		Expect(modified.Copy("/root.txt", bytes.NewReader([]byte("hi, ROOT")))).To(Succeed())
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(Equal([]DiffEntry{
+			{"directory/new.txt", Added},
+			{"empty_directory", Removed},
+			{"root.txt", Changed},
+		}))
+	})
+
+	It("should report a change in size", func() {
+		modified := original.Clone()
+		Expect(modified.Copy("/directory/child.txt", bytes.NewReader([]byte("hi")))).To(Succeed())
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(Equal([]DiffEntry{{"directory/child.txt", Changed}}))
+	})
+
+	It("should compare content past the first chunk", func() {
+		content := bytes.Repeat([]byte("x"), 100*1024)
+		content[80*1024] = 'y'
+
+		modified := original.Clone()
+		Expect(modified.Copy("/large.bin", bytes.NewReader(content))).To(Succeed())
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(Equal([]DiffEntry{{"large.bin", Changed}}))
+	})
+
+	It("should report a file replaced by a directory", func() {
+		modified := original.Clone()
+		Expect(modified.Remove("/root.txt")).To(Succeed())
+		Expect(modified.Mkdir("/root.txt")).To(Succeed())
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(Equal([]DiffEntry{{"root.txt", Changed}}))
+	})
+
+	It("should name the kinds", func() {
+		Expect(Added.String()).To(Equal("Added"))
+		Expect(Removed.String()).To(Equal("Removed"))
+		Expect(Changed.String()).To(Equal("Changed"))
+	})
+
+})
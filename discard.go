@@ -0,0 +1,72 @@
+package vfs
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	pathpkg "path"
+)
+
+// A `FileSystem` which throws away everything written to it, for measuring
+// what's upstream of a backend without one. Create and Copy succeed, reading
+// all they're given, and Mkdir succeeds, but nothing is ever there afterward:
+// Open, Stat, Move and Remove fail with `ErrNoFile`, and every directory reads
+// as empty.
+func Discard() FileSystem {
+	return discard{}
+}
+
+type discard struct{}
+
+func (discard) Open(path string) (ReadSeekCloser, error) {
+	return nil, discardNoFile("open", path)
+}
+
+func (discard) Create(path string) (io.WriteCloser, error) {
+	return nopWriteCloser{ioutil.Discard}, nil
+}
+
+func (discard) Copy(path string, source io.Reader) error {
+	_, err := copyBuffer(ioutil.Discard, source)
+	return err
+}
+
+func (discard) Move(sourcePath, destinationPath string) error {
+	return discardNoFile("move", sourcePath)
+}
+
+func (discard) Remove(path string) error {
+	return discardNoFile("remove", path)
+}
+
+func (discard) Stat(path string) (os.FileInfo, error) {
+	return nil, discardNoFile("stat", path)
+}
+
+func (discard) Readdir(path string) ([]os.FileInfo, error) {
+	return []os.FileInfo{}, nil
+}
+
+func (discard) Mkdir(path string) error {
+	return nil
+}
+
+func (discard) URL() *url.URL {
+	return &url.URL{
+		Scheme: "discard",
+		Path:   "/",
+	}
+}
+
+func discardNoFile(op, path string) error {
+	return &os.PathError{Op: op, Path: pathpkg.Clean("/" + path), Err: ErrNoFile}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Discard", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Discard()
+	})
+
+	It("should read all of a large copy", func() {
+		source := bytes.NewReader(make([]byte, 8*1024*1024))
+		Expect(fs.Copy("/big.bin", source)).To(Succeed())
+		Expect(source.Len()).To(BeZero())
+	})
+
+	It("should accept writes through Create", func() {
+		w, err := fs.Create("/out.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(io.WriteString(w, "hi")).To(Equal(2))
+		Expect(w.Close()).To(Succeed())
+	})
+
+	It("should not keep what was written", func() {
+		Expect(WriteFile(fs, "/written.txt", []byte("hi"))).To(Succeed())
+
+		_, err := fs.Open("written.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/written.txt",
+			Err:  ErrNoFile,
+		}))
+		_, err = fs.Stat("/written.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		Expect(errors.Is(fs.Move("/written.txt", "/moved.txt"), ErrNoFile)).To(BeTrue())
+		Expect(errors.Is(fs.Remove("/written.txt"), ErrNoFile)).To(BeTrue())
+	})
+
+	It("should read every directory as empty", func() {
+		Expect(fs.Mkdir("/directory")).To(Succeed())
+		Expect(fs.Readdir("/directory")).To(BeEmpty())
+		Expect(fs.Readdir("/")).To(BeEmpty())
+	})
+})
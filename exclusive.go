@@ -0,0 +1,32 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	pathpkg "path"
+)
+
+// Implemented by `FileSystem`s which can create a file only if nothing is at
+// its path without a separate check beforehand
+type ExclusiveCreator interface {
+	CreateExclusive(path string) (io.WriteCloser, error)
+}
+
+// Creates a file like `Create`, but fails with `ErrExist` if something is
+// already at path rather than replacing it. Unless the `FileSystem` is an
+// `ExclusiveCreator`, this checks with Stat before creating the file, so two
+// callers racing to create the same path could both succeed.
+func CreateExclusive(fs FileSystem, path string) (io.WriteCloser, error) {
+	if ec, ok := fs.(ExclusiveCreator); ok {
+		return ec.CreateExclusive(path)
+	}
+
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path = pathpkg.Clean("/" + path)
+	if _, err := fs.Stat(path); err == nil {
+		return nil, &os.PathError{Op: "create", Path: path, Err: ErrExist}
+	}
+	return fs.Create(path)
+}
@@ -0,0 +1,78 @@
+package vfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CreateExclusive", func() {
+
+	itShouldBeExclusive := func(newFS func() FileSystem) {
+		var fs FileSystem
+
+		BeforeEach(func() {
+			fs = newFS()
+		})
+
+		It("should create a new file", func() {
+			w, err := CreateExclusive(fs, "/directory/new.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("new"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			Expect(ReadFile(fs, "/directory/new.txt")).To(Equal([]byte("new")))
+		})
+
+		It("should fail the second time for the same path", func() {
+			w, err := CreateExclusive(fs, "/lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			_, err = CreateExclusive(fs, "/lock")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "create",
+				Path: "/lock",
+				Err:  ErrExist,
+			}))
+			Expect(errors.Is(err, os.ErrExist)).To(BeTrue())
+		})
+
+		It("should leave an existing file alone", func() {
+			Expect(WriteString(fs, "/root.txt", "hi, root")).To(Succeed())
+
+			_, err := CreateExclusive(fs, "/root.txt")
+			Expect(errors.Is(err, ErrExist)).To(BeTrue())
+			Expect(ReadString(fs, "/root.txt")).To(Equal("hi, root"))
+		})
+	}
+
+	Describe("Mem", func() {
+		itShouldBeExclusive(func() FileSystem {
+			return Mem()
+		})
+	})
+
+	Describe("OS", func() {
+		var root string
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		itShouldBeExclusive(func() FileSystem {
+			var err error
+			root, err = ioutil.TempDir("", "vfs-exclusive")
+			Expect(err).ToNot(HaveOccurred())
+
+			fs, err := OS(root)
+			Expect(err).ToNot(HaveOccurred())
+			return fs
+		})
+	})
+
+})
@@ -0,0 +1,73 @@
+package vfs
+
+import (
+	pathpkg "path"
+	"strings"
+)
+
+// Implemented by `FileSystem`s which can match a pattern more cheaply than by
+// reading every directory it could match in
+type Globber interface {
+	Glob(pattern string) ([]string, error)
+}
+
+// Returns the paths matching pattern, using the syntax of `path.Match` for
+// each element, like `filepath.Glob` does on disk. Matches are sorted within
+// each directory. As with `filepath.Glob`, errors reading directories are
+// ignored, and the only error is `path.ErrBadPattern`. If the `FileSystem` is
+// a `Globber` its implementation is used instead.
+func Glob(fs FileSystem, pattern string) ([]string, error) {
+	if _, err := pathpkg.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if g, ok := fs.(Globber); ok {
+		return g.Glob(pattern)
+	}
+	pattern = pathpkg.Clean("/" + pattern)
+
+	if !hasMeta(pattern) {
+		if _, err := fs.Stat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := pathpkg.Split(pattern)
+	dirs := []string{pathpkg.Clean(dir)}
+	if hasMeta(dir) {
+		var err error
+		if dirs, err = Glob(fs, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []string
+	for _, dir := range dirs {
+		infos, err := fs.Readdir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if ok, _ := pathpkg.Match(file, info.Name()); ok {
+				matches = append(matches, pathpkg.Join(dir, info.Name()))
+			}
+		}
+	}
+	return matches, nil
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// Escapes the metacharacters of a path, so it only matches itself
+func quoteMeta(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	pathpkg "path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Glob", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory",
+				Dir("sub_directory",
+					File("deep.txt", []byte("deep")),
+				),
+				File("child.txt", []byte("hi, child")),
+				File("child.md", []byte("# hi")),
+			),
+			Dir("other",
+				File("child.txt", []byte("other child")),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+	})
+
+	It("should match files in a directory", func() {
+		matches, err := Glob(fs, "/directory/*.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/directory/child.txt"}))
+	})
+
+	It("should match patterns in directory names", func() {
+		matches, err := Glob(fs, "/*/child.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{
+			"/directory/child.txt",
+			"/other/child.txt",
+		}))
+	})
+
+	It("should not cross directories with a star", func() {
+		matches, err := Glob(fs, "/directory/*/*.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/directory/sub_directory/deep.txt"}))
+	})
+
+	It("should treat paths as rooted", func() {
+		matches, err := Glob(fs, "root.*")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/root.txt"}))
+	})
+
+	It("should return a literal path only if it exists", func() {
+		matches, err := Glob(fs, "/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/root.txt"}))
+
+		matches, err = Glob(fs, "/missing.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(BeEmpty())
+	})
+
+	It("should ignore patterns through files", func() {
+		matches, err := Glob(fs, "/root.txt/*")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(BeEmpty())
+	})
+
+	It("should reject a bad pattern", func() {
+		_, err := Glob(fs, "/directory/[")
+		Expect(err).To(Equal(pathpkg.ErrBadPattern))
+	})
+
+	It("should match beneath the root of a Subtree", func() {
+		st, err := Subtree(fs, "/directory")
+		Expect(err).ToNot(HaveOccurred())
+
+		matches, err := Glob(st, "/*/*.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/sub_directory/deep.txt"}))
+	})
+
+})
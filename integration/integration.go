@@ -17,10 +17,14 @@ package integration
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -249,6 +253,30 @@ func open(fsp *setupOnce) {
 				Expect(t.Op).To(Equal("open"))
 				Expect(t.Path).To(Equal("/missing.txt"))
 			}
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+
+		It("should not open a directory", func() {
+			_, err := fs.Open("/directory")
+			Expect(err).To(HaveOccurred())
+
+			switch t := err.(type) {
+			default:
+				Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
+			case *os.PathError:
+				Expect(t.Op).To(Equal("open"))
+				Expect(t.Path).To(Equal("/directory"))
+				Expect(t.Err).To(Equal(vfs.ErrIsDir))
+			}
+		})
+
+		It("should not open a directory with a trailing slash", func() {
+			_, err := fs.Open("/directory/")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "open",
+				Path: "/directory",
+				Err:  vfs.ErrIsDir,
+			}))
 		})
 
 	})
@@ -282,21 +310,27 @@ func create(fsp *setupOnce) {
 			Expect(string(bs)).To(Equal("Party city"))
 		})
 
-		// This is skipped because it passes for os and mem implementations but not
-		// for S3.
-		XIt("should not create a in a missing directory", func() {
-			_, err := fs.Open("whodat/missing.txt")
-			Expect(err).To(HaveOccurred())
+		It("should create missing parent directories", func() {
+			w, err := fs.Create("whodat/missing.txt")
+			Expect(err).ToNot(HaveOccurred())
+			defer vfs.RemoveAll(fs, "whodat")
 
-			switch t := err.(type) {
-			default:
-				Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
-			case *os.PathError:
-				Expect(t.Op).To(Equal("open"))
-				Expect(t.Path).To(Equal("/whodat/missing.txt"))
-			}
+			_, err = w.Write([]byte("found it"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			info, err := fs.Stat("whodat")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+
+			r, err := fs.Open("whodat/missing.txt")
+			Expect(err).ToNot(HaveOccurred())
+			bs, _ := ioutil.ReadAll(r)
+			Expect(string(bs)).To(Equal("found it"))
+		})
 
-			_, err = fs.Create("whodat/missing.txt")
+		It("should not create a file beneath another file", func() {
+			_, err := fs.Create("root.txt/missing.txt")
 			Expect(err).To(HaveOccurred())
 
 			switch t := err.(type) {
@@ -304,12 +338,37 @@ func create(fsp *setupOnce) {
 				Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
 			case *os.PathError:
 				Expect(t.Op).To(Equal("create"))
-				// checking suffix here since each implementation won't have an
-				// identical root path
-				Expect(t.Path).To(HaveSuffix("/whodat/missing.txt"))
 			}
 		})
 
+		It("should not create a file over a directory", func() {
+			_, err := fs.Create("directory")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "create",
+				Path: "/directory",
+				Err:  vfs.ErrIsDir,
+			}))
+
+			info, err := fs.Stat("directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+		})
+
+		It("should not create a file with a trailing slash", func() {
+			_, err := fs.Create("trailing/")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "create",
+				Path: "/trailing",
+				Err:  vfs.ErrIsDir,
+			}))
+
+			_, err = fs.Create("directory/")
+			Expect(errors.Is(err, vfs.ErrIsDir)).To(BeTrue())
+
+			_, err = fs.Stat("trailing")
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+
 		It("should truncate the contents of an existing file at that path", func() {
 			w, err := fs.Create("root2.txt")
 			Expect(err).ToNot(HaveOccurred())
@@ -385,6 +444,14 @@ func fsCopy(fsp *setupOnce) {
 			Expect(string(bs)).To(Equal("burning Jamesway sign"))
 		})
 
+		It("should not copy to a path with a trailing slash", func() {
+			err := fs.Copy("jamesway/", bytes.NewReader([]byte("sign")))
+			Expect(errors.Is(err, vfs.ErrIsDir)).To(BeTrue())
+
+			_, err = fs.Stat("jamesway")
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+
 	})
 }
 
@@ -408,6 +475,7 @@ func fsMove(fsp *setupOnce) {
 			_, err = fs.Stat("directory/child.txt")
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("stat /directory/child.txt: No such file"))
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
 
 			moved, err := fs.Stat("directory/sub_directory/child.txt")
 			Expect(err).ToNot(HaveOccurred())
@@ -456,6 +524,7 @@ func remove(fsp *setupOnce) {
 				Expect(t.Op).To(Equal("remove"))
 				Expect(t.Path).To(Equal("/missing.txt"))
 			}
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
 		})
 
 		It("should be able to remove the root directory", func() {
@@ -475,6 +544,27 @@ func remove(fsp *setupOnce) {
 			Expect(infos).To(HaveLen(numFilesExpected))
 		})
 
+		It("should keep a directory after its last file is removed", func() {
+			w, err := fs.Create("emptied/only.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			defer fs.Remove("emptied")
+
+			Expect(fs.Remove("emptied/only.txt")).To(Succeed())
+
+			info, err := fs.Stat("emptied")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+
+			infos, err := fs.Readdir("emptied")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(BeEmpty())
+
+			infos, err = fs.Readdir("/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(numFilesExpected + 1))
+		})
+
 	})
 
 }
@@ -513,6 +603,24 @@ func mkdir(fsp *setupOnce) {
 			Expect(info.Name()).To(Equal("directory"))
 			Expect(info.IsDir()).To(BeTrue())
 		})
+
+		It("should not make a directory that already exists", func() {
+			err := fs.Mkdir("/directory")
+			Expect(err).To(HaveOccurred())
+
+			switch t := err.(type) {
+			default:
+				Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
+			case *os.PathError:
+				Expect(t.Op).To(Equal("mkdir"))
+				Expect(t.Path).To(Equal("/directory"))
+			}
+			Expect(errors.Is(err, os.ErrExist)).To(BeTrue())
+
+			infos, err := fs.Readdir("/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(numFilesExpected))
+		})
 	})
 }
 
@@ -557,6 +665,79 @@ func fileOperations(fsp *setupOnce) {
 	})
 }
 
+func checksum(fsp *setupOnce) {
+	var fs vfs.FileSystem
+
+	Describe("Checksum", func() {
+
+		BeforeEach(func() {
+			fs = fsp.Get()
+		})
+
+		It("should md5 a file", func() {
+			sum, err := vfs.Checksum(fs, "/root.txt", md5.New())
+			Expect(err).ToNot(HaveOccurred())
+
+			expected := md5.Sum([]byte("hi, root"))
+			Expect(sum).To(Equal(expected[:]))
+		})
+
+		It("should sha256 a file", func() {
+			sum, err := vfs.Checksum(fs, "/root.txt", sha256.New())
+			Expect(err).ToNot(HaveOccurred())
+
+			expected := sha256.Sum256([]byte("hi, root"))
+			Expect(sum).To(Equal(expected[:]))
+		})
+
+		It("should not checksum a missing file", func() {
+			_, err := vfs.Checksum(fs, "/missing.txt", md5.New())
+			Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		})
+
+	})
+}
+
+func touch(fsp *setupOnce) {
+	var fs vfs.FileSystem
+
+	Describe("Touch", func() {
+
+		BeforeEach(func() {
+			fs = fsp.Get()
+		})
+
+		It("should create an empty file", func() {
+			Expect(vfs.Touch(fs, "/touched.txt")).To(Succeed())
+			defer fs.Remove("/touched.txt")
+
+			info, err := fs.Stat("/touched.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeFalse())
+			Expect(info.Size()).To(Equal(int64(0)))
+		})
+
+		It("should update the modTime of an existing file", func() {
+			orig, err := fs.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(vfs.Touch(fs, "/root.txt")).To(Succeed())
+
+			touched, err := fs.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(touched.ModTime()).To(BeTemporally(">=", orig.ModTime()))
+			Expect(touched.ModTime()).To(BeTemporally("~", time.Now(), time.Second))
+
+			r, err := fs.Open("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+			bs, _ := ioutil.ReadAll(r)
+			Expect(string(bs)).To(Equal("hi, root"))
+		})
+
+	})
+}
+
 func All(fsp FSProvider) bool {
 	once := &setupOnce{fsp: fsp}
 
@@ -570,6 +751,8 @@ func All(fsp FSProvider) bool {
 		create(once)
 		mkdir(once)
 		fileOperations(once)
+		checksum(once)
+		touch(once)
 	})
 
 	return true
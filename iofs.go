@@ -0,0 +1,295 @@
+package vfs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+// Adapts a `FileSystem` to the standard library's `fs.FS`, so it can be handed
+// to things like `http.FS` and `template.ParseFS`. Names follow the `io/fs`
+// rules: they're unrooted, and "." is the root of the `FileSystem`.
+func AsIOFS(fs FileSystem) iofs.FS {
+	return &ioFS{fs}
+}
+
+type ioFS struct {
+	fs FileSystem
+}
+
+// The path of a valid `io/fs` name in the `FileSystem`
+func (f *ioFS) path(op, name string) (string, error) {
+	if !iofs.ValidPath(name) {
+		return "", &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	return pathpkg.Clean("/" + name), nil
+}
+
+// Gives back an error with the name it was asked for, rather than the path in
+// the `FileSystem`
+func (f *ioFS) nameError(op, name string, err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (f *ioFS) Open(name string) (iofs.File, error) {
+	path, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fs.Stat(path)
+	if err != nil {
+		return nil, f.nameError("open", name, err)
+	}
+	info = &namedFileInfo{info, pathpkg.Base(name)}
+
+	if info.IsDir() {
+		return &ioDir{fs: f.fs, path: path, info: info}, nil
+	}
+	if Supports(f.fs, CapOpenRange) {
+		return &rangeFile{fs: f.fs, path: path, info: info}, nil
+	}
+	r, err := f.fs.Open(path)
+	if err != nil {
+		return nil, f.nameError("open", name, err)
+	}
+	return &ioFile{r, info}, nil
+}
+
+// Reads a whole file with `ReadFile`, without going through `Open`
+func (f *ioFS) ReadFile(name string) ([]byte, error) {
+	path, err := f.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ReadFile(f.fs, path)
+	if err != nil {
+		return nil, f.nameError("readfile", name, err)
+	}
+	return content, nil
+}
+
+// Matches pattern with `Glob`. Like the names it returns, pattern is unrooted.
+func (f *ioFS) Glob(pattern string) ([]string, error) {
+	if _, err := pathpkg.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(pattern, "/") {
+		return nil, nil
+	}
+
+	matches, err := Glob(f.fs, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = strings.TrimPrefix(match, "/")
+		if matches[i] == "" {
+			matches[i] = "."
+		}
+	}
+	return matches, nil
+}
+
+// Wraps a `Subtree` of the `FileSystem` rooted at dir, so `fs.Sub` keeps the
+// backend's own handling of subtrees rather than prefixing every name
+func (f *ioFS) Sub(dir string) (iofs.FS, error) {
+	path, err := f.path("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if path == "/" {
+		return f, nil
+	}
+	tree, err := Subtree(f.fs, path)
+	if err != nil {
+		return nil, f.nameError("sub", dir, err)
+	}
+	return AsIOFS(tree), nil
+}
+
+// A `FileInfo` going by another name, like "." for the root in `io/fs`
+type namedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *namedFileInfo) Name() string {
+	return fi.name
+}
+
+type ioFile struct {
+	ReadSeekCloser
+	info os.FileInfo
+}
+
+func (f *ioFile) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+// A file opened through `AsIOFS` from a `RangeOpener`, which reads with
+// `OpenRange` rather than opening all of it. Nothing is read until the first
+// Read, so `http.ServeContent` seeking to a Range and reading it fetches only
+// what it asked for. The first Read after a Seek fetches just the bytes it
+// wants, which covers most small ranges; reading on streams the rest of the
+// file, so a long read isn't a request per buffer.
+type rangeFile struct {
+	fs     FileSystem
+	path   string
+	info   os.FileInfo
+	offset int64
+
+	// What's being read from, and whether it runs to the end of the file
+	stream    io.ReadCloser
+	streaming bool
+	// Whether there's been a Read since the last Seek
+	reading bool
+}
+
+func (f *rangeFile) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *rangeFile) Read(p []byte) (int, error) {
+	for {
+		if f.offset >= f.info.Size() {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		if f.stream == nil {
+			length := int64(len(p))
+			f.streaming = f.reading
+			if f.streaming {
+				length = f.info.Size() - f.offset
+			}
+			r, err := OpenRange(f.fs, f.path, f.offset, length)
+			if err != nil {
+				return 0, err
+			}
+			f.stream = r
+			f.reading = true
+		}
+
+		n, err := f.stream.Read(p)
+		f.offset += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+
+		f.stream.Close()
+		f.stream = nil
+		switch {
+		case f.offset >= f.info.Size():
+			return n, io.EOF
+		case f.streaming:
+			// The file ended before the size it was opened with
+			return n, io.ErrUnexpectedEOF
+		case n > 0:
+			return n, nil
+		}
+	}
+}
+
+func (f *rangeFile) ReadAt(p []byte, off int64) (int, error) {
+	r, err := OpenRange(f.fs, f.path, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *rangeFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &iofs.PathError{Op: "seek", Path: f.info.Name(), Err: iofs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &iofs.PathError{Op: "seek", Path: f.info.Name(), Err: iofs.ErrInvalid}
+	}
+
+	if offset != f.offset {
+		f.offset = offset
+		f.reading = false
+		if f.stream != nil {
+			f.stream.Close()
+			f.stream = nil
+		}
+	}
+	return offset, nil
+}
+
+func (f *rangeFile) Close() error {
+	if f.stream == nil {
+		return nil
+	}
+	err := f.stream.Close()
+	f.stream = nil
+	return err
+}
+
+// A directory opened through `AsIOFS`. It's listed on the first ReadDir.
+type ioDir struct {
+	fs      FileSystem
+	path    string
+	info    os.FileInfo
+	entries []iofs.DirEntry
+	read    bool
+}
+
+func (d *ioDir) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *ioDir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.info.Name(), Err: ErrIsDir}
+}
+
+func (d *ioDir) Close() error {
+	return nil
+}
+
+func (d *ioDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if !d.read {
+		infos, err := d.fs.Readdir(d.path)
+		if err != nil {
+			return nil, &iofs.PathError{Op: "readdir", Path: d.info.Name(), Err: err}
+		}
+		for _, info := range infos {
+			d.entries = append(d.entries, dirEntry{info})
+		}
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,155 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AsIOFS", func() {
+	var fsys iofs.FS
+
+	BeforeEach(func() {
+		fsys = AsIOFS(Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				File("child.txt", []byte("hi, child")),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+		))
+	})
+
+	It("should pass the standard library's tests", func() {
+		Expect(fstest.TestFS(fsys,
+			"directory/child.txt",
+			"directory/sub_directory",
+			"empty_directory",
+			"root.txt",
+		)).To(Succeed())
+	})
+
+	It("should be a GlobFS", func() {
+		_, ok := fsys.(iofs.GlobFS)
+		Expect(ok).To(BeTrue())
+
+		matches, err := iofs.Glob(fsys, "*/*.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"directory/child.txt"}))
+
+		matches, err = iofs.Glob(fsys, "/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(BeEmpty())
+	})
+
+	It("should be a ReadFileFS", func() {
+		_, ok := fsys.(iofs.ReadFileFS)
+		Expect(ok).To(BeTrue())
+
+		content, err := iofs.ReadFile(fsys, "directory/child.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("hi, child"))
+	})
+
+	It("should report missing files by their io/fs name", func() {
+		_, err := iofs.ReadFile(fsys, "directory/missing.txt")
+		Expect(err).To(MatchError(&iofs.PathError{
+			Op:   "readfile",
+			Path: "directory/missing.txt",
+			Err:  ErrNoFile,
+		}))
+		Expect(errors.Is(err, iofs.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should reject rooted names", func() {
+		_, err := fsys.Open("/root.txt")
+		Expect(errors.Is(err, iofs.ErrInvalid)).To(BeTrue())
+	})
+
+	Describe("with a RangeOpener", func() {
+		var content []byte
+
+		BeforeEach(func() {
+			content = make([]byte, 10000)
+			for i := range content {
+				content[i] = byte(i % 251)
+			}
+			fsys = AsIOFS(Mem(File("large.bin", content)))
+		})
+
+		It("should serve a Range request through net/http", func() {
+			req := httptest.NewRequest("GET", "/large.bin", nil)
+			req.Header.Set("Range", "bytes=1000-2000")
+			resp := httptest.NewRecorder()
+			http.FileServer(http.FS(fsys)).ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusPartialContent))
+			Expect(resp.Header().Get("Content-Range")).To(Equal("bytes 1000-2000/10000"))
+			Expect(resp.Body.Bytes()).To(Equal(content[1000:2001]))
+		})
+
+		It("should read across seeks", func() {
+			f, err := fsys.Open("large.bin")
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+			rs := f.(io.ReadSeeker)
+
+			Expect(rs.Seek(-10, io.SeekEnd)).To(Equal(int64(9990)))
+			Expect(ioutil.ReadAll(rs)).To(Equal(content[9990:]))
+
+			Expect(rs.Seek(0, io.SeekStart)).To(Equal(int64(0)))
+			all, err := ioutil.ReadAll(rs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bytes.Equal(all, content)).To(BeTrue())
+		})
+	})
+
+	Describe("Sub", func() {
+
+		It("should wrap a Subtree", func() {
+			sub, err := iofs.Sub(fsys, "directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sub.(*ioFS).fs).To(BeAssignableToTypeOf(&subtree{}))
+
+			content, err := iofs.ReadFile(sub, "child.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("hi, child"))
+
+			Expect(fstest.TestFS(sub, "child.txt", "sub_directory")).To(Succeed())
+		})
+
+		It("should flatten nested subs", func() {
+			sub, err := iofs.Sub(fsys, "directory")
+			Expect(err).ToNot(HaveOccurred())
+			sub, err = iofs.Sub(sub, "sub_directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sub.(*ioFS).fs.(*subtree).root).To(Equal("/directory/sub_directory"))
+		})
+
+		It("should return itself for the root", func() {
+			sub, err := iofs.Sub(fsys, ".")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sub).To(BeIdenticalTo(fsys))
+		})
+
+		It("should not sub a missing directory", func() {
+			_, err := iofs.Sub(fsys, "missing")
+			Expect(errors.Is(err, iofs.ErrNotExist)).To(BeTrue())
+		})
+
+		It("should reject rooted names", func() {
+			_, err := iofs.Sub(fsys, "/directory")
+			Expect(errors.Is(err, iofs.ErrInvalid)).To(BeTrue())
+		})
+
+	})
+
+})
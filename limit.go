@@ -0,0 +1,85 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	pathpkg "path"
+)
+
+// Returned, wrapped in an `*os.PathError`, by writes through `CreateLimited`
+// which would take a file past its limit
+var ErrTooLarge = errors.New("File too large")
+
+// Implemented by writers which can give up on a file, discarding what was
+// written to it instead of finalizing it the way Close would
+type Aborter interface {
+	Abort() error
+}
+
+// Creates a file which can't grow past maxBytes, for writing uploads from
+// clients which can't be trusted with the size. A write which would take it
+// past the limit fails with `ErrTooLarge`, as does the Close after it, and
+// nothing written is kept. The file is written to a temporary file and moved
+// into place like one from `CreateAtomic`, so it's never seen partly written.
+// That's done even for an `AtomicCreator`, whose writers may have no way to be
+// given up on without replacing the file.
+func CreateLimited(fs FileSystem, path string, maxBytes int64) (io.WriteCloser, error) {
+	path = pathpkg.Clean("/" + path)
+	w, err := createAtomicFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedFile{w: w, path: path, max: maxBytes}, nil
+}
+
+type limitedFile struct {
+	w       *atomicFile
+	path    string
+	max     int64
+	written int64
+	err     error
+}
+
+func (lf *limitedFile) Write(p []byte) (int, error) {
+	if lf.err != nil {
+		return 0, lf.err
+	}
+	if int64(len(p)) > lf.max-lf.written {
+		lf.abort(&os.PathError{Op: "write", Path: lf.path, Err: ErrTooLarge})
+		return 0, lf.err
+	}
+
+	n, err := lf.w.Write(p)
+	lf.written += int64(n)
+	if err != nil {
+		lf.abort(err)
+	}
+	return n, err
+}
+
+func (lf *limitedFile) Close() error {
+	if lf.err != nil {
+		return lf.err
+	}
+	lf.err = os.ErrClosed
+	return lf.w.Close()
+}
+
+// Gives up on the file, discarding what was written. Every later call fails
+// with err.
+func (lf *limitedFile) abort(err error) {
+	lf.err = err
+	lf.w.Abort()
+}
+
+// Discards a file being written to path, aborting the writer if it can be and
+// otherwise closing it and removing whatever it left behind
+func abortWriter(fs FileSystem, path string, w io.WriteCloser) {
+	if a, ok := w.(Aborter); ok {
+		a.Abort()
+		return
+	}
+	w.Close()
+	fs.Remove(path)
+}
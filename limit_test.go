@@ -0,0 +1,91 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// An `AtomicCreator` whose writers publish on Close and can't be aborted
+type unabortableAtomic struct {
+	FileSystem
+}
+
+func (fs unabortableAtomic) CreateAtomic(path string) (io.WriteCloser, error) {
+	return fs.Create(path)
+}
+
+var _ = Describe("CreateLimited", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(Dir("uploads"))
+	})
+
+	write := func(size int) error {
+		w, err := CreateLimited(fs, "/uploads/upload.bin", 10)
+		Expect(err).ToNot(HaveOccurred())
+		if _, err := w.Write(bytes.Repeat([]byte("x"), size)); err != nil {
+			Expect(w.Close()).To(MatchError(err))
+			return err
+		}
+		return w.Close()
+	}
+
+	It("should write a file just under the limit", func() {
+		Expect(write(9)).To(Succeed())
+		Expect(ReadFile(fs, "/uploads/upload.bin")).To(HaveLen(9))
+	})
+
+	It("should write a file exactly at the limit", func() {
+		Expect(write(10)).To(Succeed())
+		Expect(ReadFile(fs, "/uploads/upload.bin")).To(HaveLen(10))
+	})
+
+	It("should discard a file over the limit", func() {
+		Expect(write(11)).To(MatchError(&os.PathError{
+			Op:   "write",
+			Path: "/uploads/upload.bin",
+			Err:  ErrTooLarge,
+		}))
+
+		_, err := fs.Stat("/uploads/upload.bin")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		Expect(fs.Readdir("/uploads")).To(BeEmpty())
+	})
+
+	It("should discard what was written before the limit", func() {
+		w, err := CreateLimited(fs, "/uploads/upload.bin", 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write([]byte("12345"))).To(Equal(5))
+		Expect(w.Write([]byte("67890"))).To(Equal(5))
+
+		_, err = w.Write([]byte("!"))
+		Expect(errors.Is(err, ErrTooLarge)).To(BeTrue())
+		_, err = w.Write([]byte("!"))
+		Expect(errors.Is(err, ErrTooLarge)).To(BeTrue())
+		Expect(errors.Is(w.Close(), ErrTooLarge)).To(BeTrue())
+
+		Expect(fs.Readdir("/uploads")).To(BeEmpty())
+	})
+
+	It("should keep the file it was replacing", func() {
+		Expect(WriteFile(fs, "/uploads/upload.bin", []byte("old"))).To(Succeed())
+
+		Expect(errors.Is(write(11), ErrTooLarge)).To(BeTrue())
+		Expect(ReadString(fs, "/uploads/upload.bin")).To(Equal("old"))
+	})
+
+	It("should keep the file it was replacing on an AtomicCreator", func() {
+		fs = unabortableAtomic{fs}
+		Expect(WriteFile(fs, "/uploads/upload.bin", []byte("old"))).To(Succeed())
+
+		Expect(errors.Is(write(11), ErrTooLarge)).To(BeTrue())
+		Expect(ReadString(fs, "/uploads/upload.bin")).To(Equal("old"))
+		Expect(fs.Readdir("/uploads")).To(HaveLen(1))
+	})
+})
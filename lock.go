@@ -0,0 +1,131 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	pathpkg "path"
+	"sync"
+)
+
+// Returned, wrapped in an `*os.PathError`, by optional operations a
+// `FileSystem` can't provide
+var ErrNotSupported = errors.New("Operation not supported")
+
+// Implemented by `FileSystem`s with advisory, single-writer locks on paths.
+// The locks only coordinate callers which also take them; they don't stop
+// anything from reading or writing the path.
+type Locker interface {
+	// Blocks until the lock on path is held
+	Lock(path string) (Unlocker, error)
+
+	// Takes the lock on path if it's free, without waiting. When it's held
+	// elsewhere the Unlocker is nil and ok is false.
+	TryLock(path string) (unlocker Unlocker, ok bool, err error)
+}
+
+// Releases a lock taken from a `Locker`. Close is the same as Unlock, so a lock
+// can be released with a defer like any other resource.
+type Unlocker interface {
+	io.Closer
+	Unlock() error
+}
+
+// A lock on a path of a memory `FileSystem`, kept on the node it was taken
+// from. It's a channel with room for a single token, held while the token is
+// in it. It's dropped from the node once nothing holds or waits on it.
+type memLock struct {
+	token chan struct{}
+	refs  int
+}
+
+func (mn *MemNode) acquireLock(path string) (string, *memLock) {
+	path = pathpkg.Clean("/" + path)
+
+	mn.lockMu.Lock()
+	defer mn.lockMu.Unlock()
+	if mn.locks == nil {
+		mn.locks = make(map[string]*memLock)
+	}
+	lock, ok := mn.locks[path]
+	if !ok {
+		lock = &memLock{token: make(chan struct{}, 1)}
+		mn.locks[path] = lock
+	}
+	lock.refs++
+	return path, lock
+}
+
+func (mn *MemNode) releaseLock(path string, lock *memLock) {
+	mn.lockMu.Lock()
+	defer mn.lockMu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(mn.locks, path)
+	}
+}
+
+// Takes an in-process lock on path, which doesn't need to exist
+func (mn *MemNode) Lock(path string) (Unlocker, error) {
+	path, lock := mn.acquireLock(path)
+	lock.token <- struct{}{}
+	return &memUnlocker{root: mn, path: path, lock: lock}, nil
+}
+
+func (mn *MemNode) TryLock(path string) (Unlocker, bool, error) {
+	path, lock := mn.acquireLock(path)
+	select {
+	case lock.token <- struct{}{}:
+		return &memUnlocker{root: mn, path: path, lock: lock}, true, nil
+	default:
+		mn.releaseLock(path, lock)
+		return nil, false, nil
+	}
+}
+
+type memUnlocker struct {
+	once sync.Once
+	root *MemNode
+	path string
+	lock *memLock
+}
+
+func (mu *memUnlocker) Unlock() error {
+	err := os.ErrClosed
+	mu.once.Do(func() {
+		<-mu.lock.token
+		mu.root.releaseLock(mu.path, mu.lock)
+		err = nil
+	})
+	return err
+}
+
+func (mu *memUnlocker) Close() error {
+	return mu.Unlock()
+}
+
+func (s *subtree) Lock(path string) (Unlocker, error) {
+	locker, ok := s.fs.(Locker)
+	if !ok {
+		return nil, &os.PathError{
+			Op:   "lock",
+			Path: pathpkg.Clean("/" + path),
+			Err:  ErrNotSupported,
+		}
+	}
+	unlocker, err := locker.Lock(s.mapPath(path))
+	return unlocker, s.unmapError(err)
+}
+
+func (s *subtree) TryLock(path string) (Unlocker, bool, error) {
+	locker, ok := s.fs.(Locker)
+	if !ok {
+		return nil, false, &os.PathError{
+			Op:   "lock",
+			Path: pathpkg.Clean("/" + path),
+			Err:  ErrNotSupported,
+		}
+	}
+	unlocker, locked, err := locker.TryLock(s.mapPath(path))
+	return unlocker, locked, s.unmapError(err)
+}
@@ -2,12 +2,17 @@ package vfs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
+	"net/http"
 	"net/url"
 	"os"
 	pathpkg "path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,14 +21,63 @@ func Mem(children ...*MemNode) FileSystem {
 	return Dir("", children...)
 }
 
+// Creates a memory `FileSystem` from slash-separated paths and their contents,
+// creating the directories they imply. A path ending in a slash creates an
+// empty directory. Panics if one path is a file and another is beneath it.
+func MemFromMap(files map[string][]byte) FileSystem {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	root := Dir("")
+	for _, path := range paths {
+		if strings.HasSuffix(path, "/") {
+			if root.mkdirAll(path) == nil {
+				panic(fmt.Sprintf("vfs: %s is beneath a file", path))
+			}
+			continue
+		}
+
+		clean := pathpkg.Clean("/" + path)
+		dir := root.mkdirAll(pathpkg.Dir(clean))
+		if dir == nil {
+			panic(fmt.Sprintf("vfs: %s is beneath a file", path))
+		}
+		dir.addChild(File(pathpkg.Base(clean), files[path]))
+	}
+	return root
+}
+
+// Loads a directory on disk into a memory `FileSystem`, keeping the names,
+// contents and modTimes of everything beneath it. Only regular files and
+// directories are copied; symlinks and other special files are skipped.
+func MemFromDir(osRoot string) (FileSystem, error) {
+	fs, err := OS(osRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	root := Dir("")
+	if err := root.load(fs, "/"); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
 // Convenience function for creating a directory in memory
 func Dir(name string, children ...*MemNode) *MemNode {
-	return &MemNode{
+	dir := &MemNode{
 		name:     name,
 		modTime:  time.Now(),
 		isDir:    true,
-		children: children,
+		children: make(map[string]*MemNode, len(children)),
 	}
+	for _, child := range children {
+		dir.addChild(child)
+	}
+	return dir
 }
 
 func File(name string, content []byte) *MemNode {
@@ -46,33 +100,233 @@ type MemNode struct {
 	isDir    bool
 	modTime  time.Time
 	content  []byte
-	children []*MemNode
+	children map[string]*MemNode // keyed by name, only set for directories
+
+	// Watches and locks taken on the tree from this node
+	watchMu sync.Mutex
+	watches []*memWatch
+	lockMu  sync.Mutex
+	locks   map[string]*memLock
 }
 
+// A file being written in memory. Like an `*os.File` it can Seek, Read back
+// what's been written, and write at any offset; writing past the end fills the
+// gap with zeros. Nothing is visible in the `FileSystem` until Close.
 type memFile struct {
-	closed  bool
-	content bytes.Buffer
-	dir     *MemNode
-	path    string
+	closed   bool
+	content  []byte
+	offset   int64
+	root     *MemNode
+	dir      *MemNode
+	path     string
+	replaced bool // whether a file was at path when it was created
 }
 
 func (mf *memFile) Write(p []byte) (int, error) {
+	n, err := mf.WriteAt(p, mf.offset)
+	mf.offset += int64(n)
+	return n, err
+}
+
+// Copies through a buffer from the pool rather than the new one `io.Copy` would
+// make for every file
+func (mf *memFile) ReadFrom(r io.Reader) (int64, error) {
+	return copyBuffer(struct{ io.Writer }{mf}, r)
+}
+
+func (mf *memFile) WriteAt(p []byte, off int64) (int, error) {
 	if mf.closed {
 		return 0, os.ErrClosed
 	}
-	return mf.content.Write(p)
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if end := off + int64(len(p)); end > int64(len(mf.content)) {
+		if end > int64(cap(mf.content)) {
+			grown := make([]byte, len(mf.content), 2*end)
+			copy(grown, mf.content)
+			mf.content = grown
+		}
+		mf.content = mf.content[:end]
+	}
+	return copy(mf.content[off:], p), nil
+}
+
+func (mf *memFile) Read(p []byte) (int, error) {
+	n, err := mf.ReadAt(p, mf.offset)
+	mf.offset += int64(n)
+	return n, err
+}
+
+func (mf *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if mf.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(mf.content)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, mf.content[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mf *memFile) Seek(offset int64, whence int) (int64, error) {
+	if mf.closed {
+		return 0, os.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += mf.offset
+	case io.SeekEnd:
+		offset += int64(len(mf.content))
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	mf.offset = offset
+	return offset, nil
 }
 
 func (mf *memFile) Close() error {
 	if mf.closed {
 		return os.ErrClosed
 	}
-	mf.dir.children = append(mf.dir.children, &MemNode{
+	// Directories take the time their contents last changed
+	now := time.Now()
+	mf.dir.addChild(&MemNode{
 		name:    pathpkg.Base(mf.path),
-		content: mf.content.Bytes(),
-		modTime: time.Now(),
+		content: mf.content,
+		modTime: now,
 	})
+	mf.dir.modTime = now
 	mf.closed = true
+
+	if mf.replaced {
+		mf.root.notify(EventWrite, mf.path)
+	} else {
+		mf.root.notify(EventCreate, mf.path)
+	}
+	return nil
+}
+
+// Deep copies the tree, so nothing done to the clone is seen in the original.
+// Handy for building a fixture once and handing each test its own copy.
+func (mn *MemNode) Clone() *MemNode {
+	clone := &MemNode{
+		name:    mn.name,
+		isDir:   mn.isDir,
+		modTime: mn.modTime,
+	}
+	if mn.content != nil {
+		clone.content = append([]byte(nil), mn.content...)
+	}
+	if mn.children != nil {
+		clone.children = make(map[string]*MemNode, len(mn.children))
+		for name, child := range mn.children {
+			clone.children[name] = child.Clone()
+		}
+	}
+	return clone
+}
+
+// The total size of the files beneath the node, or its own size if it's a
+// file. Unlike `DiskUsage` this walks the tree directly, without going through
+// `Readdir`.
+func (mn *MemNode) TotalSize() int64 {
+	if !mn.isDir {
+		return mn.Size()
+	}
+	var size int64
+	for _, child := range mn.children {
+		size += child.TotalSize()
+	}
+	return size
+}
+
+// The number of files anywhere beneath the node
+func (mn *MemNode) FileCount() int {
+	files, _ := mn.count()
+	return files
+}
+
+// The number of directories anywhere beneath the node, not counting itself
+func (mn *MemNode) DirCount() int {
+	_, dirs := mn.count()
+	return dirs
+}
+
+func (mn *MemNode) count() (files, dirs int) {
+	for _, child := range mn.children {
+		if !child.isDir {
+			files++
+			continue
+		}
+		childFiles, childDirs := child.count()
+		files += childFiles
+		dirs += childDirs + 1
+	}
+	return files, dirs
+}
+
+// Walks the tree beneath the node in name order, calling fn with each file and
+// directory and its path relative to the node. Unlike `Walk` it reads the tree
+// directly, without a `Readdir` or `Subtree` for every directory, and hands fn
+// the node itself.
+//
+// Returning `fs.SkipDir` from fn for a directory skips its contents, and for a
+// file skips the remaining entries in its directory. Any other error stops the
+// walk and is returned, as does `ErrCycle` for a directory the walk is already
+// inside.
+func (mn *MemNode) Walk(fn func(path string, node *MemNode) error) error {
+	return mn.walk("", fn, &ancestry{id: mn})
+}
+
+func (mn *MemNode) walk(
+	dir string,
+	fn func(path string, node *MemNode) error,
+	ancestors *ancestry,
+) error {
+	names := make([]string, 0, len(mn.children))
+	for name := range mn.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := mn.children[name]
+		path := pathpkg.Join(dir, name)
+
+		if err := fn(path, child); err != nil {
+			if err != iofs.SkipDir {
+				return err
+			}
+			if child.isDir {
+				continue
+			}
+			return nil
+		}
+		if child.isDir {
+			inside, err := ancestors.enter(path, child)
+			if err != nil {
+				return err
+			}
+			if err := child.walk(path, fn, inside); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -110,6 +364,15 @@ func (*MemNode) Sys() interface{} {
 	return nil
 }
 
+// Sniffs the MIME type from the start of the file's content. Directories have
+// no type.
+func (mn *MemNode) ContentType() string {
+	if mn.isDir {
+		return ""
+	}
+	return http.DetectContentType(mn.content)
+}
+
 func (mn *MemNode) Content() ReadSeekCloser {
 	r := bytes.NewReader(mn.content)
 	return &ByteReaderCloser{r}
@@ -120,7 +383,10 @@ func (mn *MemNode) Open(path string) (ReadSeekCloser, error) {
 
 	child := mn.childByPath(path)
 	if child == nil {
-		return nil, &os.PathError{"open", path, ErrNoFile}
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrNoFile}
+	}
+	if child.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrIsDir}
 	}
 
 	return child.Content(), nil
@@ -128,6 +394,14 @@ func (mn *MemNode) Open(path string) (ReadSeekCloser, error) {
 
 func (mn *MemNode) Remove(path string) error {
 	path = pathpkg.Clean("/" + path)
+	if err := mn.remove(path); err != nil {
+		return err
+	}
+	mn.notify(EventRemove, path)
+	return nil
+}
+
+func (mn *MemNode) remove(path string) error {
 	base := pathpkg.Base(path)
 	dir := mn.parentNode(path)
 
@@ -139,57 +413,62 @@ func (mn *MemNode) Remove(path string) error {
 		}
 	}
 
-	var children []*MemNode
-	for _, child := range dir.children {
-		if child.name != base {
-			children = append(children, child)
-		}
-	}
-
-	// If we end up with the same number of children, this file doesn't exist to
-	// remove
-	if len(children) == len(dir.children) {
+	if _, ok := dir.children[base]; !ok {
 		return &os.PathError{Op: "remove", Path: path, Err: ErrNoFile}
 	}
 
-	dir.children = children
+	delete(dir.children, base)
 	return nil
 }
 
+// Creates a file, creating any missing parent directories along the way
 func (mn *MemNode) Create(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
 	path = pathpkg.Clean("/" + path)
 	parent := pathpkg.Dir(path)
-	dir := mn.childByPath(parent)
+	dir := mn.mkdirAll(parent)
 
-	if dir == nil || !dir.isDir {
+	if dir == nil {
 		return nil, &os.PathError{
 			Op:   "create",
 			Path: path,
-			Err:  fmt.Errorf("No parent directory %s", parent),
+			Err:  fmt.Errorf("Parent %s is not a directory", parent),
 		}
 	}
 
+	if existing := dir.children[pathpkg.Base(path)]; existing != nil && existing.isDir {
+		return nil, &os.PathError{Op: "create", Path: path, Err: ErrIsDir}
+	}
+
 	// Remove any existing file with the same name
-	if err := mn.Remove(path); err != nil {
+	replaced := true
+	if err := mn.remove(path); err != nil {
 		// If the error is just that the file doesnt exist, ignore it
 		if pe, ok := err.(*os.PathError); !ok || pe.Err != ErrNoFile {
 			return nil, err
 		}
+		replaced = false
 	}
 
 	return &memFile{
-		path: pathpkg.Base(path),
-		dir:  dir,
+		root:     mn,
+		path:     path,
+		dir:      dir,
+		replaced: replaced,
 	}, nil
 }
 
+// Writes source to a file with Create, so missing parent directories are made
+// like they are for S3
 func (mn *MemNode) Copy(destPath string, source io.Reader) error {
 	dest, err := mn.Create(destPath)
 	if err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(dest, source); err != nil {
+	if _, err := copyBuffer(dest, source); err != nil {
 		return err
 	}
 
@@ -197,25 +476,33 @@ func (mn *MemNode) Copy(destPath string, source io.Reader) error {
 }
 
 func (mn *MemNode) Move(srcPath, destPath string) error {
+	srcPath = pathpkg.Clean("/" + srcPath)
+	destPath = pathpkg.Clean("/" + destPath)
 	src := mn.parentNode(srcPath)
 	dest := mn.parentNode(destPath)
 
-	var file *MemNode
-	var fileIndex int
-	for i, c := range src.children {
-		if c.name == pathpkg.Base(srcPath) {
-			file = c
-			fileIndex = i
-			break
+	if src == nil || !src.isDir {
+		return &os.PathError{Op: "move", Path: srcPath, Err: ErrNoFile}
+	}
+	if dest == nil || !dest.isDir {
+		return &os.PathError{
+			Op:   "move",
+			Path: destPath,
+			Err:  fmt.Errorf("No parent directory for %s", destPath),
 		}
 	}
+
+	file := src.childByName(pathpkg.Base(srcPath))
 	if file == nil {
 		return &os.PathError{Op: "move", Path: srcPath, Err: ErrNoFile}
 	}
 
-	src.children = append(src.children[:fileIndex], src.children[fileIndex+1:]...)
-	dest.children = append(dest.children, file)
+	delete(src.children, file.name)
+	file.name = pathpkg.Base(destPath)
+	dest.addChild(file)
 
+	mn.notify(EventRename, srcPath)
+	mn.notify(EventCreate, destPath)
 	return nil
 }
 
@@ -224,26 +511,47 @@ func (mn *MemNode) Stat(path string) (os.FileInfo, error) {
 	child := mn.childByPath(path)
 
 	if child == nil {
-		return nil, &os.PathError{"stat", path, ErrNoFile}
+		return nil, &os.PathError{Op: "stat", Path: path, Err: ErrNoFile}
 	}
 	return child, nil
 }
 
 func (mn *MemNode) Readdir(path string) ([]os.FileInfo, error) {
+	children, err := mn.ReaddirUnsorted(path)
+	if err != nil {
+		return nil, err
+	}
+	sortFileInfos(children)
+	return children, nil
+}
+
+// Lists a directory in the random order of the map its children are kept in
+func (mn *MemNode) ReaddirUnsorted(path string) ([]os.FileInfo, error) {
 	node := mn.childByPath(path)
 	if node == nil {
-		return nil, &os.PathError{"open", path, ErrNoFile}
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrNoFile}
 	}
-	children := make([]os.FileInfo, len(node.children))
-	for i, child := range node.children {
-		children[i] = child
+	children := make([]os.FileInfo, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
 	}
-
-	sortFileInfos(children)
 	return children, nil
 }
 
+// Sets the modTime of a path. Memory has no access times, so atime is ignored.
+func (mn *MemNode) Chtimes(path string, atime, mtime time.Time) error {
+	path = pathpkg.Clean("/" + path)
+	child := mn.childByPath(path)
+
+	if child == nil {
+		return &os.PathError{Op: "chtimes", Path: path, Err: ErrNoFile}
+	}
+	child.modTime = mtime
+	return nil
+}
+
 func (mn *MemNode) Mkdir(path string) error {
+	path = pathpkg.Clean("/" + path)
 	name := pathpkg.Base(path)
 	dir := mn.parentNode(path)
 
@@ -255,20 +563,79 @@ func (mn *MemNode) Mkdir(path string) error {
 		}
 	}
 
-	dir.children = append(dir.children, Dir(name))
+	if dir.childByName(name) != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrExist}
+	}
+
+	dir.addChild(Dir(name))
+	mn.notify(EventCreate, path)
 	return nil
 }
 
-func (mn *MemNode) childByName(name string) *MemNode {
-	for _, child := range mn.children {
-		if child.name == name {
-			return child
-		}
+// Adds everything in dir of another `FileSystem` as children of this node
+func (mn *MemNode) load(fs FileSystem, dir string) error {
+	infos, err := fs.Readdir(dir)
+	if err != nil {
+		return err
 	}
 
+	for _, info := range infos {
+		path := pathpkg.Join(dir, info.Name())
+
+		switch {
+		case info.IsDir():
+			child := Dir(info.Name())
+			child.modTime = info.ModTime()
+			if err := child.load(fs, path); err != nil {
+				return err
+			}
+			mn.addChild(child)
+
+		case info.Mode().IsRegular():
+			content, err := ReadFile(fs, path)
+			if err != nil {
+				return err
+			}
+			mn.addChild(FileWithModTime(info.Name(), content, info.ModTime()))
+		}
+	}
 	return nil
 }
 
+// Finds the directory at path, creating any directories missing on the way.
+// Returns nil if a file is in the way.
+func (mn *MemNode) mkdirAll(path string) *MemNode {
+	clean := pathpkg.Clean("/" + path)[1:]
+	dir := mn
+	for _, name := range strings.Split(clean, "/") {
+		if name == "" {
+			continue
+		}
+		child := dir.childByName(name)
+		if child == nil {
+			child = Dir(name)
+			dir.addChild(child)
+		}
+		if !child.isDir {
+			return nil
+		}
+		dir = child
+	}
+	return dir
+}
+
+// Adds a child to this directory, replacing any child with the same name
+func (mn *MemNode) addChild(child *MemNode) {
+	if mn.children == nil {
+		mn.children = make(map[string]*MemNode)
+	}
+	mn.children[child.name] = child
+}
+
+func (mn *MemNode) childByName(name string) *MemNode {
+	return mn.children[name]
+}
+
 func (mn *MemNode) childByPath(path string) *MemNode {
 	clean := pathpkg.Clean("/" + path)[1:]
 	return mn.child(strings.Split(clean, "/"))
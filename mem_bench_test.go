@@ -0,0 +1,59 @@
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Four levels of five directories, each holding five files
+func nestedFS() FileSystem {
+	var level func(depth int) []*MemNode
+	level = func(depth int) []*MemNode {
+		var nodes []*MemNode
+		for i := 0; i < 5; i++ {
+			nodes = append(nodes, File(fmt.Sprintf("file%d.txt", i), []byte("hi")))
+			if depth < 4 {
+				nodes = append(nodes, Dir(fmt.Sprintf("dir%d", i), level(depth+1)...))
+			}
+		}
+		return nodes
+	}
+	return Mem(level(1)...)
+}
+
+func BenchmarkChildByPath(b *testing.B) {
+	root := largeDirFS().(*MemNode)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.childByPath("/large_directory/1100")
+	}
+}
+
+func BenchmarkStat(b *testing.B) {
+	fs := largeDirFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs.Stat("/large_directory/0550")
+	}
+}
+
+func BenchmarkWalkNested(b *testing.B) {
+	fs := nestedFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Walk(fs, func(path string, info os.FileInfo, err error) error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkMemNodeWalkNested(b *testing.B) {
+	root := nestedFS().(*MemNode)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.Walk(func(path string, node *MemNode) error {
+			return nil
+		})
+	}
+}
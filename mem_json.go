@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// The JSON form of a `MemNode`. File content is base64 encoded, as
+// encoding/json does for any []byte.
+type memNodeJSON struct {
+	Name     string         `json:"name"`
+	Dir      bool           `json:"dir,omitempty"`
+	ModTime  time.Time      `json:"modTime"`
+	Content  []byte         `json:"content,omitempty"`
+	Children []*memNodeJSON `json:"children,omitempty"`
+}
+
+// Encodes the whole tree beneath this node, so it can be restored with
+// `MemUnmarshalJSON`. Children are sorted by name, so the same tree always
+// encodes the same way.
+func (mn *MemNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mn.toJSON())
+}
+
+// Restores a tree encoded by `MemNode.MarshalJSON`
+func MemUnmarshalJSON(data []byte) (*MemNode, error) {
+	var node memNodeJSON
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	return node.toMemNode(), nil
+}
+
+func (mn *MemNode) toJSON() *memNodeJSON {
+	node := &memNodeJSON{
+		Name:    mn.name,
+		Dir:     mn.isDir,
+		ModTime: mn.modTime,
+		Content: mn.content,
+	}
+	for _, child := range mn.children {
+		node.Children = append(node.Children, child.toJSON())
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	return node
+}
+
+func (node *memNodeJSON) toMemNode() *MemNode {
+	if !node.Dir {
+		return FileWithModTime(node.Name, node.Content, node.ModTime)
+	}
+
+	dir := Dir(node.Name)
+	for _, child := range node.Children {
+		dir.addChild(child.toMemNode())
+	}
+	dir.modTime = node.ModTime
+	return dir
+}
@@ -0,0 +1,102 @@
+package vfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mem JSON", func() {
+	var root *MemNode
+
+	BeforeEach(func() {
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+		root = Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				FileWithModTime("child.txt", []byte("hi, child"), mtime),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+			File("binary", []byte{0, 1, 2, 0xfe, 0xff}),
+			File("empty.txt", []byte{}),
+		).(*MemNode)
+	})
+
+	type entry struct {
+		dir     bool
+		content string
+		modTime time.Time
+	}
+
+	walked := func(fs FileSystem) map[string]entry {
+		entries := map[string]entry{}
+		Walk(fs, func(path string, info os.FileInfo, err error) error {
+			e := entry{dir: info.IsDir(), modTime: info.ModTime().UTC()}
+			if !info.IsDir() {
+				r, err := fs.Open(path)
+				Expect(err).ToNot(HaveOccurred())
+				bs, _ := ioutil.ReadAll(r)
+				e.content = string(bs)
+			}
+			entries[path] = e
+			return nil
+		})
+		return entries
+	}
+
+	It("should round-trip a tree", func() {
+		data, err := json.Marshal(root)
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, err := MemUnmarshalJSON(data)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(walked(restored)).To(Equal(walked(root)))
+		Expect(restored.ModTime().Equal(root.ModTime())).To(BeTrue())
+	})
+
+	It("should keep content bytes exactly", func() {
+		data, err := json.Marshal(root)
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, err := MemUnmarshalJSON(data)
+		Expect(err).ToNot(HaveOccurred())
+
+		r, err := restored.Open("/binary")
+		Expect(err).ToNot(HaveOccurred())
+		bs, _ := ioutil.ReadAll(r)
+		Expect(bs).To(Equal([]byte{0, 1, 2, 0xfe, 0xff}))
+	})
+
+	It("should encode the same tree the same way", func() {
+		first, err := json.Marshal(root)
+		Expect(err).ToNot(HaveOccurred())
+		second, err := json.Marshal(root.Clone())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second).To(Equal(first))
+	})
+
+	It("should encode a file", func() {
+		child := FileWithModTime("child.txt", []byte("hi"),
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+		data, err := json.Marshal(child)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(MatchJSON(`{
+			"name": "child.txt",
+			"modTime": "2020-01-02T03:04:05Z",
+			"content": "aGk="
+		}`))
+	})
+
+	It("should fail on bad JSON", func() {
+		_, err := MemUnmarshalJSON([]byte("{"))
+		Expect(err).To(HaveOccurred())
+	})
+
+})
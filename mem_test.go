@@ -0,0 +1,690 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mem", func() {
+
+	Describe("Create", func() {
+
+		It("should take io.Copy's fast paths into and out of files", func() {
+			fs := Mem()
+			content := strings.Repeat("hi, mem ", 10000)
+
+			w, err := fs.Create("/copied.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := w.(io.ReaderFrom)
+			Expect(ok).To(BeTrue())
+			// Hiding the source's WriteTo leaves io.Copy the writer's ReadFrom
+			n, err := io.Copy(w, struct{ io.Reader }{strings.NewReader(content)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(len(content)))
+			Expect(w.Close()).To(Succeed())
+
+			r, err := fs.Open("/copied.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok = r.(io.WriterTo)
+			Expect(ok).To(BeTrue())
+			var out strings.Builder
+			Expect(io.Copy(&out, r)).To(BeEquivalentTo(len(content)))
+			Expect(out.String()).To(Equal(content))
+		})
+
+		It("should advance the directory's modTime when a file is created", func() {
+			dir := Dir("directory")
+			dir.modTime = time.Now().Add(-time.Hour)
+			before := dir.ModTime()
+			fs := Mem(dir)
+
+			w, err := fs.Create("/directory/child.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir.ModTime()).To(Equal(before))
+
+			Expect(w.Close()).To(Succeed())
+			Expect(dir.ModTime()).To(BeTemporally(">", before))
+
+			child, err := fs.Stat("/directory/child.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dir.ModTime()).To(Equal(child.ModTime()))
+		})
+
+		It("should create a zero-length file when nothing is written", func() {
+			fs := Mem()
+
+			w, err := fs.Create("/empty.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			info, err := fs.Stat("/empty.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Size()).To(Equal(int64(0)))
+
+			r, err := fs.Open("/empty.txt")
+			Expect(err).ToNot(HaveOccurred())
+			bs, err := ioutil.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bs).To(BeEmpty())
+		})
+
+		It("should zero-fill a gap written past the end", func() {
+			fs := Mem()
+
+			w, err := fs.Create("/records")
+			Expect(err).ToNot(HaveOccurred())
+			ws := w.(io.WriteSeeker)
+
+			_, err = ws.Seek(10, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ws.Write([]byte("hi"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			r, _ := fs.Open("/records")
+			bs, _ := ioutil.ReadAll(r)
+			Expect(bs).To(Equal(append(make([]byte, 10), "hi"...)))
+		})
+
+		It("should write at offsets and read back before Close", func() {
+			fs := Mem()
+
+			w, err := fs.Create("/records")
+			Expect(err).ToNot(HaveOccurred())
+			f := w.(interface {
+				io.ReadWriteSeeker
+				io.WriterAt
+			})
+
+			_, err = f.Write([]byte("aaaaaaaa"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = f.WriteAt([]byte("bb"), 2)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = f.Seek(-2, io.SeekEnd)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = f.Write([]byte("ccc"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = f.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			bs, err := ioutil.ReadAll(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(bs)).To(Equal("aabbaaccc"))
+
+			_, err = fs.Stat("/records")
+			Expect(err).To(HaveOccurred())
+
+			Expect(w.Close()).To(Succeed())
+			r, _ := fs.Open("/records")
+			bs, _ = ioutil.ReadAll(r)
+			Expect(string(bs)).To(Equal("aabbaaccc"))
+		})
+
+		It("should not seek before the start", func() {
+			w, _ := Mem().Create("/records")
+			_, err := w.(io.Seeker).Seek(-1, io.SeekStart)
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
+
+	Describe("Copy", func() {
+
+		It("should make missing parent directories", func() {
+			fs := Mem()
+			Expect(fs.Copy("/a/b/c.txt", strings.NewReader("hi, c"))).To(Succeed())
+
+			Expect(ReadString(fs, "/a/b/c.txt")).To(Equal("hi, c"))
+			for _, dir := range []string{"/a", "/a/b"} {
+				info, err := fs.Stat(dir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.IsDir()).To(BeTrue())
+			}
+		})
+
+		It("should make missing parent directories for CopyAll", func() {
+			src := Mem(File("c.txt", []byte("hi, c")))
+			dst := Mem()
+
+			Expect(CopyAll(dst, "/a/b/c.txt", src, "/c.txt")).To(Succeed())
+			Expect(ReadString(dst, "/a/b/c.txt")).To(Equal("hi, c"))
+		})
+
+		It("should not make directories beneath a file", func() {
+			fs := Mem(File("a", []byte("file")))
+			Expect(fs.Copy("/a/b/c.txt", strings.NewReader("hi, c"))).ToNot(Succeed())
+			Expect(ReadString(fs, "/a")).To(Equal("file"))
+		})
+
+	})
+
+	Describe("Move", func() {
+		var fs FileSystem
+
+		BeforeEach(func() {
+			fs = Mem(
+				Dir("directory",
+					File("child.txt", []byte("hi, child")),
+				),
+			)
+		})
+
+		It("should not move into a missing directory", func() {
+			err := fs.Move("/directory/child.txt", "/missing/child.txt")
+			Expect(err).To(HaveOccurred())
+
+			switch t := err.(type) {
+			default:
+				Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
+			case *os.PathError:
+				Expect(t.Op).To(Equal("move"))
+				Expect(t.Path).To(Equal("/missing/child.txt"))
+			}
+
+			_, err = fs.Stat("/directory/child.txt")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should not move from a missing directory", func() {
+			err := fs.Move("/missing/child.txt", "/directory/child2.txt")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "move",
+				Path: "/missing/child.txt",
+				Err:  ErrNoFile,
+			}))
+		})
+
+		It("should rename the file to the destination name", func() {
+			Expect(fs.Move("directory/child.txt", "renamed.txt")).To(Succeed())
+
+			info, err := fs.Stat("/renamed.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Name()).To(Equal("renamed.txt"))
+		})
+
+	})
+
+	Describe("Clone", func() {
+
+		It("should not share anything with the original", func() {
+			content := []byte("hi, child")
+			orig := Mem(
+				Dir("directory",
+					Dir("sub_directory"),
+					File("child.txt", content),
+				),
+				File("root.txt", []byte("hi, root")),
+			).(*MemNode)
+			clone := orig.Clone()
+
+			Expect(clone.Remove("/root.txt")).To(Succeed())
+			Expect(clone.Mkdir("/directory/sub_directory/new")).To(Succeed())
+			Expect(clone.Move("/directory/child.txt", "/child.txt")).To(Succeed())
+			node, _ := clone.Stat("/child.txt")
+			node.(*MemNode).content[0] = 'H'
+
+			infos, _ := orig.Readdir("/")
+			Expect(infos).To(HaveLen(2))
+			infos, _ = orig.Readdir("/directory")
+			Expect(infos).To(HaveLen(2))
+			infos, _ = orig.Readdir("/directory/sub_directory")
+			Expect(infos).To(BeEmpty())
+			Expect(string(content)).To(Equal("hi, child"))
+		})
+
+		It("should keep names, contents and modTimes", func() {
+			mtime := time.Now().Add(-time.Hour)
+			clone := Mem(
+				FileWithModTime("root.txt", []byte("hi, root"), mtime),
+			).(*MemNode).Clone()
+
+			info, err := clone.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Name()).To(Equal("root.txt"))
+			Expect(info.ModTime()).To(Equal(mtime))
+
+			r, _ := clone.Open("/root.txt")
+			bs, _ := ioutil.ReadAll(r)
+			Expect(string(bs)).To(Equal("hi, root"))
+		})
+
+	})
+
+	Describe("Walk", func() {
+		var root *MemNode
+
+		BeforeEach(func() {
+			root = Mem(
+				Dir("directory",
+					Dir("sub_directory",
+						File("deep.txt", []byte("deep")),
+					),
+					File("child.txt", []byte("hi, child")),
+				),
+				Dir("empty_directory"),
+				File("root.txt", []byte("hi, root")),
+			).(*MemNode)
+		})
+
+		It("should visit every node in name order", func() {
+			var paths []string
+			err := root.Walk(func(path string, node *MemNode) error {
+				paths = append(paths, path)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths).To(Equal([]string{
+				"directory",
+				"directory/child.txt",
+				"directory/sub_directory",
+				"directory/sub_directory/deep.txt",
+				"empty_directory",
+				"root.txt",
+			}))
+		})
+
+		It("should hand over the nodes themselves", func() {
+			contents := map[string]string{}
+			root.Walk(func(path string, node *MemNode) error {
+				if !node.IsDir() {
+					bs, _ := ioutil.ReadAll(node.Content())
+					contents[path] = string(bs)
+				}
+				return nil
+			})
+			Expect(contents).To(Equal(map[string]string{
+				"directory/child.txt":              "hi, child",
+				"directory/sub_directory/deep.txt": "deep",
+				"root.txt":                         "hi, root",
+			}))
+		})
+
+		It("should skip the contents of a directory with SkipDir", func() {
+			var paths []string
+			root.Walk(func(path string, node *MemNode) error {
+				paths = append(paths, path)
+				if path == "directory/sub_directory" {
+					return iofs.SkipDir
+				}
+				return nil
+			})
+			Expect(paths).To(Equal([]string{
+				"directory",
+				"directory/child.txt",
+				"directory/sub_directory",
+				"empty_directory",
+				"root.txt",
+			}))
+		})
+
+		It("should skip the rest of a file's directory with SkipDir", func() {
+			var paths []string
+			root.Walk(func(path string, node *MemNode) error {
+				paths = append(paths, path)
+				if path == "directory/child.txt" {
+					return iofs.SkipDir
+				}
+				return nil
+			})
+			Expect(paths).To(Equal([]string{
+				"directory",
+				"directory/child.txt",
+				"empty_directory",
+				"root.txt",
+			}))
+		})
+
+		It("should stop at any other error", func() {
+			stop := errors.New("stop")
+			var paths []string
+			err := root.Walk(func(path string, node *MemNode) error {
+				paths = append(paths, path)
+				if path == "directory/child.txt" {
+					return stop
+				}
+				return nil
+			})
+			Expect(err).To(Equal(stop))
+			Expect(paths).To(HaveLen(2))
+		})
+
+		It("should return ErrCycle for a directory inside itself", func() {
+			var paths []string
+			err := cyclicMem().Walk(func(path string, node *MemNode) error {
+				paths = append(paths, path)
+				return nil
+			})
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "walk",
+				Path: "/parent/root",
+				Err:  ErrCycle,
+			}))
+			Expect(paths).To(Equal([]string{"parent", "parent/root"}))
+		})
+
+	})
+
+	Describe("MemFromDir", func() {
+		var root string
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "vfs-mem")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(root, "directory", "sub_directory"), 0755)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(root, "empty_directory"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(root, "root.txt"), []byte("hi, root"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(root, "directory", "child.txt"), []byte("hi, child"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		walked := func(fs FileSystem) map[string]string {
+			entries := map[string]string{}
+			err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+				if info.IsDir() {
+					entries[path] = "dir"
+					return nil
+				}
+				r, err := fs.Open(path)
+				Expect(err).ToNot(HaveOccurred())
+				bs, _ := ioutil.ReadAll(r)
+				r.Close()
+				entries[path] = string(bs)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return entries
+		}
+
+		It("should load the same tree as on disk", func() {
+			osFS, err := OS(root)
+			Expect(err).ToNot(HaveOccurred())
+
+			memFS, err := MemFromDir(root)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(walked(memFS)).To(Equal(walked(osFS)))
+			Expect(walked(memFS)).To(HaveKeyWithValue("directory/child.txt", "hi, child"))
+		})
+
+		It("should keep modTimes", func() {
+			mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+			Expect(os.Chtimes(filepath.Join(root, "root.txt"), mtime, mtime)).To(Succeed())
+
+			memFS, err := MemFromDir(root)
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := memFS.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.ModTime().Equal(mtime)).To(BeTrue())
+		})
+
+		It("should skip symlinks", func() {
+			Expect(os.Symlink("/etc/passwd", filepath.Join(root, "link"))).To(Succeed())
+
+			memFS, err := MemFromDir(root)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = memFS.Stat("/link")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on a missing directory", func() {
+			_, err := MemFromDir(filepath.Join(root, "missing"))
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
+
+	Describe("ContentType", func() {
+
+		It("should sniff the type of a file", func() {
+			fs := Mem(
+				File("page", []byte("<html><body>hi</body></html>")),
+				File("root.txt", []byte("hi, root")),
+				Dir("directory"),
+			)
+
+			info, _ := fs.Stat("/page")
+			Expect(ContentType(info)).To(Equal("text/html; charset=utf-8"))
+
+			info, _ = fs.Stat("/root.txt")
+			Expect(ContentType(info)).To(Equal("text/plain; charset=utf-8"))
+
+			info, _ = fs.Stat("/directory")
+			Expect(ContentType(info)).To(Equal(""))
+		})
+	})
+
+	Describe("MemFromMap", func() {
+
+		type entry struct {
+			dir     bool
+			content string
+		}
+
+		walked := func(fs FileSystem) map[string]entry {
+			entries := map[string]entry{}
+			Walk(fs, func(path string, info os.FileInfo, err error) error {
+				e := entry{dir: info.IsDir()}
+				if !info.IsDir() {
+					r, err := fs.Open(path)
+					Expect(err).ToNot(HaveOccurred())
+					bs, _ := ioutil.ReadAll(r)
+					e.content = string(bs)
+				}
+				entries[path] = e
+				return nil
+			})
+			return entries
+		}
+
+		It("should build the tree implied by the paths", func() {
+			fs := MemFromMap(map[string][]byte{
+				"directory/sub_directory/": nil,
+				"directory/child.txt":      []byte("hi, child"),
+				"empty_directory/":         nil,
+				"root.txt":                 []byte("hi, root"),
+			})
+
+			expected := Mem(
+				Dir("directory",
+					Dir("sub_directory"),
+					File("child.txt", []byte("hi, child")),
+				),
+				Dir("empty_directory"),
+				File("root.txt", []byte("hi, root")),
+			)
+			Expect(walked(fs)).To(Equal(walked(expected)))
+		})
+
+		It("should accept leading slashes", func() {
+			fs := MemFromMap(map[string][]byte{"/a/b.txt": []byte("b")})
+
+			info, err := fs.Stat("/a/b.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Size()).To(Equal(int64(1)))
+		})
+
+		It("should panic when a path is beneath a file", func() {
+			Expect(func() {
+				MemFromMap(map[string][]byte{
+					"a":     []byte("a"),
+					"a/b":   []byte("b"),
+					"c.txt": []byte("c"),
+				})
+			}).To(Panic())
+		})
+
+	})
+
+	Describe("Locker", func() {
+		var locker Locker
+
+		BeforeEach(func() {
+			locker = Mem().(Locker)
+		})
+
+		It("should not TryLock a held lock", func() {
+			unlocker, err := locker.Lock("/lock")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok, err := locker.TryLock("lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			Expect(unlocker.Unlock()).To(Succeed())
+			Expect(unlocker.Unlock()).To(MatchError(os.ErrClosed))
+
+			second, ok, err := locker.TryLock("/lock")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(second.Close()).To(Succeed())
+		})
+
+		It("should lock paths separately", func() {
+			first, err := locker.Lock("/a")
+			Expect(err).ToNot(HaveOccurred())
+			defer first.Close()
+
+			second, ok, err := locker.TryLock("/b")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			second.Close()
+		})
+
+		It("should not share locks between filesystems", func() {
+			first, err := locker.Lock("/a")
+			Expect(err).ToNot(HaveOccurred())
+			defer first.Close()
+
+			_, ok, err := Mem().(Locker).TryLock("/a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should forget a lock once nothing holds it", func() {
+			first, err := locker.Lock("/a")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok, err := locker.TryLock("/a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(locker.(*MemNode).locks).To(HaveLen(1))
+
+			Expect(first.Unlock()).To(Succeed())
+			Expect(locker.(*MemNode).locks).To(BeEmpty())
+		})
+
+	})
+
+	Describe("Watch", func() {
+		var fs FileSystem
+		var events <-chan Event
+		var cancel func() error
+
+		BeforeEach(func() {
+			fs = Mem(Dir("directory", File("old.txt", []byte("old"))))
+
+			var err error
+			events, cancel, err = fs.(Watcher).Watch("/directory")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should report a created file once it's closed", func() {
+			w, err := fs.Create("/directory/new.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).ToNot(Receive())
+
+			Expect(w.Close()).To(Succeed())
+			Expect(events).To(Receive(Equal(Event{
+				Op:   EventCreate,
+				Path: "/directory/new.txt",
+			})))
+		})
+
+		It("should report writes, moves, removes and mkdirs", func() {
+			Expect(fs.Copy("/directory/old.txt", strings.NewReader("new"))).To(Succeed())
+			Expect(fs.Move("/directory/old.txt", "/directory/moved.txt")).To(Succeed())
+			Expect(fs.Remove("/directory/moved.txt")).To(Succeed())
+			Expect(fs.Mkdir("/directory/sub")).To(Succeed())
+
+			var received []Event
+			for len(events) > 0 {
+				received = append(received, <-events)
+			}
+			Expect(received).To(Equal([]Event{
+				{EventWrite, "/directory/old.txt"},
+				{EventRename, "/directory/old.txt"},
+				{EventCreate, "/directory/moved.txt"},
+				{EventRemove, "/directory/moved.txt"},
+				{EventCreate, "/directory/sub"},
+			}))
+		})
+
+		It("should not report changes outside the path", func() {
+			Expect(fs.Copy("/elsewhere.txt", strings.NewReader("hi"))).To(Succeed())
+			Expect(fs.Copy("/directory/sub/deep.txt", strings.NewReader("hi"))).To(Succeed())
+			Expect(Mem().Mkdir("/directory")).To(Succeed())
+			Expect(events).ToNot(Receive())
+		})
+
+		It("should strip a Subtree's root from paths", func() {
+			tree, err := Subtree(fs, "/directory")
+			Expect(err).ToNot(HaveOccurred())
+			treeEvents, treeCancel, err := tree.(Watcher).Watch("/")
+			Expect(err).ToNot(HaveOccurred())
+			defer treeCancel()
+
+			Expect(tree.Copy("/new.txt", strings.NewReader("hi"))).To(Succeed())
+			Eventually(treeEvents).Should(Receive(Equal(Event{
+				Op:   EventCreate,
+				Path: "/new.txt",
+			})))
+		})
+
+		It("should drop events rather than block when they aren't read", func() {
+			for i := 0; i < memWatchBuffer*2; i++ {
+				Expect(fs.Copy("/directory/old.txt", strings.NewReader("new"))).To(Succeed())
+			}
+			Expect(events).To(HaveLen(memWatchBuffer))
+
+			Expect(Mem().Mkdir("/elsewhere")).To(Succeed())
+		})
+
+		It("should close the events when cancelled", func() {
+			Expect(cancel()).To(Succeed())
+			Expect(events).To(BeClosed())
+			Expect(cancel()).To(MatchError(os.ErrClosed))
+		})
+
+		It("should return ErrNoFile for a missing path", func() {
+			_, _, err := fs.(Watcher).Watch("/missing")
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "watch",
+				Path: "/missing",
+				Err:  ErrNoFile,
+			}))
+		})
+
+	})
+
+})
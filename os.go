@@ -1,23 +1,92 @@
 package vfs
 
 import (
-	"fmt"
 	"io"
-	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-type osFS struct{}
+type osFS struct {
+	sniff     bool
+	durable   bool
+	secure    bool
+	jail      string // the real path of the root, when it's secure
+	normalize bool
+	form      norm.Form
+	base      string // the root, beneath which names are normalized
+}
 
 var rootFs osFS
 
 // Creates a `FileSystem` backed by files on disk. This implementation is based
 // almost entirely off the work done by the Go team:
 // https://github.com/golang/tools/blob/master/godoc/vfs/os.go
-func OS(root string) (FileSystem, error) {
-	return Subtree(rootFs, root)
+func OS(root string, opts ...func(*osFS)) (FileSystem, error) {
+	fs := rootFs
+	for _, opt := range opts {
+		opt(&fs)
+	}
+	fs.base = pathpkg.Clean("/" + filepath.ToSlash(root))
+	if fs.secure {
+		jail, err := realPath(root)
+		if err != nil {
+			return nil, err
+		}
+		fs.jail = jail
+	}
+	return Subtree(fs, root)
+}
+
+// Keeps every path inside the root, even through symlinks. Each path is
+// resolved with `filepath.EvalSymlinks` before it's used, and one which ends
+// up outside the root fails with `os.ErrPermission`. Set it when paths come
+// from users. Another process could still swap a directory for a symlink
+// between the check and its use.
+func SecureRoot(secure bool) func(*osFS) {
+	return func(fs *osFS) {
+		fs.secure = secure
+	}
+}
+
+// Makes files survive a crash once they're written. Closing a writer from
+// Create or Copy fsyncs the file, then the directory it's in, since on POSIX
+// systems a new file's directory entry is only durable once its directory has
+// been synced too. Move syncs the directories it renames between, which is
+// what makes `CreateAtomic` durable. fsync is slow, so it's off by default.
+func Durable(durable bool) func(*osFS) {
+	return func(fs *osFS) {
+		fs.durable = durable
+	}
+}
+
+// Makes the `os.FileInfo`s from Stat and Readdir `ContentTyped`, with the type
+// `http.DetectContentType` sniffs from the first 512 bytes of the file rather
+// than one guessed from its extension. Every file stated or listed is read, so
+// it's off by default. Directories, and files which can't be read, have no
+// type.
+func SniffContentType(sniff bool) func(*osFS) {
+	return func(fs *osFS) {
+		fs.sniff = sniff
+	}
+}
+
+// Matches paths to files beneath the root whose names are spelled with a
+// different Unicode normalization, and returns names from Stat and Readdir
+// normalized to form, the way `UnicodeNormalized` does. Files created from then
+// on are named in form. Set it to read trees written on macOS, which names
+// files in NFD, with the NFC names most other systems use.
+func NormalizeUnicode(form norm.Form) func(*osFS) {
+	return func(fs *osFS) {
+		fs.normalize = true
+		fs.form = form
+	}
 }
 
 func (root osFS) URL() *url.URL {
@@ -27,13 +96,114 @@ func (root osFS) URL() *url.URL {
 	}
 }
 
-func (root osFS) resolve(path string) string {
-	// Ensure all paths are fully-qualified from the root of the FS
-	return pathpkg.Clean("/" + path)
+// Ensure all paths are fully-qualified from the root of the FS, and when the
+// root is secure, that they don't leave it
+func (root osFS) resolve(op, path string) (string, error) {
+	path = pathpkg.Clean("/" + path)
+	if root.normalize {
+		var err error
+		path, err = root.resolveNormalized(op, path)
+		if err != nil {
+			return "", err
+		}
+	}
+	if root.jail == "" {
+		return path, nil
+	}
+
+	real, err := realPath(path)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: path, Err: err}
+	}
+	if real != root.jail && !strings.HasPrefix(real, root.jail+string(filepath.Separator)) {
+		return "", &os.PathError{Op: op, Path: path, Err: os.ErrPermission}
+	}
+	return path, nil
+}
+
+// Matches the part of path beneath the root to names spelled with a different
+// normalization. The root itself, and the directories above it, are taken as
+// they are.
+func (root osFS) resolveNormalized(op, path string) (string, error) {
+	rel := path
+	switch {
+	case root.base == "/":
+	case path == root.base:
+		return path, nil
+	case strings.HasPrefix(path, root.base+"/"):
+		rel = path[len(root.base):]
+	default:
+		return path, nil
+	}
+
+	exists := func(rel string) bool {
+		return osExists(pathpkg.Join(root.base, rel))
+	}
+	readdirnames := func(dir string) ([]string, error) {
+		return osReaddirnames(pathpkg.Join(root.base, dir))
+	}
+	rel, err := resolveNormalized(op, rel, root.form, exists, readdirnames)
+	if err != nil {
+		if pe, ok := err.(*os.PathError); ok {
+			pe.Path = path
+		}
+		return "", err
+	}
+	return pathpkg.Join(root.base, rel), nil
+}
+
+// The absolute path with every symlink in it resolved. Of a path which doesn't
+// exist yet, the part which does is resolved. A dangling symlink is an
+// `os.ErrPermission`, since it could point anywhere once its target is made.
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := ""
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(real, missing), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", os.ErrPermission
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, missing), nil
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
+
+func osExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func osReaddirnames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
 }
 
+// Opens the file itself, returning its `*os.File`, which is an `Fder`
 func (root osFS) Open(path string) (ReadSeekCloser, error) {
-	f, err := os.Open(root.resolve(path))
+	path, err := root.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, noFileErr(err.(*os.PathError))
@@ -47,25 +217,81 @@ func (root osFS) Open(path string) (ReadSeekCloser, error) {
 	}
 	if fi.IsDir() {
 		f.Close()
-		return nil, fmt.Errorf("Open: %s is a directory", path)
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrIsDir}
 	}
 	return f, nil
 }
 
 func (root osFS) Remove(path string) error {
-	err := os.Remove(root.resolve(path))
+	path, err := root.resolve("remove", path)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
 	if os.IsNotExist(err) {
 		return noFileErr(err.(*os.PathError))
 	}
 	return err
 }
 
+// Creates a file, creating any missing parent directories along the way
 func (root osFS) Create(path string) (io.WriteCloser, error) {
-	file, err := os.Create(root.resolve(path))
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path, err := root.resolve("create", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(pathpkg.Dir(path), 0755); err != nil {
+		if e, ok := err.(*os.PathError); ok {
+			e.Op = "create"
+		}
+		return nil, err
+	}
+
+	file, err := os.Create(path)
 	if e, ok := err.(*os.PathError); ok {
+		if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+			return nil, &os.PathError{Op: "create", Path: path, Err: ErrIsDir}
+		}
 		e.Op = "create"
 		return nil, e
 	}
+	if root.durable {
+		return &durableFile{file: file, dir: pathpkg.Dir(path)}, nil
+	}
+	return file, nil
+}
+
+// Creates a file with O_EXCL, so it fails with `ErrExist` if anything is at
+// path, even when another process creates it at the same moment
+func (root osFS) CreateExclusive(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path, err := root.resolve("create", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(pathpkg.Dir(path), 0755); err != nil {
+		if e, ok := err.(*os.PathError); ok {
+			e.Op = "create"
+		}
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return nil, &os.PathError{Op: "create", Path: path, Err: ErrExist}
+	}
+	if e, ok := err.(*os.PathError); ok {
+		e.Op = "create"
+		return nil, e
+	}
+	if root.durable {
+		return &durableFile{file: file, dir: pathpkg.Dir(path)}, nil
+	}
 	return file, nil
 }
 
@@ -75,7 +301,7 @@ func (root osFS) Copy(destPath string, source io.Reader) error {
 		return err
 	}
 
-	if _, err := io.Copy(dest, source); err != nil {
+	if _, err := copyBuffer(dest, source); err != nil {
 		return err
 	}
 
@@ -83,23 +309,256 @@ func (root osFS) Copy(destPath string, source io.Reader) error {
 }
 
 func (root osFS) Move(srcPath, destPath string) error {
-	return os.Rename(root.resolve(srcPath), root.resolve(destPath))
+	srcPath, err := root.resolve("move", srcPath)
+	if err != nil {
+		return err
+	}
+	destPath, err = root.resolve("move", destPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(srcPath, destPath)
+	if err == nil {
+		if root.durable {
+			return syncDirs(pathpkg.Dir(srcPath), pathpkg.Dir(destPath))
+		}
+		return nil
+	}
+
+	le, ok := err.(*os.LinkError)
+	if !ok {
+		return err
+	}
+	switch {
+	case os.IsNotExist(err):
+		// Either the source or the destination's parent is missing
+		if _, statErr := os.Lstat(srcPath); statErr == nil {
+			return &os.PathError{Op: "move", Path: destPath, Err: ErrNoFile}
+		}
+		return &os.PathError{Op: "move", Path: srcPath, Err: ErrNoFile}
+	case os.IsExist(err):
+		return &os.PathError{Op: "move", Path: destPath, Err: ErrExist}
+	default:
+		return &os.PathError{Op: "move", Path: srcPath, Err: le.Err}
+	}
 }
 
 func (root osFS) Stat(path string) (os.FileInfo, error) {
-	fi, err := os.Stat(root.resolve(path))
+	path, err := root.resolve("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return nil, noFileErr(err.(*os.PathError))
 	}
-	return fi, err
+	if err != nil {
+		return nil, err
+	}
+	if root.sniff {
+		fi = sniff(path, fi)
+	}
+	if root.normalize {
+		fi = normalizeInfo(fi, root.form)
+	}
+	return fi, nil
 }
 
 func (root osFS) Mkdir(path string) error {
-	return os.Mkdir(root.resolve(path), 0755)
+	path, err := root.resolve("mkdir", path)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(path, 0755)
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrNoFile}
+	case os.IsExist(err):
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrExist}
+	default:
+		return err
+	}
+}
+
+func (root osFS) Chtimes(path string, atime, mtime time.Time) error {
+	path, err := root.resolve("chtimes", path)
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(path, atime, mtime)
+	if os.IsNotExist(err) {
+		return noFileErr(err.(*os.PathError))
+	}
+	return err
 }
 
 func (root osFS) Readdir(path string) ([]os.FileInfo, error) {
-	return ioutil.ReadDir(root.resolve(path))
+	infos, err := root.ReaddirUnsorted(path)
+	if err != nil {
+		return nil, err
+	}
+	sortFileInfos(infos)
+	return infos, nil
+}
+
+// Lists a directory in the order the OS returns its entries
+func (root osFS) ReaddirUnsorted(path string) ([]os.FileInfo, error) {
+	path, err := root.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return infos, err
+	}
+	for i, info := range infos {
+		if root.sniff {
+			info = sniff(pathpkg.Join(path, info.Name()), info)
+		}
+		if root.normalize {
+			info = normalizeInfo(info, root.form)
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+// Lists a directory, leaving out the entries which can't be stated and
+// returning a `*ReaddirError` for them. Each entry is stated following
+// symlinks, like Stat, so a dangling symlink is one of them, as is a file
+// removed between listing the directory and stating it.
+func (root osFS) ReaddirBestEffort(path string) ([]os.FileInfo, error) {
+	path, err := root.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(names))
+	var errs []error
+	for _, name := range names {
+		entryPath := filepath.Join(path, name)
+		info, err := os.Stat(entryPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if root.sniff {
+			info = sniff(entryPath, info)
+		}
+		if root.normalize {
+			info = normalizeInfo(info, root.form)
+		}
+		infos = append(infos, info)
+	}
+	sortFileInfos(infos)
+
+	if len(errs) > 0 {
+		return infos, &ReaddirError{errs}
+	}
+	return infos, nil
+}
+
+// An `os.FileInfo` with a content type sniffed from the file
+type sniffedInfo struct {
+	os.FileInfo
+	contentType string
+}
+
+func (si *sniffedInfo) ContentType() string {
+	return si.contentType
+}
+
+func sniff(path string, info os.FileInfo) os.FileInfo {
+	// Opening a FIFO would block, and reading a device reads from the device
+	sniffed := &sniffedInfo{FileInfo: info}
+	if !info.Mode().IsRegular() {
+		return sniffed
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sniffed
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return sniffed
+	}
+	sniffed.contentType = http.DetectContentType(buf[:n])
+	return sniffed
+}
+
+// A file which can be flushed to disk, like an `*os.File`
+type syncFile interface {
+	io.WriteCloser
+	Sync() error
+}
+
+// Syncs a file and the directory it's in before closing
+type durableFile struct {
+	file syncFile
+	dir  string
+}
+
+func (df *durableFile) Write(p []byte) (int, error) {
+	return df.file.Write(p)
+}
+
+// Passes the fast path of the file, like copy_file_range(2), through to
+// `io.Copy`
+func (df *durableFile) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(df.file, r)
+}
+
+func (df *durableFile) Close() error {
+	if err := df.file.Sync(); err != nil {
+		df.file.Close()
+		return err
+	}
+	if err := df.file.Close(); err != nil {
+		return err
+	}
+	return syncDirs(df.dir)
+}
+
+// Fsyncs each directory, so the entries added to or removed from it are on disk
+func syncDirs(dirs ...string) error {
+	synced := map[string]bool{}
+	for _, dir := range dirs {
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+
+		d, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		err = d.Sync()
+		d.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func noFileErr(pathErr *os.PathError) error {
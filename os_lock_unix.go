@@ -0,0 +1,80 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package vfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Takes an exclusive flock(2) on path, creating an empty file there if needed.
+// Locks belong to the open file, so two Locks in the same process contend like
+// they would between processes. Platforms without flock(2) have no `Locker`.
+func (root osFS) Lock(path string) (Unlocker, error) {
+	f, err := root.openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "lock", Path: f.Name(), Err: err}
+	}
+	return &osUnlocker{f}, nil
+}
+
+func (root osFS) TryLock(path string) (Unlocker, bool, error) {
+	f, err := root.openLockFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = flock(f, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		return nil, false, nil
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, &os.PathError{Op: "lock", Path: f.Name(), Err: err}
+	}
+	return &osUnlocker{f}, true, nil
+}
+
+func (root osFS) openLockFile(path string) (*os.File, error) {
+	path, err := root.resolve("lock", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, noFileErr(err.(*os.PathError))
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Retries flock when a signal interrupts it
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// Closing the file releases its lock
+type osUnlocker struct {
+	f *os.File
+}
+
+func (ou *osUnlocker) Unlock() error {
+	return ou.f.Close()
+}
+
+func (ou *osUnlocker) Close() error {
+	return ou.f.Close()
+}
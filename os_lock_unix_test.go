@@ -0,0 +1,90 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OS Locker", func() {
+	var locker Locker
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-lock")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs, err := OS(root)
+		Expect(err).ToNot(HaveOccurred())
+		locker = fs.(Locker)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should create the lock file", func() {
+		unlocker, err := locker.Lock("/lock")
+		Expect(err).ToNot(HaveOccurred())
+		defer unlocker.Close()
+
+		_, err = os.Stat(root + "/lock")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should not TryLock a held lock", func() {
+		unlocker, err := locker.Lock("/lock")
+		Expect(err).ToNot(HaveOccurred())
+
+		start := time.Now()
+		second, ok, err := locker.TryLock("/lock")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(second).To(BeNil())
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+
+		Expect(unlocker.Unlock()).To(Succeed())
+
+		second, ok, err = locker.TryLock("/lock")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(second.Close()).To(Succeed())
+	})
+
+	It("should block Lock until the lock is released", func() {
+		unlocker, err := locker.Lock("/lock")
+		Expect(err).ToNot(HaveOccurred())
+
+		locked := make(chan Unlocker)
+		go func() {
+			defer GinkgoRecover()
+			second, err := locker.Lock("/lock")
+			Expect(err).ToNot(HaveOccurred())
+			locked <- second
+		}()
+
+		Consistently(locked, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(unlocker.Close()).To(Succeed())
+
+		var second Unlocker
+		Eventually(locked).Should(Receive(&second))
+		Expect(second.Unlock()).To(Succeed())
+	})
+
+	It("should fail to lock beneath a missing directory", func() {
+		_, err := locker.Lock("/missing/lock")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing/lock",
+			Err:  ErrNoFile,
+		}))
+	})
+
+})
@@ -0,0 +1,406 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ = Describe("OS", func() {
+	var fs FileSystem
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-os")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs, err = OS(root)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fs.Mkdir("/directory")).To(Succeed())
+		Expect(fs.Copy("/root.txt", strings.NewReader("hi, root"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	expectPathError := func(err error, op, path string, sentinel error) {
+		Expect(err).To(HaveOccurred())
+
+		switch t := err.(type) {
+		default:
+			Fail(fmt.Sprintf("Expected *os.PathError, got %T", err))
+		case *os.PathError:
+			Expect(t.Op).To(Equal(op))
+			Expect(t.Path).To(Equal(path))
+			Expect(t.Err).To(Equal(sentinel))
+		}
+	}
+
+	Describe("Open", func() {
+
+		It("should copy between files with io.Copy's fast paths", func() {
+			r, err := fs.Open("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+			Expect(r).To(BeAssignableToTypeOf(&os.File{}))
+
+			w, err := fs.Create("/directory/copied.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := w.(io.ReaderFrom)
+			Expect(ok).To(BeTrue())
+			Expect(io.Copy(w, r)).To(BeEquivalentTo(len("hi, root")))
+			Expect(w.Close()).To(Succeed())
+			Expect(ReadString(fs, "/directory/copied.txt")).To(Equal("hi, root"))
+		})
+
+		It("should return the file on disk as an Fder", func() {
+			r, err := fs.Open("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+
+			fder, ok := r.(Fder)
+			Expect(ok).To(BeTrue())
+			Expect(fder.Name()).To(Equal(filepath.Join(root, "root.txt")))
+			Expect(fder.Fd()).ToNot(Equal(^uintptr(0)))
+		})
+
+	})
+
+	Describe("ReaddirBestEffort", func() {
+
+		BeforeEach(func() {
+			Expect(fs.Copy("/directory/a.txt", strings.NewReader("a"))).To(Succeed())
+			Expect(fs.Copy("/directory/c.txt", strings.NewReader("c"))).To(Succeed())
+			broken := filepath.Join(root, "directory", "b.txt")
+			Expect(os.Symlink(filepath.Join(root, "missing.txt"), broken)).To(Succeed())
+		})
+
+		It("should list the entries it can stat around a broken symlink", func() {
+			infos, err := ReaddirBestEffort(fs, "/directory")
+			Expect(infos).To(HaveLen(2))
+			Expect(infos[0].Name()).To(Equal("a.txt"))
+			Expect(infos[1].Name()).To(Equal("c.txt"))
+
+			var readdirErr *ReaddirError
+			Expect(errors.As(err, &readdirErr)).To(BeTrue())
+			Expect(readdirErr.Errs).To(HaveLen(1))
+			expectPathError(readdirErr.Errs[0], "stat", "/directory/b.txt", syscall.ENOENT)
+		})
+
+		It("should list a directory without problems like Readdir", func() {
+			Expect(os.Remove(filepath.Join(root, "directory", "b.txt"))).To(Succeed())
+
+			infos, err := ReaddirBestEffort(fs, "/directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(2))
+		})
+
+		It("should fall back to Readdir", func() {
+			infos, err := ReaddirBestEffort(Mem(File("root.txt", nil)), "/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(1))
+		})
+
+	})
+
+	Describe("Move", func() {
+
+		It("should return ErrNoFile for a missing source", func() {
+			err := fs.Move("/missing.txt", "/moved.txt")
+			expectPathError(err, "move", "/missing.txt", ErrNoFile)
+		})
+
+		It("should return ErrNoFile for a missing destination directory", func() {
+			err := fs.Move("/root.txt", "/missing/moved.txt")
+			expectPathError(err, "move", "/missing/moved.txt", ErrNoFile)
+		})
+
+	})
+
+	Describe("ContentType", func() {
+
+		It("should not know the type of a file", func() {
+			info, err := fs.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ContentType(info)).To(Equal(""))
+		})
+
+		It("should sniff the type of a file when asked to", func() {
+			png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+			Expect(fs.Copy("/directory/image.bin", strings.NewReader(png))).To(Succeed())
+
+			sniffing, err := OS(root, SniffContentType(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := sniffing.Stat("/directory/image.bin")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ContentType(info)).To(Equal("image/png"))
+
+			infos, err := sniffing.Readdir("/directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(1))
+			Expect(ContentType(infos[0])).To(Equal("image/png"))
+
+			info, err = sniffing.Stat("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ContentType(info)).To(Equal("text/plain; charset=utf-8"))
+
+			info, err = sniffing.Stat("/directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+			Expect(ContentType(info)).To(Equal(""))
+		})
+
+	})
+
+	Describe("NormalizeUnicode", func() {
+		// "é" as a single code point, and as "e" with a combining accent
+		const nfc, nfd = "caf\u00e9", "cafe\u0301"
+
+		var normalized FileSystem
+
+		BeforeEach(func() {
+			path := filepath.Join(root, "directory", nfd+".txt")
+			Expect(ioutil.WriteFile(path, []byte("hi, cafe"), 0644)).To(Succeed())
+
+			var err error
+			normalized, err = OS(root, NormalizeUnicode(norm.NFC))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should open a file stored under NFD by its NFC name", func() {
+			Expect(ReadString(normalized, "/directory/"+nfc+".txt")).To(Equal("hi, cafe"))
+
+			_, err := fs.Open("/directory/" + nfc + ".txt")
+			Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		})
+
+		It("should list and stat names in NFC", func() {
+			infos, err := normalized.Readdir("/directory")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(1))
+			Expect(infos[0].Name()).To(Equal(nfc + ".txt"))
+
+			info, err := normalized.Stat("/directory/" + nfd + ".txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Name()).To(Equal(nfc + ".txt"))
+		})
+
+		It("should leave the root's own name alone", func() {
+			// Nothing above the root is listed, so it needn't even exist
+			fs := osFS{normalize: true, form: norm.NFC, base: "/missing/" + nfd}
+			path, err := fs.resolve("create", "/missing/"+nfd+"/"+nfd+".txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(path).To(Equal("/missing/" + nfd + "/" + nfc + ".txt"))
+		})
+
+		It("should create new files in NFC", func() {
+			Expect(WriteFile(normalized, "/"+nfd+".md", []byte("new"))).To(Succeed())
+
+			_, err := os.Stat(filepath.Join(root, nfc+".md"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("Durable", func() {
+		var durable FileSystem
+
+		BeforeEach(func() {
+			var err error
+			durable, err = OS(root, Durable(true))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should sync files written with Create", func() {
+			w, err := durable.Create("/directory/durable.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w).To(BeAssignableToTypeOf(&durableFile{}))
+
+			_, err = w.Write([]byte("durable"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			Expect(ReadFile(fs, "/directory/durable.txt")).To(Equal([]byte("durable")))
+		})
+
+		It("should pass the file's ReadFrom through", func() {
+			w, err := durable.Create("/directory/durable.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, ok := w.(io.ReaderFrom)
+			Expect(ok).To(BeTrue())
+
+			r, err := fs.Open("/root.txt")
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+			Expect(io.Copy(w, r)).To(BeEquivalentTo(len("hi, root")))
+			Expect(w.Close()).To(Succeed())
+			Expect(ReadString(fs, "/directory/durable.txt")).To(Equal("hi, root"))
+		})
+
+		It("should write atomically and move between directories", func() {
+			w, err := CreateAtomic(durable, "/directory/atomic.txt")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("atomic"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+
+			Expect(durable.Move("/directory/atomic.txt", "/moved.txt")).To(Succeed())
+			Expect(ReadFile(fs, "/moved.txt")).To(Equal([]byte("atomic")))
+		})
+
+		It("should sync before closing", func() {
+			var calls []string
+			df := &durableFile{
+				file: &recordingFile{calls: &calls},
+				dir:  root,
+			}
+			Expect(df.Close()).To(Succeed())
+			Expect(calls).To(Equal([]string{"sync", "close"}))
+		})
+
+	})
+
+	Describe("SecureRoot", func() {
+		var (
+			secure  FileSystem
+			outside string
+		)
+
+		BeforeEach(func() {
+			var err error
+			outside, err = ioutil.TempDir("", "vfs-outside")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(outside, "secret.txt"),
+				[]byte("secret"), 0644)).To(Succeed())
+
+			secure, err = OS(root, SecureRoot(true))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(outside)
+		})
+
+		It("should not climb out of the root with ../", func() {
+			_, err := secure.Open("../../etc/passwd")
+			Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+			_, err = fs.Open("../../etc/passwd")
+			Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		})
+
+		It("should not follow a symlink out of the root", func() {
+			Expect(os.Symlink(outside, filepath.Join(root, "escape"))).To(Succeed())
+
+			_, err := secure.Open("/escape/secret.txt")
+			expectPathError(err, "open", "/escape/secret.txt", os.ErrPermission)
+			Expect(errors.Is(err, os.ErrPermission)).To(BeTrue())
+
+			err = secure.Copy("/escape/planted.txt", strings.NewReader("planted"))
+			Expect(errors.Is(err, os.ErrPermission)).To(BeTrue())
+			_, err = os.Stat(filepath.Join(outside, "planted.txt"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			_, err = secure.Readdir("/escape")
+			Expect(errors.Is(err, os.ErrPermission)).To(BeTrue())
+
+			// Without SecureRoot the link is followed
+			Expect(ReadFile(fs, "/escape/secret.txt")).To(Equal([]byte("secret")))
+		})
+
+		It("should not write through a dangling symlink", func() {
+			target := filepath.Join(outside, "later.txt")
+			Expect(os.Symlink(target, filepath.Join(root, "dangling"))).To(Succeed())
+
+			err := secure.Copy("/dangling", strings.NewReader("planted"))
+			Expect(errors.Is(err, os.ErrPermission)).To(BeTrue())
+			_, err = os.Stat(target)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("should follow symlinks which stay inside the root", func() {
+			Expect(os.Symlink(filepath.Join(root, "root.txt"),
+				filepath.Join(root, "directory", "link.txt"))).To(Succeed())
+
+			Expect(ReadFile(secure, "/directory/link.txt")).To(Equal([]byte("hi, root")))
+			Expect(secure.Copy("/directory/new/file.txt", strings.NewReader("new"))).
+				To(Succeed())
+		})
+
+	})
+
+	Describe("Mkdir", func() {
+
+		It("should return ErrExist for an existing directory", func() {
+			err := fs.Mkdir("/directory")
+			expectPathError(err, "mkdir", "/directory", ErrExist)
+			Expect(errors.Is(err, os.ErrExist)).To(BeTrue())
+		})
+
+		It("should return ErrNoFile for a missing parent", func() {
+			err := fs.Mkdir("/missing/directory")
+			expectPathError(err, "mkdir", "/missing/directory", ErrNoFile)
+		})
+
+	})
+
+	Describe("Watch", func() {
+
+		It("should report files created in a directory", func() {
+			events, cancel, err := fs.(Watcher).Watch("/directory")
+			Expect(err).ToNot(HaveOccurred())
+			defer cancel()
+
+			Expect(fs.Copy("/directory/new.txt", strings.NewReader("new"))).To(Succeed())
+			Eventually(events).Should(Receive(Equal(Event{
+				Op:   EventCreate,
+				Path: "/directory/new.txt",
+			})))
+		})
+
+		It("should close the events when cancelled", func() {
+			events, cancel, err := fs.(Watcher).Watch("/directory")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cancel()).To(Succeed())
+			Eventually(events).Should(BeClosed())
+			Expect(cancel()).To(MatchError(os.ErrClosed))
+		})
+
+		It("should return ErrNoFile for a missing path", func() {
+			_, _, err := fs.(Watcher).Watch("/missing")
+			expectPathError(err, "watch", "/missing", ErrNoFile)
+		})
+
+	})
+
+})
+
+// Records the calls made to it, in order
+type recordingFile struct {
+	calls *[]string
+}
+
+func (rf *recordingFile) Write(p []byte) (int, error) {
+	*rf.calls = append(*rf.calls, "write")
+	return len(p), nil
+}
+
+func (rf *recordingFile) Sync() error {
+	*rf.calls = append(*rf.calls, "sync")
+	return nil
+}
+
+func (rf *recordingFile) Close() error {
+	*rf.calls = append(*rf.calls, "close")
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OS special files", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-special")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(syscall.Mkfifo(filepath.Join(root, "fifo"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should not sniff the content type of a FIFO", func() {
+		fs, err := OS(root, SniffContentType(true))
+		Expect(err).ToNot(HaveOccurred())
+
+		infos, err := fs.Readdir("/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(ContentType(infos[0])).To(Equal(""))
+
+		info, err := fs.Stat("/fifo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ContentType(info)).To(Equal(""))
+	})
+})
@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"os"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watches path with fsnotify. Errors fsnotify reports once the watch has
+// started are dropped, and changes to only a file's mode aren't reported.
+func (root osFS) Watch(path string) (<-chan Event, func() error, error) {
+	path, err := root.resolve("watch", path)
+	if err != nil {
+		return nil, nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "watch", Path: path, Err: err}
+	}
+	if err := watcher.Add(path); err != nil {
+		watcher.Close()
+		if os.IsNotExist(err) {
+			err = ErrNoFile
+		}
+		return nil, nil, &os.PathError{Op: "watch", Path: path, Err: err}
+	}
+
+	events := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				for _, e := range osEvents(event) {
+					select {
+					case events <- e:
+					case <-done:
+						return
+					}
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() error {
+		err := os.ErrClosed
+		once.Do(func() {
+			close(done)
+			err = watcher.Close()
+		})
+		return err
+	}
+	return events, cancel, nil
+}
+
+// fsnotify can set several ops on one event; each becomes its own `Event`
+func osEvents(event fsnotify.Event) []Event {
+	var events []Event
+	ops := []struct {
+		fsnotify fsnotify.Op
+		op       EventOp
+	}{
+		{fsnotify.Create, EventCreate},
+		{fsnotify.Write, EventWrite},
+		{fsnotify.Remove, EventRemove},
+		{fsnotify.Rename, EventRename},
+	}
+	for _, o := range ops {
+		if event.Op&o.fsnotify != 0 {
+			events = append(events, Event{Op: o.op, Path: event.Name})
+		}
+	}
+	return events
+}
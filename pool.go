@@ -0,0 +1,39 @@
+package vfs
+
+import (
+	"io"
+	"sync"
+)
+
+// The size of the buffers `Copy` and the helpers built on it read through. Set
+// it before copying anything; buffers of the old size already in the pool are
+// dropped as they're taken out.
+var CopyBufferSize = 32 * 1024
+
+// Buffers are held by pointer, so putting one back doesn't allocate
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, CopyBufferSize)
+		return &buf
+	},
+}
+
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	if len(*buf) != CopyBufferSize {
+		*buf = make([]byte, CopyBufferSize)
+	}
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	bufferPool.Put(buf)
+}
+
+// `io.Copy` through a buffer from the pool rather than a new one. Readers and
+// writers which copy themselves, like `*os.File`, skip the buffer just the same.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
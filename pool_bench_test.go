@@ -0,0 +1,43 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// Small copies are where the buffer costs most next to the copy itself. The
+// reader hides `WriteTo`, as readers from the network do, so a buffer is used.
+func benchmarkSmallCopy(b *testing.B, copyFn func(dst io.Writer, src io.Reader) error) {
+	fs := Mem()
+	content := bytes.Repeat([]byte("x"), 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, err := fs.Create("/small.txt")
+		if err != nil {
+			b.Fatal(err)
+		}
+		src := struct{ io.Reader }{bytes.NewReader(content)}
+		if err := copyFn(w, src); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCopyPooled(b *testing.B) {
+	benchmarkSmallCopy(b, func(dst io.Writer, src io.Reader) error {
+		_, err := copyBuffer(dst, src)
+		return err
+	})
+}
+
+func BenchmarkCopyUnpooled(b *testing.B) {
+	benchmarkSmallCopy(b, func(dst io.Writer, src io.Reader) error {
+		_, err := io.Copy(dst, src)
+		return err
+	})
+}
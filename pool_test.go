@@ -0,0 +1,44 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("copyBuffer", func() {
+	It("should copy through a pooled buffer", func() {
+		var dst bytes.Buffer
+		src := iotest.OneByteReader(bytes.NewReader([]byte("hi, root")))
+
+		n, err := copyBuffer(struct{ io.Writer }{&dst}, src)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(int64(8)))
+		Expect(dst.String()).To(Equal("hi, root"))
+	})
+
+	It("should return the read error", func() {
+		failed := errors.New("read failed")
+		_, err := copyBuffer(&bytes.Buffer{}, iotest.ErrReader(failed))
+		Expect(err).To(MatchError(failed))
+	})
+
+	It("should use buffers of the tunable size", func() {
+		defer func(size int) { CopyBufferSize = size }(CopyBufferSize)
+		CopyBufferSize = 1024
+
+		buf := getBuffer()
+		defer putBuffer(buf)
+		Expect(*buf).To(HaveLen(1024))
+	})
+
+	It("should read a file through a pooled buffer", func() {
+		fs := Mem(File("root.txt", []byte("hi, root")), File("empty.txt", nil))
+		Expect(ReadFile(fs, "/root.txt")).To(Equal([]byte("hi, root")))
+		Expect(ReadFile(fs, "/empty.txt")).To(Equal([]byte{}))
+	})
+})
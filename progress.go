@@ -0,0 +1,64 @@
+package vfs
+
+import "io"
+
+// Called as files are copied: after each read from the file being copied, and
+// once more when it's done. path is that file, and bytesDone counts up across
+// every file copied towards bytesTotal, the size of them all. It's called on
+// the goroutine doing the copy, never two at once, so it should return
+// quickly rather than hold the copy up.
+type ProgressFunc func(path string, bytesDone, bytesTotal int64)
+
+type copyOptions struct {
+	progress ProgressFunc
+}
+
+// Reports the progress of `CopyAll` to fn. The total is the `DiskUsage` of
+// what's being copied, found before anything is.
+func WithProgress(fn ProgressFunc) func(*copyOptions) {
+	return func(o *copyOptions) {
+		o.progress = fn
+	}
+}
+
+// The bytes copied so far out of a total
+type progress struct {
+	fn          ProgressFunc
+	done, total int64
+}
+
+// Copies a file like `copyFile`, reporting the bytes read from it under path
+func (p *progress) copyFile(
+	dst FileSystem,
+	dstPath string,
+	src FileSystem,
+	srcPath string,
+	path string,
+) error {
+	r, err := src.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := dst.Copy(dstPath, &progressReader{r: r, p: p, path: path}); err != nil {
+		return err
+	}
+	p.fn(path, p.done, p.total)
+	return nil
+}
+
+type progressReader struct {
+	r    io.Reader
+	p    *progress
+	path string
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.p.done += int64(n)
+		pr.p.fn(pr.path, pr.p.done, pr.p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,158 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	pathpkg "path"
+	"sync"
+)
+
+// Returned, wrapped in an `*os.PathError`, by writes to a `WithQuota`
+// `FileSystem` which would take it past its limit
+var ErrQuotaExceeded = errors.New("Quota exceeded")
+
+// Wraps a `FileSystem` so the files in it can't total more than maxBytes.
+// Whatever is already in fs counts against the limit. A write which would go
+// past it fails with `ErrQuotaExceeded`, as does the Close after it, and
+// nothing it wrote is kept. Files are written with `CreateAtomic`, so a file
+// being overwritten is only lost if the backend is an `AtomicCreator`.
+// Overwriting, moving over, and removing files give their space back.
+//
+// Only changes made through the returned `FileSystem` are counted.
+func WithQuota(fs FileSystem, maxBytes int64) FileSystem {
+	used, _ := DiskUsage(fs, "/")
+	return &quota{FileSystem: fs, max: maxBytes, used: used}
+}
+
+type quota struct {
+	FileSystem
+	max int64
+
+	sync.Mutex
+	used int64
+}
+
+// Takes n bytes of the quota, unless reclaim bytes are freed first there isn't
+// room for them
+func (q *quota) reserve(n, reclaim int64) bool {
+	q.Lock()
+	defer q.Unlock()
+	if q.used+n-reclaim > q.max {
+		return false
+	}
+	q.used += n
+	return true
+}
+
+func (q *quota) release(n int64) {
+	q.Lock()
+	defer q.Unlock()
+	q.used -= n
+}
+
+// The size of the file at path, which is freed once it's overwritten
+func (q *quota) fileSize(path string) int64 {
+	info, err := q.FileSystem.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
+
+func (q *quota) Create(path string) (io.WriteCloser, error) {
+	path = pathpkg.Clean("/" + path)
+	reclaim := q.fileSize(path)
+
+	w, err := CreateAtomic(q.FileSystem, path)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaFile{q: q, w: w, path: path, reclaim: reclaim}, nil
+}
+
+func (q *quota) Copy(path string, source io.Reader) error {
+	dest, err := q.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := copyBuffer(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (q *quota) Move(srcPath, destPath string) error {
+	if pathpkg.Clean("/"+srcPath) == pathpkg.Clean("/"+destPath) {
+		return q.FileSystem.Move(srcPath, destPath)
+	}
+
+	freed := q.fileSize(destPath)
+	if err := q.FileSystem.Move(srcPath, destPath); err != nil {
+		return err
+	}
+	q.release(freed)
+	return nil
+}
+
+func (q *quota) Remove(path string) error {
+	freed, _ := DiskUsage(q.FileSystem, path)
+	if err := q.FileSystem.Remove(path); err != nil {
+		return err
+	}
+	q.release(freed)
+	return nil
+}
+
+type quotaFile struct {
+	q       *quota
+	w       io.WriteCloser
+	path    string
+	written int64
+	reclaim int64 // the size of the file being overwritten
+	err     error
+}
+
+func (qf *quotaFile) Write(p []byte) (int, error) {
+	if qf.err != nil {
+		return 0, qf.err
+	}
+	if !qf.q.reserve(int64(len(p)), qf.reclaim) {
+		qf.abort(&os.PathError{Op: "write", Path: qf.path, Err: ErrQuotaExceeded})
+		return 0, qf.err
+	}
+
+	n, err := qf.w.Write(p)
+	qf.written += int64(n)
+	qf.q.release(int64(len(p) - n))
+	if err != nil {
+		qf.abort(err)
+	}
+	return n, err
+}
+
+func (qf *quotaFile) Close() error {
+	if qf.err != nil {
+		return qf.err
+	}
+	if err := qf.w.Close(); err != nil {
+		qf.abort(err)
+		return err
+	}
+
+	qf.q.release(qf.reclaim)
+	qf.err = os.ErrClosed
+	return nil
+}
+
+// Gives up on the write, discarding what was written and giving back its
+// space. Every later call fails with err.
+func (qf *quotaFile) abort(err error) {
+	qf.err = err
+	qf.q.release(qf.written)
+	qf.written = 0
+	abortWriter(qf.q.FileSystem, qf.path, qf.w)
+}
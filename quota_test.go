@@ -0,0 +1,77 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithQuota", func() {
+	var backend, fs FileSystem
+
+	BeforeEach(func() {
+		backend = Mem(Dir("directory", File("old.txt", []byte("1234"))))
+		fs = WithQuota(backend, 10)
+	})
+
+	It("should allow writes up to the quota", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("12"))).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("1234"))).To(Succeed())
+		Expect(ReadFile(fs, "/b.txt")).To(Equal([]byte("1234")))
+	})
+
+	It("should fail a write past the quota and keep none of it", func() {
+		w, err := fs.Create("/big.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write([]byte("123456"))).To(Equal(6))
+
+		_, err = w.Write([]byte("7"))
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "write",
+			Path: "/big.txt",
+			Err:  ErrQuotaExceeded,
+		}))
+		Expect(errors.Is(w.Close(), ErrQuotaExceeded)).To(BeTrue())
+
+		_, err = backend.Stat("/big.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		Expect(backend.Readdir("/")).To(HaveLen(1))
+
+		Expect(fs.Copy("/fits.txt", strings.NewReader("123456"))).To(Succeed())
+	})
+
+	It("should fail a Copy past the quota", func() {
+		err := fs.Copy("/big.txt", strings.NewReader("12345678901"))
+		Expect(errors.Is(err, ErrQuotaExceeded)).To(BeTrue())
+
+		_, err = backend.Stat("/big.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should keep a file that a failed overwrite was replacing", func() {
+		err := fs.Copy("/directory/old.txt", strings.NewReader("12345678901"))
+		Expect(errors.Is(err, ErrQuotaExceeded)).To(BeTrue())
+		Expect(ReadFile(fs, "/directory/old.txt")).To(Equal([]byte("1234")))
+	})
+
+	It("should reclaim the space of a file being overwritten", func() {
+		Expect(fs.Copy("/directory/old.txt", strings.NewReader("1234567890"))).To(Succeed())
+		Expect(fs.Copy("/directory/old.txt", strings.NewReader("12"))).To(Succeed())
+		Expect(fs.Copy("/a.txt", strings.NewReader("12345678"))).To(Succeed())
+	})
+
+	It("should free the space of removed files", func() {
+		Expect(fs.Remove("/directory/old.txt")).To(Succeed())
+		Expect(fs.Copy("/a.txt", strings.NewReader("1234567890"))).To(Succeed())
+	})
+
+	It("should free the space of a file moved over", func() {
+		Expect(fs.Copy("/a.txt", strings.NewReader("12"))).To(Succeed())
+		Expect(fs.Move("/a.txt", "/directory/old.txt")).To(Succeed())
+		Expect(fs.Copy("/b.txt", strings.NewReader("12345678"))).To(Succeed())
+	})
+
+})
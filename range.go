@@ -0,0 +1,87 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+)
+
+// Implemented by `FileSystem`s which can read part of a file without opening
+// all of it, like S3 with a ranged GET
+type RangeOpener interface {
+	OpenRange(path string, off, length int64) (io.ReadCloser, error)
+}
+
+// Returns a reader over the length bytes of a file starting at off, the
+// building block for serving HTTP range requests. A range running past the end
+// of the file is cut short there, and one starting past it reads nothing. If
+// the `FileSystem` is a `RangeOpener` its implementation is used instead;
+// otherwise the file is opened and seeked.
+func OpenRange(fs FileSystem, path string, off, length int64) (io.ReadCloser, error) {
+	if err := checkRange("open", path, off, length); err != nil {
+		return nil, err
+	}
+	if ro, ok := fs.(RangeOpener); ok {
+		return ro.OpenRange(path, off, length)
+	}
+
+	r, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return &limitedReadCloser{io.LimitReader(r, length), r}, nil
+}
+
+// Fails with `os.ErrInvalid` for a range with a negative offset or length
+func checkRange(op, path string, off, length int64) error {
+	if off < 0 || length < 0 {
+		return &os.PathError{
+			Op:   op,
+			Path: pathpkg.Clean("/" + path),
+			Err:  os.ErrInvalid,
+		}
+	}
+	return nil
+}
+
+// Reads part of a file, closing the whole of it
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Slices the range out of the file's content without copying it
+func (mn *MemNode) OpenRange(path string, off, length int64) (io.ReadCloser, error) {
+	if err := checkRange("open", path, off, length); err != nil {
+		return nil, err
+	}
+	path = pathpkg.Clean("/" + path)
+
+	child := mn.childByPath(path)
+	if child == nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrNoFile}
+	}
+	if child.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: ErrIsDir}
+	}
+
+	size := int64(len(child.content))
+	if off > size {
+		off = size
+	}
+	if length > size-off {
+		length = size - off
+	}
+	return ioutil.NopCloser(bytes.NewReader(child.content[off : off+length])), nil
+}
+
+func (s *subtree) OpenRange(path string, off, length int64) (io.ReadCloser, error) {
+	r, err := OpenRange(s.fs, s.mapPath(path), off, length)
+	return r, s.unmapError(err)
+}
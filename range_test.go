@@ -0,0 +1,89 @@
+package vfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenRange", func() {
+
+	itShouldOpenRanges := func(newFS func() FileSystem) {
+		var fs FileSystem
+
+		BeforeEach(func() {
+			fs = newFS()
+		})
+
+		read := func(path string, off, length int64) string {
+			r, err := OpenRange(fs, path, off, length)
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+			content, err := ioutil.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			return string(content)
+		}
+
+		It("should read the middle of a file", func() {
+			Expect(read("/root.txt", 2, 3)).To(Equal(", r"))
+		})
+
+		It("should cut a range short at the end of the file", func() {
+			Expect(read("/root.txt", 4, 100)).To(Equal("root"))
+			Expect(read("/root.txt", 4, math.MaxInt64)).To(Equal("root"))
+		})
+
+		It("should read nothing past the end of the file", func() {
+			Expect(read("/root.txt", 100, 3)).To(BeEmpty())
+			Expect(read("/root.txt", 2, 0)).To(BeEmpty())
+		})
+
+		It("should not open a missing file", func() {
+			_, err := OpenRange(fs, "/missing.txt", 0, 3)
+			Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		})
+
+		It("should not open a negative range", func() {
+			_, err := OpenRange(fs, "/root.txt", -1, 3)
+			Expect(errors.Is(err, os.ErrInvalid)).To(BeTrue())
+		})
+	}
+
+	Describe("Mem", func() {
+		itShouldOpenRanges(func() FileSystem {
+			return Mem(File("root.txt", []byte("hi, root")))
+		})
+	})
+
+	Describe("OS", func() {
+		var root string
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		itShouldOpenRanges(func() FileSystem {
+			var err error
+			root, err = ioutil.TempDir("", "vfs-range")
+			Expect(err).ToNot(HaveOccurred())
+
+			fs, err := OS(root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(WriteString(fs, "/root.txt", "hi, root")).To(Succeed())
+			return fs
+		})
+	})
+
+	Describe("Subtree", func() {
+		itShouldOpenRanges(func() FileSystem {
+			fs, err := Subtree(Mem(Dir("tree", File("root.txt", []byte("hi, root")))), "/tree")
+			Expect(err).ToNot(HaveOccurred())
+			return fs
+		})
+	})
+
+})
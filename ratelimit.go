@@ -0,0 +1,130 @@
+package vfs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Wraps a `FileSystem` so the bytes read from Open and written through Create
+// and Copy are throttled to bytesPerSec. The limit is shared by every stream
+// from the returned `FileSystem`, so concurrent transfers split it rather than
+// each getting their own. Reads and writes block until they fit in the limit.
+// A limit of zero or less leaves fs unthrottled.
+func RateLimited(fs FileSystem, bytesPerSec int64) FileSystem {
+	if bytesPerSec <= 0 {
+		return fs
+	}
+	return &rateLimited{fs, &limiter{rate: bytesPerSec}}
+}
+
+type rateLimited struct {
+	FileSystem
+	limiter *limiter
+}
+
+func (rl *rateLimited) Open(path string) (ReadSeekCloser, error) {
+	r, err := rl.FileSystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReader{r, rl.limiter}, nil
+}
+
+func (rl *rateLimited) Create(path string) (io.WriteCloser, error) {
+	w, err := rl.FileSystem.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedWriter{w, rl.limiter}, nil
+}
+
+// Throttles how fast the underlying `FileSystem` can pull from source
+func (rl *rateLimited) Copy(path string, source io.Reader) error {
+	return rl.FileSystem.Copy(path, &limitedSource{source, rl.limiter})
+}
+
+// A token bucket without a burst: every byte is paid for by waiting 1/rate
+// seconds after the bytes before it, across all callers.
+type limiter struct {
+	rate int64
+
+	sync.Mutex
+	next time.Time // when the bytes reserved so far have been paid for
+}
+
+// Blocks until n more bytes are allowed through
+func (l *limiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	cost := time.Duration(int64(n) * int64(time.Second) / l.rate)
+
+	l.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(cost)
+	until := l.next
+	l.Unlock()
+
+	time.Sleep(time.Until(until))
+}
+
+// Caps a transfer at a second's worth of bytes, so large reads and writes make
+// steady progress instead of waiting out their whole cost up front
+func (l *limiter) chunk(n int) int {
+	if int64(n) > l.rate {
+		return int(l.rate)
+	}
+	return n
+}
+
+type limitedReader struct {
+	ReadSeekCloser
+	limiter *limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.ReadSeekCloser.Read(p[:lr.limiter.chunk(len(p))])
+	lr.limiter.wait(n)
+	return n, err
+}
+
+func (lr *limitedReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := lr.ReadSeekCloser.ReadAt(p, off)
+	lr.limiter.wait(n)
+	return n, err
+}
+
+type limitedSource struct {
+	io.Reader
+	limiter *limiter
+}
+
+func (ls *limitedSource) Read(p []byte) (int, error) {
+	n, err := ls.Reader.Read(p[:ls.limiter.chunk(len(p))])
+	ls.limiter.wait(n)
+	return n, err
+}
+
+type limitedWriter struct {
+	io.WriteCloser
+	limiter *limiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := lw.limiter.chunk(len(p))
+		lw.limiter.wait(chunk)
+		n, err := lw.WriteCloser.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
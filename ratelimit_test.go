@@ -0,0 +1,85 @@
+package vfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimited", func() {
+	// 100KB at 400KB/s should take a quarter of a second
+	const (
+		size  = 100 * 1024
+		rate  = 400 * 1024
+		least = 250 * time.Millisecond
+		most  = 750 * time.Millisecond
+	)
+	var content []byte
+	var fs FileSystem
+
+	BeforeEach(func() {
+		content = bytes.Repeat([]byte("x"), size)
+		fs = RateLimited(Mem(File("big.txt", content)), rate)
+	})
+
+	It("should throttle writes through Create", func() {
+		start := time.Now()
+		w, err := fs.Create("/out.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write(content)).To(Equal(size))
+		Expect(w.Close()).To(Succeed())
+
+		Expect(time.Since(start)).To(BeNumerically(">=", least))
+		Expect(time.Since(start)).To(BeNumerically("<", most))
+		Expect(ReadFile(fs, "/out.txt")).To(Equal(content))
+	})
+
+	It("should throttle the source of a Copy", func() {
+		start := time.Now()
+		Expect(fs.Copy("/out.txt", bytes.NewReader(content))).To(Succeed())
+
+		Expect(time.Since(start)).To(BeNumerically(">=", least))
+		Expect(time.Since(start)).To(BeNumerically("<", most))
+	})
+
+	It("should throttle reads through Open", func() {
+		start := time.Now()
+		r, err := fs.Open("/big.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal(content))
+
+		Expect(time.Since(start)).To(BeNumerically(">=", least))
+		Expect(time.Since(start)).To(BeNumerically("<", most))
+	})
+
+	It("should share the limit between concurrent streams", func() {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				r, err := fs.Open("/big.txt")
+				Expect(err).ToNot(HaveOccurred())
+				defer r.Close()
+				_, err = r.Read(make([]byte, size/2))
+				Expect(err).ToNot(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		Expect(time.Since(start)).To(BeNumerically(">=", least))
+	})
+
+	It("should leave a FileSystem alone without a limit", func() {
+		mem := Mem()
+		Expect(RateLimited(mem, 0)).To(BeIdenticalTo(mem))
+	})
+
+})
@@ -0,0 +1,127 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// How `WithRetry` retries failed operations
+type RetryPolicy struct {
+	// Attempts made in total, including the first. Less than 1 is taken as 1.
+	MaxAttempts int
+
+	// The wait before the first retry, doubled before each one after it
+	BaseDelay time.Duration
+
+	// Whether an error is worth retrying. Nil retries every error. Either way,
+	// errors which can't succeed on a retry, like `ErrNoFile`, aren't retried.
+	Retryable func(error) bool
+}
+
+// Errors which retrying can't fix
+var terminalErrors = []error{ErrNoFile, ErrExist, ErrIsDir, ErrNotSupported}
+
+func (p RetryPolicy) retryable(err error) bool {
+	for _, terminal := range terminalErrors {
+		if errors.Is(err, terminal) {
+			return false
+		}
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// Wraps a `FileSystem` so idempotent operations are retried with exponential
+// backoff when they fail with a retryable error. Open, Stat, Readdir, Remove,
+// Mkdir and Create are retried; the writer Create returns is not. Copy is only
+// retried when its source is an `io.Seeker`, which is rewound to where it
+// started before each retry. Move is never retried.
+func WithRetry(fs FileSystem, policy RetryPolicy) FileSystem {
+	return &retrying{fs, policy}
+}
+
+type retrying struct {
+	FileSystem
+	policy RetryPolicy
+}
+
+// Calls op until it succeeds, fails with an error that shouldn't be retried, or
+// runs out of attempts. The last error is returned.
+func (r *retrying) retry(op func() error) error {
+	delay := r.policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.retryable(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (r *retrying) Open(path string) (rsc ReadSeekCloser, err error) {
+	err = r.retry(func() error {
+		rsc, err = r.FileSystem.Open(path)
+		return err
+	})
+	return
+}
+
+func (r *retrying) Create(path string) (w io.WriteCloser, err error) {
+	err = r.retry(func() error {
+		w, err = r.FileSystem.Create(path)
+		return err
+	})
+	return
+}
+
+func (r *retrying) Copy(path string, source io.Reader) error {
+	seeker, ok := source.(io.Seeker)
+	if !ok {
+		return r.FileSystem.Copy(path, source)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return r.FileSystem.Copy(path, source)
+	}
+
+	first := true
+	return r.retry(func() error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return r.FileSystem.Copy(path, source)
+	})
+}
+
+func (r *retrying) Remove(path string) error {
+	return r.retry(func() error {
+		return r.FileSystem.Remove(path)
+	})
+}
+
+func (r *retrying) Stat(path string) (info os.FileInfo, err error) {
+	err = r.retry(func() error {
+		info, err = r.FileSystem.Stat(path)
+		return err
+	})
+	return
+}
+
+func (r *retrying) Readdir(path string) (infos []os.FileInfo, err error) {
+	err = r.retry(func() error {
+		infos, err = r.FileSystem.Readdir(path)
+		return err
+	})
+	return
+}
+
+func (r *retrying) Mkdir(path string) error {
+	return r.retry(func() error {
+		return r.FileSystem.Mkdir(path)
+	})
+}
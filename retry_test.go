@@ -0,0 +1,178 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var errFlaky = errors.New("connection reset")
+
+// Fails the first `failures` calls of each operation with errFlaky
+type flakyFS struct {
+	FileSystem
+	failures int
+	calls    map[string]int
+}
+
+func (f *flakyFS) fail(op string) error {
+	f.calls[op]++
+	if f.calls[op] <= f.failures {
+		return &os.PathError{Op: op, Path: "/", Err: errFlaky}
+	}
+	return nil
+}
+
+func (f *flakyFS) Open(path string) (ReadSeekCloser, error) {
+	if err := f.fail("open"); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Open(path)
+}
+
+func (f *flakyFS) Stat(path string) (os.FileInfo, error) {
+	if err := f.fail("stat"); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Stat(path)
+}
+
+func (f *flakyFS) Readdir(path string) ([]os.FileInfo, error) {
+	if err := f.fail("readdir"); err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Readdir(path)
+}
+
+func (f *flakyFS) Remove(path string) error {
+	if err := f.fail("remove"); err != nil {
+		return err
+	}
+	return f.FileSystem.Remove(path)
+}
+
+func (f *flakyFS) Mkdir(path string) error {
+	if err := f.fail("mkdir"); err != nil {
+		return err
+	}
+	return f.FileSystem.Mkdir(path)
+}
+
+func (f *flakyFS) Move(src, dest string) error {
+	if err := f.fail("move"); err != nil {
+		return err
+	}
+	return f.FileSystem.Move(src, dest)
+}
+
+// Reads part of the source before failing, like a dropped upload
+func (f *flakyFS) Copy(path string, source io.Reader) error {
+	if err := f.fail("copy"); err != nil {
+		io.CopyN(io.Discard, source, 2)
+		return err
+	}
+	return f.FileSystem.Copy(path, source)
+}
+
+var _ = Describe("WithRetry", func() {
+	var flaky *flakyFS
+	var fs FileSystem
+
+	BeforeEach(func() {
+		flaky = &flakyFS{
+			FileSystem: Mem(
+				Dir("directory"),
+				File("root.txt", []byte("hi, root")),
+			),
+			failures: 2,
+			calls:    make(map[string]int),
+		}
+		fs = WithRetry(flaky, RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Millisecond,
+		})
+	})
+
+	It("should retry idempotent operations until they succeed", func() {
+		Expect(ReadFile(fs, "/root.txt")).To(Equal([]byte("hi, root")))
+		Expect(fs.Stat("/root.txt")).ToNot(BeNil())
+		Expect(fs.Readdir("/directory")).To(BeEmpty())
+		Expect(fs.Mkdir("/other")).To(Succeed())
+		Expect(fs.Remove("/root.txt")).To(Succeed())
+
+		Expect(flaky.calls).To(Equal(map[string]int{
+			"open":    3,
+			"stat":    3,
+			"readdir": 3,
+			"mkdir":   3,
+			"remove":  3,
+		}))
+	})
+
+	It("should give up after the maximum attempts", func() {
+		flaky.failures = 5
+		_, err := fs.Stat("/root.txt")
+		Expect(errors.Is(err, errFlaky)).To(BeTrue())
+		Expect(flaky.calls["stat"]).To(Equal(3))
+	})
+
+	It("should back off exponentially", func() {
+		fs = WithRetry(flaky, RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   20 * time.Millisecond,
+		})
+		start := time.Now()
+		Expect(fs.Stat("/root.txt")).ToNot(BeNil())
+		Expect(time.Since(start)).To(BeNumerically(">=", 60*time.Millisecond))
+	})
+
+	It("should not retry terminal errors", func() {
+		flaky.failures = 0
+		_, err := fs.Stat("/missing.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+		Expect(flaky.calls["stat"]).To(Equal(1))
+
+		err = fs.Mkdir("/directory")
+		Expect(errors.Is(err, ErrExist)).To(BeTrue())
+		Expect(flaky.calls["mkdir"]).To(Equal(1))
+	})
+
+	It("should only retry errors the policy classifies as retryable", func() {
+		fs = WithRetry(flaky, RetryPolicy{
+			MaxAttempts: 3,
+			Retryable:   func(err error) bool { return false },
+		})
+		_, err := fs.Stat("/root.txt")
+		Expect(errors.Is(err, errFlaky)).To(BeTrue())
+		Expect(flaky.calls["stat"]).To(Equal(1))
+	})
+
+	It("should retry Copy from a seekable source from where it started", func() {
+		source := bytes.NewReader([]byte("skip, content"))
+		source.Seek(6, io.SeekStart)
+
+		Expect(fs.Copy("/copied.txt", source)).To(Succeed())
+		Expect(flaky.calls["copy"]).To(Equal(3))
+		Expect(ReadFile(fs, "/copied.txt")).To(Equal([]byte("content")))
+	})
+
+	It("should not retry Copy from a source which can't be rewound", func() {
+		source := struct{ io.Reader }{strings.NewReader("content")}
+		err := fs.Copy("/copied.txt", source)
+		Expect(errors.Is(err, errFlaky)).To(BeTrue())
+		Expect(flaky.calls["copy"]).To(Equal(1))
+	})
+
+	It("should not retry Move", func() {
+		err := fs.Move("/root.txt", "/moved.txt")
+		Expect(errors.Is(err, errFlaky)).To(BeTrue())
+		Expect(flaky.calls["move"]).To(Equal(1))
+	})
+
+})
@@ -0,0 +1,377 @@
+package s3fs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+)
+
+// An in-memory stand-in for the parts of S3 the tests exercise. Calls to
+// anything else panic on the nil embedded interface.
+type fakeS3 struct {
+	s3iface.S3API
+
+	objects map[string][]byte
+	types   map[string]string
+	etags   map[string]string
+	encs    map[string]string
+	meta    map[string]map[string]string
+	gets    []string
+	ranges  []string
+	lists   []*s3.ListObjectsV2Input
+	deletes [][]string
+	copies  []*s3.CopyObjectInput
+
+	// Keys DeleteObjects will report as failing to delete
+	undeletable map[string]bool
+
+	// Headers HeadObject reports for these keys, besides those it works out
+	heads map[string]*s3.HeadObjectOutput
+
+	// ETags CopyObject reports for copies to these keys, instead of the source's
+	copyResults map[string]string
+
+	// Server-side encryption the bucket applies to copies by default
+	copySSE string
+
+	// The bucket's LocationConstraint, which is empty for us-east-1
+	location string
+
+	// Keys whose bodies GetObject cuts off after this many bytes, while still
+	// reporting their whole length
+	truncated map[string]int
+
+	// Keys whose ranged reads from past the start hang until they're
+	// cancelled, like a slow download
+	stalled map[string]bool
+
+	// Guards gets and ranges, which readers can add to from other goroutines
+	sync.Mutex
+}
+
+func newFakeS3(objects map[string][]byte) *fakeS3 {
+	return &fakeS3{objects: objects}
+}
+
+func (f *fakeS3) fileSystem(opts ...func(*S3FileSystem)) *S3FileSystem {
+	fs := &S3FileSystem{
+		s3:     f,
+		bucket: aws.String("bucket"),
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+func (f *fakeS3) HeadObject(
+	input *s3.HeadObjectInput,
+) (*s3.HeadObjectOutput, error) {
+	content, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.NewRequestFailure(
+			awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+	out := &s3.HeadObjectOutput{}
+	if head, ok := f.heads[*input.Key]; ok {
+		*out = *head
+	}
+	out.ContentLength = aws.Int64(int64(len(content)))
+	out.ETag = aws.String(f.etag(*input.Key))
+	out.LastModified = aws.Time(time.Now())
+	out.Metadata = aws.StringMap(f.meta[*input.Key])
+	if contentType, ok := f.types[*input.Key]; ok {
+		out.ContentType = aws.String(contentType)
+	}
+	if encoding, ok := f.encs[*input.Key]; ok {
+		out.ContentEncoding = aws.String(encoding)
+	}
+	return out, nil
+}
+
+// The ETag of a key, which is the MD5 of its content unless it's been set
+func (f *fakeS3) etag(key string) string {
+	if etag, ok := f.etags[key]; ok {
+		return etag
+	}
+	return fmt.Sprintf(`"%x"`, md5.Sum(f.objects[key]))
+}
+
+func (f *fakeS3) GetObject(
+	input *s3.GetObjectInput,
+) (*s3.GetObjectOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.gets = append(f.gets, *input.Key)
+	content, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil)
+	}
+	out := &s3.GetObjectOutput{}
+	if input.Range != nil {
+		// An open-ended range leaves end alone, reading to the end
+		start, end := 0, len(content)
+		fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+		f.ranges = append(f.ranges, *input.Range)
+		if start >= len(content) {
+			return nil, awserr.NewRequestFailure(
+				awserr.New("InvalidRange", "The requested range is not satisfiable", nil),
+				http.StatusRequestedRangeNotSatisfiable, "")
+		}
+		if end >= len(content) {
+			end = len(content) - 1
+		}
+		out.ContentRange = aws.String(
+			fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		content = content[start : end+1]
+	}
+	out.ContentLength = aws.Int64(int64(len(content)))
+	if n, ok := f.truncated[*input.Key]; ok && n < len(content) {
+		content = content[:n]
+	}
+	out.Body = ioutil.NopCloser(bytes.NewReader(content))
+	if encoding, ok := f.encs[*input.Key]; ok {
+		out.ContentEncoding = aws.String(encoding)
+	}
+	return out, nil
+}
+
+// What the s3manager downloader calls
+func (f *fakeS3) GetObjectWithContext(
+	ctx aws.Context,
+	input *s3.GetObjectInput,
+	opts ...request.Option,
+) (*s3.GetObjectOutput, error) {
+	ranged := input.Range != nil && !strings.HasPrefix(*input.Range, "bytes=0-")
+	if f.stalled[*input.Key] && ranged {
+		<-ctx.Done()
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+	return f.GetObject(input)
+}
+
+func (f *fakeS3) GetBucketLocationWithContext(
+	ctx aws.Context,
+	input *s3.GetBucketLocationInput,
+	opts ...request.Option,
+) (*s3.GetBucketLocationOutput, error) {
+	out := &s3.GetBucketLocationOutput{}
+	if f.location != "" {
+		out.LocationConstraint = aws.String(f.location)
+	}
+	return out, nil
+}
+
+// Lists keys like S3 does, including grouping by delimiter and paging
+func (f *fakeS3) ListObjectsV2(
+	input *s3.ListObjectsV2Input,
+) (*s3.ListObjectsV2Output, error) {
+	f.lists = append(f.lists, input)
+
+	prefix := aws.StringValue(input.Prefix)
+	delimiter := aws.StringValue(input.Delimiter)
+	maxKeys := int(aws.Int64Value(input.MaxKeys))
+	if maxKeys == 0 {
+		maxKeys = 1000
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Entries are either a key or a common prefix, in key order
+	var entries []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			common := prefix + rest[:i+len(delimiter)]
+			if !seen[common] {
+				seen[common] = true
+				entries = append(entries, common)
+			}
+			continue
+		}
+		entries = append(entries, key)
+	}
+
+	// The token is the last entry of the previous page, so keys deleted between
+	// pages don't shift where the next one starts
+	start := 0
+	if token := aws.StringValue(input.ContinuationToken); token != "" {
+		start = sort.SearchStrings(entries, token)
+		if start < len(entries) && entries[start] == token {
+			start++
+		}
+	}
+	end := start + maxKeys
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	out := &s3.ListObjectsV2Output{
+		IsTruncated: aws.Bool(end < len(entries)),
+		KeyCount:    aws.Int64(int64(end - start)),
+	}
+	for _, entry := range entries[start:end] {
+		if seen[entry] {
+			out.CommonPrefixes = append(out.CommonPrefixes,
+				&s3.CommonPrefix{Prefix: aws.String(entry)})
+			continue
+		}
+		out.Contents = append(out.Contents, &s3.Object{
+			Key:          aws.String(entry),
+			ETag:         aws.String(fmt.Sprintf(`"%x"`, md5.Sum(f.objects[entry]))),
+			StorageClass: aws.String(s3.ObjectStorageClassStandard),
+			Size:         aws.Int64(int64(len(f.objects[entry]))),
+			LastModified: aws.Time(time.Now()),
+		})
+	}
+	if end < len(entries) {
+		out.NextContinuationToken = aws.String(entries[end-1])
+	}
+	return out, nil
+}
+
+func (f *fakeS3) ListObjectsV2Pages(
+	input *s3.ListObjectsV2Input,
+	fn func(*s3.ListObjectsV2Output, bool) bool,
+) error {
+	page := *input
+	for {
+		out, err := f.ListObjectsV2(&page)
+		if err != nil {
+			return err
+		}
+		last := !aws.BoolValue(out.IsTruncated)
+		if !fn(out, last) || last {
+			return nil
+		}
+		page.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+func (f *fakeS3) DeleteObjects(
+	input *s3.DeleteObjectsInput,
+) (*s3.DeleteObjectsOutput, error) {
+	out := &s3.DeleteObjectsOutput{}
+	var batch []string
+	for _, obj := range input.Delete.Objects {
+		batch = append(batch, *obj.Key)
+		if f.undeletable[*obj.Key] {
+			out.Errors = append(out.Errors, &s3.Error{
+				Key:     obj.Key,
+				Code:    aws.String("AccessDenied"),
+				Message: aws.String("Access Denied"),
+			})
+			continue
+		}
+		delete(f.objects, *obj.Key)
+	}
+	f.deletes = append(f.deletes, batch)
+	return out, nil
+}
+
+func (f *fakeS3) CopyObject(
+	input *s3.CopyObjectInput,
+) (*s3.CopyObjectOutput, error) {
+	f.copies = append(f.copies, input)
+	srcKey := strings.TrimPrefix(*input.CopySource, *input.Bucket+"/")
+	content, ok := f.objects[srcKey]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil)
+	}
+	etag := f.etag(srcKey)
+	if match := input.CopySourceIfMatch; match != nil && *match != etag {
+		return nil, awserr.NewRequestFailure(
+			awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil),
+			http.StatusPreconditionFailed, "")
+	}
+	if result, ok := f.copyResults[*input.Key]; ok {
+		etag = result
+	}
+	f.objects[*input.Key] = content
+	// Replacing the metadata resets the headers stored with it, like
+	// Content-Encoding, to whatever the copy sets
+	if f.encs == nil {
+		f.encs = map[string]string{}
+	}
+	if aws.StringValue(input.MetadataDirective) == s3.MetadataDirectiveReplace {
+		if f.meta == nil {
+			f.meta = map[string]map[string]string{}
+		}
+		f.meta[*input.Key] = aws.StringValueMap(input.Metadata)
+		delete(f.encs, *input.Key)
+		if input.ContentEncoding != nil {
+			f.encs[*input.Key] = *input.ContentEncoding
+		}
+	} else if encoding, ok := f.encs[srcKey]; ok {
+		f.encs[*input.Key] = encoding
+	}
+	out := &s3.CopyObjectOutput{
+		CopyObjectResult: &s3.CopyObjectResult{
+			ETag:         aws.String(etag),
+			LastModified: aws.Time(time.Now()),
+		},
+	}
+	if f.copySSE != "" {
+		out.ServerSideEncryption = aws.String(f.copySSE)
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObject(
+	input *s3.DeleteObjectInput,
+) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) PutObject(
+	input *s3.PutObjectInput,
+) (*s3.PutObjectOutput, error) {
+	var content []byte
+	if input.Body != nil {
+		content, _ = ioutil.ReadAll(input.Body)
+	}
+	f.objects[*input.Key] = content
+	return &s3.PutObjectOutput{}, nil
+}
+
+// Uploads straight to a fake with a single PutObject. The real uploader builds
+// its requests itself, which the fake can't answer.
+type fakeUploader struct {
+	s3manageriface.UploaderAPI
+	f *fakeS3
+}
+
+func (u fakeUploader) Upload(
+	input *s3manager.UploadInput,
+	opts ...func(*s3manager.Uploader),
+) (*s3manager.UploadOutput, error) {
+	_, err := u.f.PutObject(&s3.PutObjectInput{
+		Body:   aws.ReadSeekCloser(input.Body),
+		Bucket: input.Bucket,
+		Key:    input.Key,
+	})
+	return &s3manager.UploadOutput{}, err
+}
@@ -1,15 +1,26 @@
 package s3fs
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"math"
 	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	pathpkg "path"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,41 +28,142 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 
 	"github.com/vistarmedia/vfs"
 )
 
 // `FileSystem` backed by S3
 type S3FileSystem struct {
-	s3         *s3.S3
+	s3         s3iface.S3API
 	acl        *string
+	sse        *string
+	sseKMSKey  *string
+	storage    *string
+	cacheCtl   *string
+	dispose    *string
+	metadata   map[string]*string
+	mimeType   func(string) string
+	configs    []*aws.Config
 	bucket     *string
+	payer      *string
 	tmpDir     string
+	lazyRange  bool
+	readAhead  int64
+	gzip       bool
+	gzipMin    int64
+	decode     bool
+	partSize   int64
+	workers    int
 	downloader *s3manager.Downloader
-	uploader   *s3manager.Uploader
+	uploader   s3manageriface.UploaderAPI
 }
 
 // Create a new `FileSystem` from the given AWS session and bucket and accept
-// functional options to modify that `FileSystem`
+// functional options to modify that `FileSystem`. Returns an error if the
+// options aren't usable.
 func New(
 	sess *session.Session,
 	bucket string,
 	opts ...func(*S3FileSystem),
-) vfs.FileSystem {
+) (vfs.FileSystem, error) {
 
-	s3Client := s3.New(sess)
 	s3FileSystem := &S3FileSystem{
-		s3:         s3Client,
-		downloader: s3manager.NewDownloaderWithClient(s3Client),
-		uploader:   s3manager.NewUploaderWithClient(s3Client),
-		tmpDir:     os.TempDir(),
-		bucket:     aws.String(bucket),
+		tmpDir: os.TempDir(),
+		bucket: aws.String(bucket),
 	}
 	for _, opt := range opts {
 		opt(s3FileSystem)
 	}
-	return s3FileSystem
+
+	if s3FileSystem.partSize != 0 &&
+		s3FileSystem.partSize < s3manager.MinUploadPartSize {
+		return nil, fmt.Errorf("Part size %d is below the S3 minimum of %d",
+			s3FileSystem.partSize, s3manager.MinUploadPartSize)
+	}
+
+	if err := checkTmpDir(s3FileSystem.tmpDir); err != nil {
+		return nil, err
+	}
+
+	// The client is built after the options so any config overrides they carry
+	// reach the downloader and uploader too
+	s3Client := s3.New(sess, s3FileSystem.configs...)
+	s3FileSystem.s3 = s3Client
+	s3FileSystem.downloader = s3manager.NewDownloaderWithClient(s3Client,
+		func(d *s3manager.Downloader) {
+			if s3FileSystem.partSize != 0 {
+				d.PartSize = s3FileSystem.partSize
+			}
+			if s3FileSystem.workers != 0 {
+				d.Concurrency = s3FileSystem.workers
+			}
+		})
+	s3FileSystem.uploader = s3manager.NewUploaderWithClient(s3Client,
+		func(u *s3manager.Uploader) {
+			// A failed multipart upload aborts rather than leaving its parts
+			// behind, where they'd be charged for but never seen
+			u.LeavePartsOnError = false
+			if s3FileSystem.partSize != 0 {
+				u.PartSize = s3FileSystem.partSize
+			}
+			if s3FileSystem.workers != 0 {
+				u.Concurrency = s3FileSystem.workers
+			}
+		})
+	return s3FileSystem, nil
+}
+
+// Creates a `FileSystem` like `New`, but builds the session itself from the
+// environment and shared config, whose credentials are refreshed as they
+// expire. When region is empty the bucket's own region is found with
+// GetBucketLocation, rather than having requests to the wrong region refused
+// with a PermanentRedirect. Options like `Endpoint` apply to that lookup too.
+func NewFromConfig(
+	ctx context.Context,
+	bucket string,
+	region string,
+	opts ...func(*S3FileSystem),
+) (vfs.FileSystem, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if region == "" {
+		// The options are applied on their own first, to find the region with
+		// the same endpoint the `FileSystem` will use
+		probe := &S3FileSystem{}
+		for _, opt := range opts {
+			opt(probe)
+		}
+		configs := probe.configs
+		if aws.StringValue(sess.Config.Region) == "" {
+			// Any region can answer GetBucketLocation for any bucket
+			configs = append([]*aws.Config{{Region: aws.String("us-east-1")}}, configs...)
+		}
+		region, err = bucketRegion(ctx, s3.New(sess, configs...), bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return New(sess.Copy(&aws.Config{Region: aws.String(region)}), bucket, opts...)
+}
+
+// The region a bucket is in, from its location constraint
+func bucketRegion(ctx context.Context, client s3iface.S3API, bucket string) (string, error) {
+	resp, err := client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Finding the region of bucket %s: %w", bucket, err)
+	}
+	return s3.NormalizeBucketLocation(aws.StringValue(resp.LocationConstraint)), nil
 }
 
 func ACL(acl string) func(*S3FileSystem) {
@@ -60,6 +172,166 @@ func ACL(acl string) func(*S3FileSystem) {
 	}
 }
 
+// Encrypts every object written with the given server-side encryption
+// algorithm, either "AES256" or "aws:kms"
+func SSE(algorithm string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.sse = aws.String(algorithm)
+	}
+}
+
+// Sets the KMS key used to encrypt objects when using "aws:kms" `SSE`
+func SSEKMSKeyID(keyID string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.sseKMSKey = aws.String(keyID)
+	}
+}
+
+// Writes every object with the given storage class, such as "STANDARD_IA" or
+// "GLACIER"
+func StorageClass(class string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.storage = aws.String(class)
+	}
+}
+
+// Agrees to pay for requests to a requester-pays bucket, by sending
+// x-amz-request-payer with every request. Without it, such buckets refuse
+// everything with a 403.
+func RequesterPays(pays bool) func(*S3FileSystem) {
+	return func(s3fs *S3FileSystem) {
+		s3fs.payer = nil
+		if pays {
+			s3fs.payer = aws.String(s3.RequestPayerRequester)
+		}
+	}
+}
+
+// Sets the Cache-Control header served with every object written
+func CacheControl(cacheControl string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.cacheCtl = aws.String(cacheControl)
+	}
+}
+
+// Sets the Content-Disposition header served with every object written
+func ContentDisposition(disposition string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.dispose = aws.String(disposition)
+	}
+}
+
+// Attaches user metadata to every object written. Metadata given to
+// `CopyWithMetadata` takes precedence over these defaults.
+func Metadata(meta map[string]string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.metadata = aws.StringMap(meta)
+	}
+}
+
+// Decides the Content-Type of objects as they're written. When the resolver
+// returns an empty string, the type is guessed from the key's extension.
+func ContentType(resolver func(path string) string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.mimeType = resolver
+	}
+}
+
+// Talks to an S3-compatible service at the given URL instead of AWS, such as a
+// local MinIO server. Usually wants to be paired with `ForcePathStyle`.
+func Endpoint(endpoint string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.configs = append(fs.configs, &aws.Config{
+			Endpoint: aws.String(endpoint),
+		})
+	}
+}
+
+// Addresses the bucket in the path of requests (http://host/bucket/key) rather
+// than as a subdomain (http://bucket.host/key). Most S3-compatible services
+// don't support subdomains.
+func ForcePathStyle(force bool) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.configs = append(fs.configs, &aws.Config{
+			S3ForcePathStyle: aws.Bool(force),
+		})
+	}
+}
+
+// Makes `Open` return a reader which fetches only the bytes asked of it with
+// ranged GETs, rather than downloading the whole object to a temp file first.
+// Every Read and ReadAt is its own request, so this suits pulling a header out
+// of a huge object far better than reading one through with small buffers.
+// Nothing is cached.
+func LazyRange(lazy bool) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.lazyRange = lazy
+	}
+}
+
+// Makes `LazyRange` readers fetch size bytes at a time for Read, and fetch the
+// next chunk in the background while the current one is read, so reading an
+// object through stays fast without downloading all of it first. Reading stops
+// fetching as soon as the reader is closed. ReadAt still fetches just what it's
+// asked for.
+func ReadAhead(size int64) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.readAhead = size
+	}
+}
+
+// Gzips what `Create` writes when it's bigger than minSize bytes and its
+// Content-Type compresses well, like text, JSON, JavaScript, XML and SVG. The
+// object is stored with Content-Encoding: gzip, so browsers and most HTTP
+// clients decompress it transparently. `Copy` streams straight to S3 without
+// knowing the size up front, so it never compresses.
+//
+// S3 only knows the compressed object, so that's the size `Stat` and `Readdir`
+// report, and what `Open` reads unless `DecodeOnRead` is set.
+func GzipContent(minSize int64) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.gzip = true
+		fs.gzipMin = minSize
+	}
+}
+
+// Makes `Open` and `StreamOpen` decompress objects stored with
+// Content-Encoding: gzip, so they read back what was written. `Open` then
+// costs an extra HEAD request to find the encoding. `LazyRange` readers are
+// never decoded, since ranges of compressed bytes can't be decompressed alone.
+func DecodeOnRead(decode bool) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.decode = decode
+	}
+}
+
+// Sets the directory `Open` downloads to and `Create` buffers writes in,
+// instead of `os.TempDir()`. It needs room for the largest object transferred.
+func TmpDir(dir string) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.tmpDir = dir
+	}
+}
+
+// Sets the size in bytes of the parts used for multipart uploads and ranged
+// downloads. S3 allows at most 10,000 parts per upload, so the default of 5MB
+// caps objects at around 48GB; raise it to write anything bigger. It can't go
+// below 5MB.
+func PartSize(size int64) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.partSize = size
+	}
+}
+
+// Sets how many parts are transferred at once by each upload and download.
+// Every upload holds a part-sized buffer in memory for each of them, so memory
+// use grows as `PartSize` times `Concurrency` per write in flight.
+func Concurrency(n int) func(*S3FileSystem) {
+	return func(fs *S3FileSystem) {
+		fs.workers = n
+	}
+}
+
 func (s3fs *S3FileSystem) URL() *url.URL {
 	return &url.URL{
 		Scheme: "s3",
@@ -68,6 +340,36 @@ func (s3fs *S3FileSystem) URL() *url.URL {
 	}
 }
 
+// Returns a signed URL which can be used to GET the object at path until the
+// expiry elapses. Anyone with the URL can read the object.
+func (s3fs *S3FileSystem) PresignURL(
+	path string,
+	expiry time.Duration,
+) (string, error) {
+	req, _ := s3fs.s3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(s3fs.keyPath(path)),
+		RequestPayer: s3fs.payer,
+	})
+	return req.Presign(expiry)
+}
+
+// Returns a signed URL which can be used to PUT an object at path until the
+// expiry elapses, letting clients upload without going through this process.
+// The filesystem's ACL isn't part of the signature, so uploads made with the
+// URL get the bucket's default ACL.
+func (s3fs *S3FileSystem) PresignUpload(
+	path string,
+	expiry time.Duration,
+) (string, error) {
+	req, _ := s3fs.s3.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(s3fs.keyPath(path)),
+		RequestPayer: s3fs.payer,
+	})
+	return req.Presign(expiry)
+}
+
 type s3File struct {
 	tmp  *os.File
 	s3fs *S3FileSystem
@@ -78,258 +380,1354 @@ func (f *s3File) Write(p []byte) (int, error) {
 	return f.tmp.Write(p)
 }
 
+// Copies into the temp file with its own fast path
+func (f *s3File) ReadFrom(r io.Reader) (int64, error) {
+	return f.tmp.ReadFrom(r)
+}
+
+// Uploads the file, closing it whether or not the upload succeeds
 func (f *s3File) Close() error {
+	err := f.upload()
+	if closeErr := f.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Closes the file without uploading it, so nothing written is kept
+func (f *s3File) Abort() error {
+	return f.tmp.Close()
+}
+
+func (f *s3File) upload() error {
 	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
 
 	key := f.s3fs.keyPath(f.path)
-	_, err := f.s3fs.uploader.Upload(&s3manager.UploadInput{
-		ACL:         f.s3fs.acl,
-		Body:        f.tmp,
-		Bucket:      f.s3fs.bucket,
-		ContentType: aws.String(guessMimeTypeFromKey(key)),
-		Key:         aws.String(key),
+	input := f.s3fs.uploadInput(key, f.tmp)
+	if f.s3fs.shouldGzip(f.tmp, aws.StringValue(input.ContentType)) {
+		gz, err := gzipTempFile(f.s3fs.tmpDir, f.tmp)
+		if err != nil {
+			return s3Err("create", key, err)
+		}
+		defer gz.Close()
+		input.Body = gz
+		input.ContentEncoding = aws.String("gzip")
+	}
+	if _, err := f.s3fs.uploader.Upload(input); err != nil {
+		return s3Err("create", key, err)
+	}
+	return nil
+}
+
+// Removes an object from S3. Note that S3 will gladly delete a non-existant
+// object and return no error. This does a `Stat` before deleting to keep the
+// interface the same as other `FileSystem`s. If `Stat` returns a directory, a
+// '/' will be appended to the path to match the S3 key. A parent directory
+// left empty keeps a marker, which costs another listing per removal.
+func (s3fs *S3FileSystem) Remove(path string) error {
+	key := s3fs.keyPath(path)
+
+	if fi, err := s3fs.Stat(path); err != nil {
+		if pe, ok := err.(*os.PathError); ok {
+			pe.Op = "remove"
+		}
+		return err
+	} else if fi.IsDir() {
+		key = key + "/"
+	}
+
+	_, err := s3fs.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
 	})
+	if err != nil {
+		return s3Err("remove", key, err)
+	}
+
+	return s3fs.keepParent("remove", strings.TrimSuffix(key, "/"))
+}
 
+// The most keys a single `DeleteObjects` request will accept
+const deleteBatchSize = 1000
+
+// Removes the object at path along with every key beneath it, deleting them in
+// batches rather than one request per key. Like `os.RemoveAll`, removing a path
+// that doesn't exist is not an error. If any keys fail to delete, the rest are
+// still attempted and the failures are reported together.
+func (s3fs *S3FileSystem) RemoveAll(path string) error {
+	key := s3fs.keyPath(path)
+	dirPrefix := key + "/"
+	if key == "" {
+		dirPrefix = ""
+	}
+
+	var (
+		batch  []*s3.ObjectIdentifier
+		failed []string
+		delErr error
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		resp, err := s3fs.s3.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: s3fs.bucket,
+			Delete: &s3.Delete{
+				Objects: batch,
+				Quiet:   aws.Bool(true),
+			},
+			RequestPayer: s3fs.payer,
+		})
+		batch = nil
+		if err != nil {
+			delErr = err
+			return
+		}
+		for _, e := range resp.Errors {
+			failed = append(failed, fmt.Sprintf("%s (%s)",
+				aws.StringValue(e.Key), aws.StringValue(e.Message)))
+		}
+	}
+
+	err := s3fs.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		Prefix:       aws.String(key),
+		RequestPayer: s3fs.payer,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			// The prefix also matches siblings like "key1", so only take the key
+			// itself and what's beneath it
+			if *obj.Key != key && !strings.HasPrefix(*obj.Key, dirPrefix) {
+				continue
+			}
+			batch = append(batch, &s3.ObjectIdentifier{Key: obj.Key})
+			if len(batch) == deleteBatchSize {
+				flush()
+				if delErr != nil {
+					return false
+				}
+			}
+		}
+		return true
+	})
 	if err != nil {
-		return s3Err("create", key, err)
+		return s3Err("remove", key, err)
+	}
+	if delErr == nil {
+		flush()
+	}
+	if delErr != nil {
+		return s3Err("remove", key, delErr)
+	}
+
+	if len(failed) > 0 {
+		return s3Err("remove", key, fmt.Errorf(
+			"failed to delete %d keys: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	return s3fs.keepParent("remove", key)
+}
+
+// Creates a local file and uses the tmp file as the backing store for the
+// returned s3File.  when the s3File is closed it's uploaded to S3
+//
+// The writer must be closed. One that isn't holds its temp file open, and the
+// disk space it's using, until the garbage collector finalizes it.
+func (s3fs *S3FileSystem) Create(path string) (io.WriteCloser, error) {
+	if err := s3fs.checkFileKey("create", path); err != nil {
+		return nil, err
+	}
+	tmp, err := unlinkedTempFile(s3fs.tmpDir, pathpkg.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3File{
+		tmp:  tmp,
+		s3fs: s3fs,
+		path: path,
+	}, nil
+}
+
+// Creates a file like `Create`, but fails with `vfs.ErrExist` if a file or
+// directory is already at path. S3 can't make the upload conditional, so this
+// is a Stat followed by a `Create`: two writers racing to the same key can both
+// succeed, and the last to finish wins.
+func (s3fs *S3FileSystem) CreateExclusive(path string) (io.WriteCloser, error) {
+	_, err := s3fs.Stat(path)
+	switch {
+	case err == nil:
+		return nil, s3Err("create", s3fs.keyPath(path), vfs.ErrExist)
+	case !errors.Is(err, vfs.ErrNoFile):
+		if pe, ok := err.(*os.PathError); ok {
+			pe.Op = "create"
+		}
+		return nil, err
+	}
+	return s3fs.Create(path)
+}
+
+// Fails with `vfs.ErrIsDir` when path is a directory or, ending in a slash,
+// names one. Left to `keyPath`, the slash would be dropped and a file created.
+func (s3fs *S3FileSystem) checkFileKey(op, path string) error {
+	key := s3fs.keyPath(path)
+	if strings.HasSuffix(path, "/") {
+		return s3Err(op, key, vfs.ErrIsDir)
+	}
+	return s3fs.checkNotDir(op, key)
+}
+
+// Fails with `vfs.ErrIsDir` when there are keys beneath key. S3 would happily
+// store an object there too, leaving a file and a directory with one name.
+func (s3fs *S3FileSystem) checkNotDir(op, key string) error {
+	if key == "" {
+		return s3Err(op, key, vfs.ErrIsDir)
+	}
+	resp, err := s3fs.s3.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		MaxKeys:      aws.Int64(1),
+		Prefix:       aws.String(key + "/"),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		return s3Err(op, key, err)
+	}
+	if len(resp.Contents) > 0 {
+		return s3Err(op, key, vfs.ErrIsDir)
+	}
+	return nil
+}
+
+// Objects only appear in S3 once they've been completely uploaded, so `Create`
+// is already atomic
+func (s3fs *S3FileSystem) CreateAtomic(path string) (io.WriteCloser, error) {
+	return s3fs.Create(path)
+}
+
+// Copy will take an io.Reader and upload it directly to S3
+func (s3fs *S3FileSystem) Copy(destPath string, source io.Reader) error {
+	return s3fs.CopyWithMetadata(destPath, source, nil)
+}
+
+// Uploads an io.Reader directly to S3 like `Copy`, storing the given user
+// metadata with the object. It can be read back from the `ObjectInfo` in the
+// `Sys()` of the `os.FileInfo` returned by `Stat`.
+func (s3fs *S3FileSystem) CopyWithMetadata(
+	destPath string,
+	source io.Reader,
+	meta map[string]string,
+) error {
+	key := s3fs.keyPath(destPath)
+	if err := s3fs.checkFileKey("copy", destPath); err != nil {
+		return err
+	}
+	input := s3fs.uploadInput(key, source)
+	input.Metadata = s3fs.objectMetadata(meta)
+
+	if _, err := s3fs.uploader.Upload(input); err != nil {
+		return s3Err("copy", key, err)
+	}
+	return nil
+}
+
+// Uploads an io.Reader directly to S3 like `Copy`, but with the given
+// Content-Type rather than the one the `FileSystem` would pick
+func (s3fs *S3FileSystem) CopyWithContentType(
+	destPath string,
+	source io.Reader,
+	contentType string,
+) error {
+	key := s3fs.keyPath(destPath)
+	if err := s3fs.checkFileKey("copy", destPath); err != nil {
+		return err
+	}
+	input := s3fs.uploadInput(key, source)
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	if _, err := s3fs.uploader.Upload(input); err != nil {
+		return s3Err("copy", key, err)
+	}
+	return nil
+}
+
+// Copies the object at srcPath to destPath with an S3-to-S3 copy, so its bytes
+// never pass through the client the way they would going through `Open` and
+// `Copy`. Both paths are in this `FileSystem`'s bucket; objects can't be copied
+// between buckets this way. Like `Move`, the copy gets the Content-Type its key
+// resolves to and the source's user metadata. S3 copies at most 5GB in one
+// request.
+func (s3fs *S3FileSystem) CopyFrom(destPath, srcPath string) error {
+	srcKey := s3fs.keyPath(srcPath)
+	destKey := s3fs.keyPath(destPath)
+
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(srcKey),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return s3Err("copy", srcKey, vfs.ErrNoFile)
+		}
+		return s3Err("copy", srcKey, err)
+	}
+
+	if _, err := s3fs.s3.CopyObject(s3fs.moveInput(srcKey, destKey, head)); err != nil {
+		return s3Err("copy", destKey, err)
+	}
+	return nil
+}
+
+// Returned, wrapped in an `*os.PathError`, when S3 accepts a copy but its
+// result doesn't show the object was copied. The source is kept.
+var ErrUnconfirmedCopy = errors.New("Copy not confirmed")
+
+// Move will do an S3-to-S3 copy and remove the original. The copy replaces the
+// object's metadata, so the destination gets the Content-Type its own key
+// resolves to (keeping the source's when nothing resolves) along with the
+// source's user metadata. Moving a directory moves its marker, so one which
+// only exists because of the keys under it can't be moved, and fails with
+// `vfs.ErrNotSupported`.
+//
+// The source is only deleted once the copy's result confirms it, and then
+// directly, without the `Stat` of `Remove`, which could miss a key S3 hasn't
+// finished listing.
+func (s3fs *S3FileSystem) Move(srcPath, destPath string) error {
+	srcKey := s3fs.keyPath(srcPath)
+	destKey := s3fs.keyPath(destPath)
+
+	info, err := s3fs.Stat(srcPath)
+	if err != nil {
+		if pe, ok := err.(*os.PathError); ok {
+			pe.Op = "move"
+		}
+		return err
+	}
+	if info.IsDir() {
+		srcKey += "/"
+		destKey += "/"
+	}
+
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(srcKey),
+		RequestPayer: s3fs.payer,
+	})
+	switch {
+	case err == nil:
+	case isNotFound(err) && info.IsDir():
+		return s3Err("move", srcKey, vfs.ErrNotSupported)
+	case isNotFound(err):
+		return s3Err("move", srcKey, vfs.ErrNoFile)
+	default:
+		return s3Err("move", srcKey, err)
+	}
+
+	// Only the object which was looked at is copied, so its ETag can be
+	// checked against the copy's
+	input := s3fs.moveInput(srcKey, destKey, head)
+	input.CopySourceIfMatch = head.ETag
+	out, err := s3fs.s3.CopyObject(input)
+	if err != nil {
+		return s3Err("move", destKey, err)
+	}
+	if !s3fs.copyConfirmed(head, out) {
+		return s3Err("move", destKey, ErrUnconfirmedCopy)
+	}
+
+	_, err = s3fs.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(srcKey),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		return s3Err("move", srcKey, err)
+	}
+	return s3fs.keepParent("move", strings.TrimSuffix(srcKey, "/"))
+}
+
+// Whether the result of a copy shows it copied src. A copy only has the same
+// ETag as its source when both are MD5s of the content; when either isn't,
+// like a source uploaded in parts or a copy the bucket encrypted with KMS or a
+// customer's key, any ETag will do.
+func (s3fs *S3FileSystem) copyConfirmed(
+	src *s3.HeadObjectOutput,
+	out *s3.CopyObjectOutput,
+) bool {
+	if out == nil || out.CopyObjectResult == nil {
+		return false
+	}
+	etag := aws.StringValue(out.CopyObjectResult.ETag)
+	if etag == "" {
+		return false
+	}
+	if _, ok := etagMD5(src); !ok {
+		return true
+	}
+	if !md5Encryption(out.ServerSideEncryption, out.SSECustomerAlgorithm) {
+		return true
+	}
+	return etag == aws.StringValue(src.ETag)
+}
+
+// Creates an empty object at path if nothing is there. S3 can't set the time of
+// an existing object, but copying it over itself with its metadata replaced
+// makes its LastModified now, so that's done instead. Directories are left
+// alone.
+func (s3fs *S3FileSystem) Touch(path string) error {
+	key := s3fs.keyPath(path)
+
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
+	})
+	if isNotFound(err) {
+		if info, err := s3fs.Stat(path); err == nil && info.IsDir() {
+			return nil
+		}
+		return s3fs.Copy(path, bytes.NewReader(nil))
+	}
+	if err != nil {
+		return s3Err("touch", key, err)
+	}
+
+	delete(head.Metadata, modTimeMetadata)
+	_, err = s3fs.s3.CopyObject(s3fs.moveInput(key, key, head))
+	return s3Err("touch", key, err)
+}
+
+// The user metadata holding a modTime set by `Chtimes`, which `Stat` reports
+// in place of the object's LastModified
+const modTimeMetadata = "Mtime"
+
+// S3 can't set the LastModified of an object, so mtime is stored in its
+// metadata by copying it over itself. `Stat` reports it, but `Readdir` can't, as
+// listings leave out metadata. The atime is ignored, and directories are left
+// alone.
+func (s3fs *S3FileSystem) Chtimes(path string, atime, mtime time.Time) error {
+	key := s3fs.keyPath(path)
+
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
+	})
+	if isNotFound(err) {
+		if info, err := s3fs.Stat(path); err == nil && info.IsDir() {
+			return nil
+		}
+		return s3Err("chtimes", key, vfs.ErrNoFile)
+	}
+	if err != nil {
+		return s3Err("chtimes", key, err)
+	}
+
+	if head.Metadata == nil {
+		head.Metadata = map[string]*string{}
+	}
+	head.Metadata[modTimeMetadata] = aws.String(mtime.UTC().Format(time.RFC3339Nano))
+	_, err = s3fs.s3.CopyObject(s3fs.moveInput(key, key, head))
+	return s3Err("chtimes", key, err)
+}
+
+// Builds the copy for a `Move` or `CopyFrom`, carrying over what the source object had.
+// Replacing the metadata also resets the headers stored with it, so those the
+// `FileSystem` doesn't set itself are taken from the source too.
+func (s3fs *S3FileSystem) moveInput(
+	srcKey, destKey string,
+	src *s3.HeadObjectOutput,
+) *s3.CopyObjectInput {
+	contentType := s3fs.contentType(destKey)
+	if contentType == nil {
+		contentType = src.ContentType
+	}
+	cacheCtl := s3fs.cacheCtl
+	if cacheCtl == nil {
+		cacheCtl = src.CacheControl
+	}
+	dispose := s3fs.dispose
+	if dispose == nil {
+		dispose = src.ContentDisposition
+	}
+	var expires *time.Time
+	if t, err := http.ParseTime(aws.StringValue(src.Expires)); err == nil {
+		expires = aws.Time(t)
+	}
+
+	return &s3.CopyObjectInput{
+		ACL:                     s3fs.acl,
+		Bucket:                  s3fs.bucket,
+		CacheControl:            cacheCtl,
+		ContentDisposition:      dispose,
+		ContentEncoding:         src.ContentEncoding,
+		ContentLanguage:         src.ContentLanguage,
+		ContentType:             contentType,
+		CopySource:              aws.String(fmt.Sprintf("%s/%s", *s3fs.bucket, srcKey)),
+		Expires:                 expires,
+		Key:                     aws.String(destKey),
+		Metadata:                s3fs.objectMetadata(aws.StringValueMap(src.Metadata)),
+		MetadataDirective:       aws.String(s3.MetadataDirectiveReplace),
+		RequestPayer:            s3fs.payer,
+		SSEKMSKeyId:             s3fs.sseKMSKey,
+		ServerSideEncryption:    s3fs.sse,
+		StorageClass:            s3fs.storage,
+		WebsiteRedirectLocation: src.WebsiteRedirectLocation,
+	}
+}
+
+// Returns a file for reading. The caller is responsible for closing.
+//
+// The object is downloaded to a temp file first. If fewer bytes arrive than the
+// object's Content-Length, as when a connection drops without an error, it fails
+// with `vfs.ErrShortDownload` rather than returning a truncated file.
+func (s3fs *S3FileSystem) Open(path string) (vfs.ReadSeekCloser, error) {
+	if s3fs.lazyRange {
+		return s3fs.openRange(path)
+	}
+
+	key := s3fs.keyPath(path)
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, s3fs.openNotFound(key)
+		}
+		return nil, s3Err("open", key, err)
+	}
+
+	// Only the object which was sized is downloaded, so one replaced in between
+	// fails rather than looking short
+	req := &s3.GetObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		IfMatch:      head.ETag,
+		RequestPayer: s3fs.payer,
+	}
+	tmp, err := unlinkedTempFile(s3fs.tmpDir, pathpkg.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	n, err := s3fs.downloader.Download(tmp, req)
+	if err != nil {
+		tmp.Close()
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, s3Err("open", key, vfs.ErrNoFile)
+		}
+		return nil, s3Err("open", key, err)
+	}
+	if n != aws.Int64Value(head.ContentLength) {
+		tmp.Close()
+		return nil, s3Err("open", key, vfs.ErrShortDownload)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if s3fs.decode {
+		return s3fs.decodeTempFile(key, head, tmp)
+	}
+	return tempFileReader{tmp}, nil
+}
+
+// Reads a downloaded temp file, hiding its `*os.File` so it isn't taken for a
+// `vfs.Fder` on disk. The temp file is already unlinked.
+type tempFileReader struct {
+	vfs.ReadSeekCloser
+}
+
+// Copies from the temp file itself, so `io.Copy` can still hand it to the fast
+// path of a writer like an `*os.File`
+func (r tempFileReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, r.ReadSeekCloser)
+}
+
+// Why a key couldn't be opened: `vfs.ErrIsDir` when it's a directory, and
+// `vfs.ErrNoFile` otherwise
+func (s3fs *S3FileSystem) openNotFound(key string) error {
+	if err := s3fs.checkNotDir("open", key); err != nil {
+		return err
+	}
+	return s3Err("open", key, vfs.ErrNoFile)
+}
+
+// Decompresses a downloaded object into a temp file of its own when it's
+// stored gzipped, closing the download
+func (s3fs *S3FileSystem) decodeTempFile(
+	key string,
+	head *s3.HeadObjectOutput,
+	tmp *os.File,
+) (vfs.ReadSeekCloser, error) {
+	if aws.StringValue(head.ContentEncoding) != "gzip" {
+		return tempFileReader{tmp}, nil
+	}
+
+	defer tmp.Close()
+	gz, err := gzip.NewReader(tmp)
+	if err != nil {
+		return nil, s3Err("open", key, err)
+	}
+	decoded, err := unlinkedTempFile(s3fs.tmpDir, pathpkg.Base(key))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(decoded, gz); err != nil {
+		decoded.Close()
+		return nil, s3Err("open", key, err)
+	}
+	if _, err := decoded.Seek(0, io.SeekStart); err != nil {
+		decoded.Close()
+		return nil, err
+	}
+	return tempFileReader{decoded}, nil
+}
+
+// Returns the body of the object as it comes off the wire, without the temp
+// file `Open` downloads into first. This is much cheaper when only part of a
+// large object is read, but the reader can't Seek or ReadAt, and a connection
+// dropped mid-read surfaces as an error from Read. The caller is responsible
+// for closing.
+func (s3fs *S3FileSystem) StreamOpen(path string) (io.ReadCloser, error) {
+	key := s3fs.keyPath(path)
+	resp, err := s3fs.s3.GetObject(&s3.GetObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
+			return nil, s3Err("open", key, vfs.ErrNoFile)
+		}
+		return nil, s3Err("open", key, err)
+	}
+	if s3fs.decode && aws.StringValue(resp.ContentEncoding) == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, s3Err("open", key, err)
+		}
+		return &gzipReadCloser{gz, resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
+// Returns a reader over part of an object, fetching only those bytes with a
+// ranged GET. A range running past the end of the object is cut short there,
+// and one starting past it reads nothing. The bytes are as stored, so a
+// gzipped object isn't decoded, even with `DecodeOnRead`.
+func (s3fs *S3FileSystem) OpenRange(
+	path string,
+	off, length int64,
+) (io.ReadCloser, error) {
+	key := s3fs.keyPath(path)
+	if off < 0 || length < 0 {
+		return nil, s3Err("open", key, os.ErrInvalid)
+	}
+	// A Range can't ask for nothing, so the object is only checked for
+	if length == 0 {
+		if _, err := s3fs.Stat(path); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	// A length reaching past what an offset can hold reads to the end
+	byteRange := fmt.Sprintf("bytes=%d-", off)
+	if length <= math.MaxInt64-off {
+		byteRange += strconv.FormatInt(off+length-1, 10)
+	}
+	resp, err := s3fs.s3.GetObject(&s3.GetObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		Range:        aws.String(byteRange),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			switch awsErr.Code() {
+			case "NoSuchKey":
+				return nil, s3Err("open", key, vfs.ErrNoFile)
+			case "InvalidRange":
+				return ioutil.NopCloser(bytes.NewReader(nil)), nil
+			}
+		}
+		return nil, s3Err("open", key, err)
+	}
+	return resp.Body, nil
+}
+
+// Decompresses a body, closing both the decompressor and the body
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
+
+func (s3fs *S3FileSystem) openRange(path string) (vfs.ReadSeekCloser, error) {
+	key := s3fs.keyPath(path)
+	head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket:       s3fs.bucket,
+		Key:          aws.String(key),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, s3fs.openNotFound(key)
+		}
+		return nil, s3Err("open", key, err)
+	}
+
+	return &rangeReader{
+		s3fs:  s3fs,
+		key:   key,
+		size:  aws.Int64Value(head.ContentLength),
+		chunk: s3fs.readAhead,
+	}, nil
+}
+
+// Makes a directory by writing an empty marker object under the path with a
+// trailing slash. Fails with `vfs.ErrExist` if a file or directory is already
+// at the path.
+func (s3fs *S3FileSystem) Mkdir(path string) error {
+	key := s3fs.keyPath(path) + "/"
+
+	_, err := s3fs.Stat(path)
+	switch {
+	case err == nil:
+		return s3Err("mkdir", key, vfs.ErrExist)
+	case !errors.Is(err, vfs.ErrNoFile):
+		if pe, ok := err.(*os.PathError); ok {
+			err = pe.Err
+		}
+		return s3Err("mkdir", key, err)
+	}
+
+	return s3Err("mkdir", key, s3fs.putMarker(key))
+}
+
+// Writes the empty object which marks a directory, whose key ends in a slash
+func (s3fs *S3FileSystem) putMarker(key string) error {
+	_, err := s3fs.s3.PutObject(&s3.PutObjectInput{
+		ACL:                  s3fs.acl,
+		Bucket:               s3fs.bucket,
+		CacheControl:         s3fs.cacheCtl,
+		ContentDisposition:   s3fs.dispose,
+		Key:                  aws.String(key),
+		RequestPayer:         s3fs.payer,
+		SSEKMSKeyId:          s3fs.sseKMSKey,
+		ServerSideEncryption: s3fs.sse,
+		StorageClass:         s3fs.storage,
+	})
+	return err
+}
+
+// A directory in S3 only exists while there's a key beneath it, so one which
+// was made by writing a file into it would vanish along with its last file. A
+// marker is written in its place, so a directory stays until it's removed
+// itself, as it would on disk or in memory.
+func (s3fs *S3FileSystem) keepParent(op, key string) error {
+	parent := pathpkg.Dir(key)
+	if parent == "." || parent == "/" {
+		return nil
+	}
+
+	resp, err := s3fs.s3.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		MaxKeys:      aws.Int64(1),
+		Prefix:       aws.String(parent + "/"),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		return s3Err(op, key, err)
+	}
+	if len(resp.Contents) > 0 {
+		return nil
+	}
+	return s3Err(op, parent, s3fs.putMarker(parent+"/"))
+}
+
+// Stats a path. Files are found with a single `HeadObject` on the exact key.
+// S3 has no real concept of directories, so when that comes back as a 404 it
+// lists a single key under the path with a trailing slash. Any key there at
+// all, including an empty directory marker, makes the path a directory. Stat
+// is therefore at most two requests, no matter how many keys share the prefix.
+func (s3fs *S3FileSystem) Stat(path string) (os.FileInfo, error) {
+	key := s3fs.keyPath(path)
+
+	if key != "" {
+		head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+			Bucket:       s3fs.bucket,
+			Key:          aws.String(key),
+			RequestPayer: s3fs.payer,
+		})
+		if err == nil {
+			fileInfo := &s3FileInfo{
+				name:    pathpkg.Base(key),
+				size:    aws.Int64Value(head.ContentLength),
+				modTime: headModTime(head),
+				sys: &ObjectInfo{
+					ETag:         aws.StringValue(head.ETag),
+					StorageClass: storageClass(head.StorageClass),
+					ContentType:  aws.StringValue(head.ContentType),
+					Metadata:     aws.StringValueMap(head.Metadata),
+				},
+			}
+			return fileInfo, nil
+		}
+		if !isNotFound(err) {
+			return nil, s3Err("stat", key, err)
+		}
+	}
+
+	resp, err := s3fs.s3.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		MaxKeys:      aws.Int64(1),
+		Prefix:       aws.String(key + "/"),
+		RequestPayer: s3fs.payer,
+	})
+	if err != nil {
+		return nil, s3Err("stat", key, err)
+	}
+
+	if len(resp.Contents) > 0 {
+		fileInfo := &s3FileInfo{
+			name:  pathpkg.Base(key),
+			isDir: true,
+		}
+		return fileInfo, nil
+	}
+
+	return nil, s3Err("stat", key, vfs.ErrNoFile)
+}
+
+// Reads keys off S3 with a key prefixed by the given path, but no trailing '/'.
+// Results will be ordered by name
+func (s3fs *S3FileSystem) Readdir(path string) ([]os.FileInfo, error) {
+	return s3fs.readdir(path, true)
+}
+
+// Lists a directory like `Readdir` without sorting it. Each page of the listing
+// has its directories before its files, so names aren't in order.
+func (s3fs *S3FileSystem) ReaddirUnsorted(path string) ([]os.FileInfo, error) {
+	return s3fs.readdir(path, false)
+}
+
+func (s3fs *S3FileSystem) readdir(path string, sorted bool) ([]os.FileInfo, error) {
+	req := s3fs.readdirInput(path)
+
+	var found bool
+	var infos s3FileInfos
+	err := s3fs.s3.ListObjectsV2Pages(req,
+		func(page *s3.ListObjectsV2Output, _ bool) bool {
+			found = found || len(page.CommonPrefixes)+len(page.Contents) > 0
+			infos = append(infos, pageInfos(*req.Prefix, page)...)
+			return true
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, s3Err("open", *req.Prefix, vfs.ErrNoFile)
+	}
+
+	if sorted {
+		sort.Sort(infos)
+	}
+	fileInfos := make([]os.FileInfo, len(infos))
+	for i, info := range infos {
+		fileInfos[i] = info
+	}
+	return fileInfos, nil
+}
+
+// Lists every key beneath path in one paginated listing, rather than a
+// directory at a time like `Readdir`. Names are the rest of the key after
+// path, slashes and all, and are sorted. Directory markers are listed as
+// directories, without their trailing slash; directories which only exist
+// because keys are beneath them aren't listed at all.
+func (s3fs *S3FileSystem) ReaddirAll(path string) ([]os.FileInfo, error) {
+	req := s3fs.readdirInput(path)
+	req.Delimiter = nil
+
+	var found bool
+	var infos s3FileInfos
+	err := s3fs.s3.ListObjectsV2Pages(req,
+		func(page *s3.ListObjectsV2Output, _ bool) bool {
+			found = found || len(page.Contents) > 0
+			for _, info := range pageInfos(*req.Prefix, page) {
+				if strings.HasSuffix(info.name, "/") {
+					info.name = strings.TrimSuffix(info.name, "/")
+					info.isDir = true
+					info.sys = nil
+				}
+				infos = append(infos, info)
+			}
+			return true
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, s3Err("open", *req.Prefix, vfs.ErrNoFile)
 	}
 
-	return f.tmp.Close()
+	sort.Sort(infos)
+	fileInfos := make([]os.FileInfo, len(infos))
+	for i, info := range infos {
+		fileInfos[i] = info
+	}
+	return fileInfos, nil
 }
 
-// Removes an object from S3. Note that S3 will gladly delete a non-existant
-// object and return no error. This does a `Stat` before deleting to keep the
-// interface the same as other `FileSystem`s. If `Stat` returns a directory, a
-// '/' will be appended to the path to match the S3 key
-func (s3fs *S3FileSystem) Remove(path string) error {
-	key := s3fs.keyPath(path)
+// Returns the paths matching pattern like `vfs.Glob`, but with a single
+// listing of every key under the part of the pattern before its first
+// metacharacter, instead of reading the bucket a directory at a time. A
+// pattern like "logs/2024/*.json" only lists keys starting with "logs/2024/".
+// Matches are sorted, and directories implied by deeper keys match too.
+func (s3fs *S3FileSystem) Glob(pattern string) ([]string, error) {
+	if _, err := pathpkg.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	pattern = s3fs.keyPath(pattern)
+	depth := strings.Count(pattern, "/") + 1
 
-	if fi, err := s3fs.Stat(path); err != nil {
-		if pe, ok := err.(*os.PathError); ok {
-			pe.Op = "remove"
-		}
-		return err
-	} else if fi.IsDir() {
-		key = key + "/"
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
 	}
 
-	_, err := s3fs.s3.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: s3fs.bucket,
-		Key:    aws.String(key),
+	seen := map[string]bool{}
+	var matches []string
+	err := s3fs.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		Prefix:       aws.String(prefix),
+		RequestPayer: s3fs.payer,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			parts := strings.Split(strings.TrimSuffix(*obj.Key, "/"), "/")
+			if len(parts) < depth {
+				continue
+			}
+			key := strings.Join(parts[:depth], "/")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if ok, _ := pathpkg.Match(pattern, key); ok {
+				matches = append(matches, "/"+key)
+			}
+		}
+		return true
 	})
-
-	return s3Err("remove", key, err)
-}
-
-// Creates a local file and uses the tmp file as the backing store for the
-// returned s3File.  when the s3File is closed it's uploaded to S3
-func (s3fs *S3FileSystem) Create(path string) (io.WriteCloser, error) {
-	tmp, err := unlinkedTempFile(s3fs.tmpDir, pathpkg.Base(path))
 	if err != nil {
-		return nil, err
+		return nil, s3Err("glob", prefix, err)
 	}
 
-	return &s3File{
-		tmp:  tmp,
-		s3fs: s3fs,
-		path: path,
-	}, nil
+	sort.Strings(matches)
+	return matches, nil
 }
 
-// Copy will take an io.Reader and upload it directly to S3
-func (s3fs *S3FileSystem) Copy(destPath string, source io.Reader) error {
-	key := s3fs.keyPath(destPath)
-	_, err := s3fs.uploader.Upload(&s3manager.UploadInput{
-		ACL:         s3fs.acl,
-		Body:        source,
-		Bucket:      s3fs.bucket,
-		ContentType: aws.String(guessMimeTypeFromKey(key)),
-		Key:         aws.String(key),
-	})
+// Lists a single page of a directory, starting from the token returned with
+// the page before it, or "" for the first page. At most max entries come back,
+// or S3's own limit of 1,000 when max isn't positive. The next token is ""
+// once the listing is done. Like `ReaddirChan`, entries are sorted within a
+// page but not across pages, and a page can come back empty before the end of
+// the listing.
+func (s3fs *S3FileSystem) ReaddirPage(
+	path string,
+	token string,
+	max int,
+) ([]os.FileInfo, string, error) {
+	req := s3fs.readdirInput(path)
+	if token != "" {
+		req.ContinuationToken = aws.String(token)
+	}
+	if max > 0 {
+		req.MaxKeys = aws.Int64(int64(max))
+	}
 
+	page, err := s3fs.s3.ListObjectsV2(req)
 	if err != nil {
-		return s3Err("copy", key, err)
+		return nil, "", s3Err("open", *req.Prefix, err)
+	}
+	if token == "" && len(page.CommonPrefixes)+len(page.Contents) == 0 {
+		return nil, "", s3Err("open", *req.Prefix, vfs.ErrNoFile)
 	}
-	return nil
-}
 
-// Move will do an S3-to-S3 copy and remove the original
-func (s3fs *S3FileSystem) Move(srcPath, destPath string) error {
-	srcKey := s3fs.keyPath(srcPath)
-	destKey := s3fs.keyPath(destPath)
+	infos := pageInfos(*req.Prefix, page)
+	sort.Sort(infos)
+	fileInfos := make([]os.FileInfo, len(infos))
+	for i, info := range infos {
+		fileInfos[i] = info
+	}
 
-	if _, err := s3fs.s3.CopyObject(&s3.CopyObjectInput{
-		ACL:        s3fs.acl,
-		Bucket:     s3fs.bucket,
-		CopySource: aws.String(fmt.Sprintf("%s/%s", *s3fs.bucket, srcKey)),
-		Key:        aws.String(destKey),
-	}); err != nil {
-		return s3Err("move", destKey, err)
+	var next string
+	if aws.BoolValue(page.IsTruncated) {
+		next = aws.StringValue(page.NextContinuationToken)
 	}
+	return fileInfos, next, nil
+}
+
+// Streams the entries of a directory as each page of the listing comes back
+// from S3, so the whole listing is never held in memory. Entries are sorted
+// within a page, but S3 lists files and sub-directories separately, so the
+// stream as a whole may not be sorted by name. The error channel is sent at
+// most one error after the entries are closed. The entries must be drained.
+func (s3fs *S3FileSystem) ReaddirChan(
+	path string) (<-chan os.FileInfo, <-chan error) {
+
+	entries := make(chan os.FileInfo)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(entries)
+
+		req := s3fs.readdirInput(path)
+		var found bool
+		err := s3fs.s3.ListObjectsV2Pages(req,
+			func(page *s3.ListObjectsV2Output, _ bool) bool {
+				found = found || len(page.CommonPrefixes)+len(page.Contents) > 0
+				infos := pageInfos(*req.Prefix, page)
+				sort.Sort(infos)
+				for _, info := range infos {
+					entries <- info
+				}
+				return true
+			},
+		)
+
+		if err == nil && !found {
+			err = s3Err("open", *req.Prefix, vfs.ErrNoFile)
+		}
+		if err != nil {
+			errs <- err
+		}
+	}()
 
-	return s3Err("move", destKey, s3fs.Remove(srcPath))
+	return entries, errs
 }
 
-// Returns a file for reading. The caller is responsible for closing.
-func (s3fs *S3FileSystem) Open(path string) (vfs.ReadSeekCloser, error) {
-	req := &s3.GetObjectInput{
-		Bucket: s3fs.bucket,
-		Key:    aws.String(s3fs.keyPath(path)),
+// Checksums an object by streaming it through h. When h is MD5 and the object's
+// ETag is the MD5 of its content, the ETag is returned instead and nothing is
+// downloaded. That holds unless the object was uploaded in parts or encrypted
+// with KMS, or is gzipped and read with `DecodeOnRead`, when the ETag is of the
+// compressed bytes rather than what's read.
+func (s3fs *S3FileSystem) Checksum(path string, h hash.Hash) ([]byte, error) {
+	if reflect.TypeOf(h) == md5Type {
+		key := s3fs.keyPath(path)
+		head, err := s3fs.s3.HeadObject(&s3.HeadObjectInput{
+			Bucket:       s3fs.bucket,
+			Key:          aws.String(key),
+			RequestPayer: s3fs.payer,
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return nil, s3Err("open", key, vfs.ErrNoFile)
+			}
+			return nil, s3Err("open", key, err)
+		}
+		decoded := s3fs.decode && aws.StringValue(head.ContentEncoding) == "gzip"
+		if sum, ok := etagMD5(head); ok && !decoded {
+			return sum, nil
+		}
 	}
-	tmp, err := unlinkedTempFile(s3fs.tmpDir, pathpkg.Base(path))
+
+	r, err := s3fs.StreamOpen(path)
 	if err != nil {
 		return nil, err
 	}
-	if _, err = s3fs.downloader.Download(tmp, req); err != nil {
-		tmp.Close()
-		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchKey" {
-			return nil, s3Err("open", *req.Key, vfs.ErrNoFile)
-		}
-		return nil, s3Err("open", *req.Key, err)
-	}
-	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
-		tmp.Close()
+	defer r.Close()
+
+	if _, err := io.Copy(h, r); err != nil {
 		return nil, err
 	}
-	return tmp, nil
+	return h.Sum(nil), nil
 }
 
-// S3 has no directories. This will follow the general convention of creating an
-// empty file at the path with a trailing '/' in the name.
-func (s3fs *S3FileSystem) Mkdir(path string) error {
-	key := s3fs.keyPath(path) + "/"
-
-	_, err := s3fs.s3.PutObject(&s3.PutObjectInput{
-		ACL:    s3fs.acl,
-		Bucket: s3fs.bucket,
-		Key:    aws.String(key),
-	})
+var md5Type = reflect.TypeOf(md5.New())
 
-	return err
+// Whether an object encrypted this way has an MD5 of its content for an ETag,
+// which only unencrypted objects and those encrypted with S3's own keys do
+func md5Encryption(sse, customerAlgorithm *string) bool {
+	if aws.StringValue(customerAlgorithm) != "" {
+		return false
+	}
+	switch aws.StringValue(sse) {
+	case "", s3.ServerSideEncryptionAes256:
+		return true
+	default:
+		return false
+	}
 }
 
-// Stats a path. S3 has no real concept of directories, so it must do a list
-// operation with a prefix.  Heuristically determines if the key is a directory
-// by seeing if it ends with a slash.
-// Since we're not making the list request with a MaxKeys option we could find
-// ourselves iterating over a ridiculous amount of keys if we stat a path like:
-// "i" where there are a lot of keys that begin with "i".
-func (s3fs *S3FileSystem) Stat(path string) (os.FileInfo, error) {
-	key := s3fs.keyPath(path)
+// Decodes the ETag as an MD5 of the object's content, when it is one
+func etagMD5(head *s3.HeadObjectOutput) ([]byte, bool) {
+	if !md5Encryption(head.ServerSideEncryption, head.SSECustomerAlgorithm) {
+		return nil, false
+	}
 
-	req := &s3.ListObjectsV2Input{
-		Bucket:    s3fs.bucket,
-		Delimiter: aws.String("/"),
-		Prefix:    aws.String(key),
+	etag := strings.Trim(aws.StringValue(head.ETag), `"`)
+	if strings.Contains(etag, "-") {
+		return nil, false
 	}
 
-	var respCommonPrefixes []*s3.CommonPrefix
-	var respContents []*s3.Object
-	err := s3fs.s3.ListObjectsV2Pages(req,
-		func(page *s3.ListObjectsV2Output, _ bool) bool {
-			respCommonPrefixes = append(respCommonPrefixes, page.CommonPrefixes...)
-			respContents = append(respContents, page.Contents...)
-			return true
-		},
-	)
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != md5.Size {
+		return nil, false
+	}
+	return sum, true
+}
 
-	if err != nil {
-		return nil, s3Err("stat", key, err)
+// Sums the sizes of every object under path with a single listing, rather than
+// listing each directory in turn. A path which is a file gives its own size.
+func (s3fs *S3FileSystem) DiskUsage(path string) (int64, error) {
+	key := s3fs.keyPath(path)
+	prefix := key
+	if prefix != "" {
+		prefix += "/"
 	}
 
-	// Look for a directory
-	expectedDir := key + "/"
-	for _, prefix := range respCommonPrefixes {
-		if *prefix.Prefix == expectedDir {
-			fileInfo := &s3FileInfo{
-				name:  pathpkg.Base(*prefix.Prefix),
-				isDir: true,
-			}
-			return fileInfo, nil
+	var found bool
+	var total int64
+	err := s3fs.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		Prefix:       aws.String(prefix),
+		RequestPayer: s3fs.payer,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			found = true
+			total += aws.Int64Value(obj.Size)
 		}
+		return true
+	})
+	if err != nil {
+		return 0, s3Err("du", key, err)
+	}
+	if found {
+		return total, nil
 	}
 
-	// Look for a file
-	for _, obj := range respContents {
-		if *obj.Key == key {
-			fileInfo := &s3FileInfo{
-				name:    pathpkg.Base(*obj.Key),
-				size:    *obj.Size,
-				modTime: *obj.LastModified,
-			}
-			return fileInfo, nil
-		}
+	info, err := s3fs.Stat(path)
+	if err != nil {
+		return 0, err
 	}
+	return info.Size(), nil
+}
 
-	return nil, s3Err("stat", key, vfs.ErrNoFile)
+// S3 has no locks
+func (s3fs *S3FileSystem) Lock(path string) (vfs.Unlocker, error) {
+	return nil, s3Err("lock", s3fs.keyPath(path), vfs.ErrNotSupported)
 }
 
-// Reads keys off S3 with a key prefixed by the given path, but no trailing '/'.
-// Results will be ordered by name
-func (s3fs *S3FileSystem) Readdir(path string) ([]os.FileInfo, error) {
+func (s3fs *S3FileSystem) TryLock(path string) (vfs.Unlocker, bool, error) {
+	return nil, false, s3Err("lock", s3fs.keyPath(path), vfs.ErrNotSupported)
+}
+
+// S3 has no change notifications to watch
+func (s3fs *S3FileSystem) Watch(path string) (<-chan vfs.Event, func() error, error) {
+	return nil, nil, s3Err("watch", s3fs.keyPath(path), vfs.ErrNotSupported)
+}
+
+// Leaves out locking and watching, which only fail with `vfs.ErrNotSupported`
+func (s3fs *S3FileSystem) Capabilities() []vfs.Capability {
+	return []vfs.Capability{
+		vfs.CapAtomicCreate,
+		vfs.CapExclusiveCreate,
+		vfs.CapChtimes,
+		vfs.CapTouch,
+		vfs.CapRemoveAll,
+		vfs.CapReaddirStream,
+		vfs.CapReaddirUnsorted,
+		vfs.CapChecksum,
+		vfs.CapDiskUsage,
+		vfs.CapGlob,
+		vfs.CapPresign,
+		vfs.CapOpenRange,
+	}
+}
+
+// Lists the immediate children of a path
+func (s3fs *S3FileSystem) readdirInput(path string) *s3.ListObjectsV2Input {
 	key := s3fs.keyPath(path)
 	if !strings.HasSuffix(key, "/") && key != "" {
 		key += "/"
 	}
 
-	req := &s3.ListObjectsV2Input{
-		Bucket:    s3fs.bucket,
-		Delimiter: aws.String("/"),
-		Prefix:    aws.String(key),
-	}
-
-	var dirs []*s3.CommonPrefix
-	var files []*s3.Object
-	err := s3fs.s3.ListObjectsV2Pages(req,
-		func(page *s3.ListObjectsV2Output, _ bool) bool {
-			dirs = append(dirs, page.CommonPrefixes...)
-			files = append(files, page.Contents...)
-			return true
-		},
-	)
-
-	if err != nil {
-		return nil, err
+	return &s3.ListObjectsV2Input{
+		Bucket:       s3fs.bucket,
+		Delimiter:    aws.String("/"),
+		Prefix:       aws.String(key),
+		RequestPayer: s3fs.payer,
 	}
+}
 
+// Converts a page of a delimited listing under prefix to `FileInfo`s. The
+// directory's own marker object is left out.
+func pageInfos(prefix string, page *s3.ListObjectsV2Output) s3FileInfos {
 	var infos s3FileInfos
-	if len(dirs) == 0 && len(files) == 0 {
-		return nil, s3Err("open", key, vfs.ErrNoFile)
-	}
 
-	for _, dir := range dirs {
+	for _, dir := range page.CommonPrefixes {
 		name := strings.TrimSuffix(*dir.Prefix, "/")
-		name = strings.TrimPrefix(name, *req.Prefix)
+		name = strings.TrimPrefix(name, prefix)
 
 		infos = append(infos, &s3FileInfo{name: name, isDir: true})
 	}
-	for _, file := range files {
-		fileKey := strings.Replace(*file.Key, *req.Prefix, "", 1)
+	for _, file := range page.Contents {
+		fileKey := strings.Replace(*file.Key, prefix, "", 1)
 
 		if fileKey != "" {
 			infos = append(infos, &s3FileInfo{
 				name:    fileKey,
 				size:    *file.Size,
 				modTime: *file.LastModified,
-				sys:     file,
+				sys: &ObjectInfo{
+					ETag:         aws.StringValue(file.ETag),
+					StorageClass: storageClass(file.StorageClass),
+				},
 			})
 		}
 	}
 
-	sort.Sort(infos)
-	fileInfos := make([]os.FileInfo, len(infos))
-	for i, info := range infos {
-		fileInfos[i] = info
+	return infos
+}
+
+// Builds an upload of body to key with all the options set on the `FileSystem`
+func (s3fs *S3FileSystem) uploadInput(
+	key string,
+	body io.Reader,
+) *s3manager.UploadInput {
+	return &s3manager.UploadInput{
+		ACL:                  s3fs.acl,
+		Body:                 body,
+		Bucket:               s3fs.bucket,
+		CacheControl:         s3fs.cacheCtl,
+		ContentDisposition:   s3fs.dispose,
+		ContentType:          s3fs.contentType(key),
+		Key:                  aws.String(key),
+		Metadata:             s3fs.metadata,
+		RequestPayer:         s3fs.payer,
+		SSEKMSKeyId:          s3fs.sseKMSKey,
+		ServerSideEncryption: s3fs.sse,
+		StorageClass:         s3fs.storage,
 	}
-	return fileInfos, nil
+}
+
+// Resolves the Content-Type for a key, falling back to a guess from the
+// extension. Returns nil when neither knows, leaving S3 to use its default
+// rather than sending an empty header.
+func (s3fs *S3FileSystem) contentType(key string) *string {
+	var mimeType string
+	if s3fs.mimeType != nil {
+		mimeType = s3fs.mimeType(key)
+	}
+	if mimeType == "" {
+		mimeType = guessMimeTypeFromKey(key)
+	}
+	if mimeType == "" {
+		return nil
+	}
+	return aws.String(mimeType)
+}
+
+// Whether a file written by `Create` should be gzipped before it's uploaded
+func (s3fs *S3FileSystem) shouldGzip(tmp *os.File, contentType string) bool {
+	if !s3fs.gzip || !compressible(contentType) {
+		return false
+	}
+	info, err := tmp.Stat()
+	return err == nil && info.Size() > s3fs.gzipMin
+}
+
+// Content-Types which are text underneath, and so worth compressing
+var compressibleTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/json":         true,
+	"application/wasm":         true,
+	"application/x-javascript": true,
+	"application/xml":          true,
+	"image/svg+xml":            true,
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		compressibleTypes[mediaType]
+}
+
+// Gzips src into a new unlinked temp file, which is left at its start
+func gzipTempFile(dir string, src io.Reader) (*os.File, error) {
+	tmp, err := unlinkedTempFile(dir, "gzip")
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(tmp)
+	if _, err := io.Copy(gz, src); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// Merges the default metadata with the metadata for a single write
+func (s3fs *S3FileSystem) objectMetadata(
+	meta map[string]string,
+) map[string]*string {
+	if len(meta) == 0 {
+		return s3fs.metadata
+	}
+	merged := make(map[string]*string, len(s3fs.metadata)+len(meta))
+	for k, v := range s3fs.metadata {
+		merged[k] = v
+	}
+	for k, v := range meta {
+		merged[k] = aws.String(v)
+	}
+	return merged
 }
 
 func (s3fs *S3FileSystem) keyPath(path string) string {
 	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
 }
 
+// `HeadObject` has no body to carry an error code, so a missing key only shows
+// up as a 404
+func isNotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusNotFound
+	}
+	return false
+}
+
 func s3Err(op, key string, err error) error {
 	if err == nil {
 		return nil
@@ -355,6 +1753,210 @@ func unlinkedTempFile(dir, prefix string) (*os.File, error) {
 	return file, err
 }
 
+// Reads an object with a ranged GET for each Read or ReadAt. Seeking only moves
+// the offset the next Read starts from. With a chunk size, Read goes through
+// chunks fetched ahead of it instead.
+type rangeReader struct {
+	s3fs   *S3FileSystem
+	key    string
+	size   int64
+	offset int64
+
+	chunk int64
+	cur   *rangeChunk
+	next  *rangeChunk // being fetched in the background
+}
+
+// Part of an object, which can be read once done is closed
+type rangeChunk struct {
+	off    int64
+	data   []byte
+	err    error
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func (c *rangeChunk) contains(off int64) bool {
+	return off >= c.off && off < c.off+int64(len(c.data))
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.chunk > 0 {
+		return r.readChunked(p)
+	}
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) readChunked(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.cur == nil || !r.cur.contains(r.offset) {
+		if r.next != nil && r.next.off == r.offset {
+			r.cur, r.next = r.next, nil
+		} else {
+			// Seeked away from what was fetched ahead
+			r.drop()
+			r.cur = r.fetch(r.offset)
+		}
+		<-r.cur.done
+		if r.cur.err != nil {
+			err := r.cur.err
+			r.cur = nil
+			return 0, err
+		}
+	}
+
+	if end := r.cur.off + int64(len(r.cur.data)); r.next == nil && end < r.size {
+		r.next = r.fetch(end)
+	}
+
+	n := copy(p, r.cur.data[r.offset-r.cur.off:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// Starts fetching the chunk at off in the background
+func (r *rangeReader) fetch(off int64) *rangeChunk {
+	size := r.chunk
+	if off+size > r.size {
+		size = r.size - off
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &rangeChunk{off: off, done: make(chan struct{}), cancel: cancel}
+	go func() {
+		defer close(c.done)
+		data := make([]byte, size)
+		n, err := r.readAt(ctx, data, off)
+		c.data, c.err = data[:n], err
+	}()
+	return c
+}
+
+// Cancels and drops the chunk being fetched ahead, if there is one, once its
+// download has stopped
+func (r *rangeReader) drop() {
+	if r.next != nil {
+		r.next.cancel()
+		<-r.next.done
+		r.next = nil
+	}
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.readAt(context.Background(), p, off)
+}
+
+func (r *rangeReader) readAt(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, s3Err("read", r.key, errors.New("negative offset"))
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	resp, err := r.s3fs.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:       r.s3fs.bucket,
+		Key:          aws.String(r.key),
+		Range:        aws.String(fmt.Sprintf("bytes=%d-%d", off, end-1)),
+		RequestPayer: r.s3fs.payer,
+	})
+	if err != nil {
+		return 0, s3Err("read", r.key, err)
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, s3Err("seek", r.key, errors.New("invalid whence"))
+	}
+	if offset < 0 {
+		return 0, s3Err("seek", r.key, errors.New("negative position"))
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	r.drop()
+	r.cur = nil
+	return nil
+}
+
+// Makes sure a file can be created in the temp dir, rather than finding out
+// from a failed download
+func checkTmpDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{
+			Op:   "tmpdir",
+			Path: dir,
+			Err:  fmt.Errorf("Path '%s' is not a directory", dir),
+		}
+	}
+
+	tmp, err := unlinkedTempFile(dir, "vfs")
+	if err != nil {
+		return err
+	}
+	return tmp.Close()
+}
+
+// What S3 knows about an object beyond the `os.FileInfo`. The `Sys()` of a file
+// from `Stat` or `Readdir` is an `*ObjectInfo`; for a directory it's nil.
+// Listings don't include the content type or metadata, so those are only set
+// by `Stat`.
+type ObjectInfo struct {
+	ETag         string
+	StorageClass string
+	ContentType  string
+	Metadata     map[string]string
+}
+
+// The modTime stored by `Chtimes`, if there is one, or else LastModified
+func headModTime(head *s3.HeadObjectOutput) time.Time {
+	if mtime, ok := head.Metadata[modTimeMetadata]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, aws.StringValue(mtime)); err == nil {
+			return t
+		}
+	}
+	return aws.TimeValue(head.LastModified)
+}
+
+// HeadObject leaves out the storage class of STANDARD objects
+func storageClass(class *string) string {
+	if class == nil {
+		return s3.StorageClassStandard
+	}
+	return *class
+}
+
 type s3FileInfo struct {
 	name    string
 	size    int64
@@ -371,6 +1973,15 @@ func (fi *s3FileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *s3FileInfo) IsDir() bool        { return fi.isDir }
 func (fi *s3FileInfo) Sys() interface{}   { return fi.sys }
 
+// The Content-Type stored with the object. Only files from `Stat` have one, as
+// listings don't include it.
+func (fi *s3FileInfo) ContentType() string {
+	if info, ok := fi.sys.(*ObjectInfo); ok {
+		return info.ContentType
+	}
+	return ""
+}
+
 type s3FileInfos []*s3FileInfo
 
 func (s3fs s3FileInfos) Len() int { return len(s3fs) }
@@ -0,0 +1,43 @@
+package s3fs
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func largeObjectS3() *fakeS3 {
+	return newFakeS3(map[string][]byte{
+		"large.bin": make([]byte, 64*1024*1024),
+	})
+}
+
+func benchmarkRead(b *testing.B, fs *S3FileSystem) {
+	b.SetBytes(64 * 1024 * 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := fs.Open("/large.bin")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkOpenDownload(b *testing.B) {
+	fake := largeObjectS3()
+	fs := fake.fileSystem()
+	fs.tmpDir = b.TempDir()
+	fs.downloader = s3manager.NewDownloaderWithClient(fake)
+	benchmarkRead(b, fs)
+}
+
+func BenchmarkOpenReadAhead(b *testing.B) {
+	fs := largeObjectS3().fileSystem(LazyRange(true), ReadAhead(1024*1024))
+	benchmarkRead(b, fs)
+}
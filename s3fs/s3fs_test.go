@@ -1,10 +1,98 @@
 package s3fs
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	pathpkg "path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/vistarmedia/vfs"
 )
 
+// A session which can sign requests without ever talking to AWS
+func testSession() *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+}
+
+var _ = Describe("NewFromConfig", func() {
+	It("should use the region it's given", func() {
+		s3FileSystem, err := NewFromConfig(context.Background(), "bucket", "eu-west-2")
+		Expect(err).ToNot(HaveOccurred())
+
+		client := s3FileSystem.(*S3FileSystem).s3.(*s3.S3)
+		Expect(*client.Config.Region).To(Equal("eu-west-2"))
+	})
+
+	It("should look up the region when it isn't given", func() {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.URL.Path).To(Equal("/bucket"))
+				Expect(r.URL.Query()).To(HaveKey("location"))
+				fmt.Fprint(w, `<LocationConstraint>eu-central-1</LocationConstraint>`)
+			}))
+		defer server.Close()
+		for name, value := range map[string]string{
+			"AWS_ACCESS_KEY_ID":     "id",
+			"AWS_SECRET_ACCESS_KEY": "secret",
+		} {
+			if old, ok := os.LookupEnv(name); ok {
+				defer os.Setenv(name, old)
+			} else {
+				defer os.Unsetenv(name)
+			}
+			os.Setenv(name, value)
+		}
+
+		s3FileSystem, err := NewFromConfig(context.Background(), "bucket", "",
+			Endpoint(server.URL),
+			ForcePathStyle(true),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		client := s3FileSystem.(*S3FileSystem).s3.(*s3.S3)
+		Expect(*client.Config.Region).To(Equal("eu-central-1"))
+	})
+
+	It("should find the region of a bucket from its location", func() {
+		fake := newFakeS3(map[string][]byte{})
+
+		for location, region := range map[string]string{
+			"":               "us-east-1",
+			"EU":             "eu-west-1",
+			"ap-southeast-2": "ap-southeast-2",
+		} {
+			fake.location = location
+			Expect(bucketRegion(context.Background(), fake, "bucket")).
+				To(Equal(region), location)
+		}
+	})
+})
+
 var _ = Describe("ACL", func() {
 	It("should add acl option to S3FileSystem as a string pointer", func() {
 		s3FileSystem := &S3FileSystem{}
@@ -12,3 +100,1898 @@ var _ = Describe("ACL", func() {
 		Expect(*s3FileSystem.acl).To(Equal("public-read"))
 	})
 })
+
+var _ = Describe("RequesterPays", func() {
+	It("should set the request payer on S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		RequesterPays(true)(s3FileSystem)
+		Expect(*s3FileSystem.payer).To(Equal("requester"))
+
+		RequesterPays(false)(s3FileSystem)
+		Expect(s3FileSystem.payer).To(BeNil())
+	})
+
+	It("should send the request payer with requests", func() {
+		fake := newFakeS3(map[string][]byte{
+			"directory/child.txt": []byte("hi, child"),
+			"root.txt":            []byte("hi, root"),
+		})
+		fs := fake.fileSystem(RequesterPays(true))
+
+		_, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fs.Move("/root.txt", "/moved.txt")).To(Succeed())
+
+		for _, list := range fake.lists {
+			Expect(*list.RequestPayer).To(Equal("requester"))
+		}
+		for _, cp := range fake.copies {
+			Expect(*cp.RequestPayer).To(Equal("requester"))
+		}
+		Expect(fake.lists).ToNot(BeEmpty())
+		Expect(fake.copies).ToNot(BeEmpty())
+	})
+})
+
+var _ = Describe("SSE", func() {
+	It("should add the encryption algorithm to S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		SSE("aws:kms")(s3FileSystem)
+		Expect(*s3FileSystem.sse).To(Equal("aws:kms"))
+	})
+
+	It("should add the KMS key id to S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		SSEKMSKeyID("alias/vfs")(s3FileSystem)
+		Expect(*s3FileSystem.sseKMSKey).To(Equal("alias/vfs"))
+	})
+})
+
+var _ = Describe("StorageClass", func() {
+	It("should add storage class option to S3FileSystem as a string pointer", func() {
+		s3FileSystem := &S3FileSystem{}
+		StorageClass("STANDARD_IA")(s3FileSystem)
+		Expect(*s3FileSystem.storage).To(Equal("STANDARD_IA"))
+	})
+})
+
+var _ = Describe("Headers", func() {
+	It("should add cache control option to S3FileSystem as a string pointer", func() {
+		s3FileSystem := &S3FileSystem{}
+		CacheControl("max-age=3600")(s3FileSystem)
+		Expect(*s3FileSystem.cacheCtl).To(Equal("max-age=3600"))
+	})
+
+	It("should add content disposition option to S3FileSystem as a string pointer", func() {
+		s3FileSystem := &S3FileSystem{}
+		ContentDisposition("attachment")(s3FileSystem)
+		Expect(*s3FileSystem.dispose).To(Equal("attachment"))
+	})
+
+	It("should set the headers on uploads", func() {
+		s3FileSystem := &S3FileSystem{}
+		CacheControl("no-cache")(s3FileSystem)
+		ContentDisposition("inline")(s3FileSystem)
+
+		input := s3FileSystem.uploadInput("root.txt", nil)
+		Expect(*input.CacheControl).To(Equal("no-cache"))
+		Expect(*input.ContentDisposition).To(Equal("inline"))
+	})
+
+	It("should replace the metadata on Move so the headers apply", func() {
+		fake := newFakeS3(map[string][]byte{"root.txt": []byte("hi, root")})
+		fs := fake.fileSystem(CacheControl("no-cache"))
+
+		Expect(fs.Move("root.txt", "moved.txt")).To(Succeed())
+
+		Expect(fake.copies).To(HaveLen(1))
+		Expect(*fake.copies[0].CacheControl).To(Equal("no-cache"))
+		Expect(*fake.copies[0].MetadataDirective).To(Equal("REPLACE"))
+		Expect(*fake.copies[0].ContentType).To(HavePrefix("text/plain"))
+	})
+})
+
+var _ = Describe("Transfers", func() {
+	It("should configure the uploader and downloader", func() {
+		s3FileSystem, err := New(testSession(), "bucket",
+			PartSize(64*1024*1024),
+			Concurrency(2),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		fs := s3FileSystem.(*S3FileSystem)
+		uploader := fs.uploader.(*s3manager.Uploader)
+		Expect(uploader.PartSize).To(Equal(int64(64 * 1024 * 1024)))
+		Expect(uploader.Concurrency).To(Equal(2))
+		Expect(fs.downloader.PartSize).To(Equal(int64(64 * 1024 * 1024)))
+		Expect(fs.downloader.Concurrency).To(Equal(2))
+	})
+
+	It("should keep the defaults without options", func() {
+		s3FileSystem, err := New(testSession(), "bucket")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs := s3FileSystem.(*S3FileSystem)
+		uploader := fs.uploader.(*s3manager.Uploader)
+		Expect(uploader.PartSize).To(Equal(s3manager.DefaultUploadPartSize))
+		Expect(uploader.LeavePartsOnError).To(BeFalse())
+	})
+
+	It("should not accept a part size below the S3 minimum", func() {
+		_, err := New(testSession(), "bucket", PartSize(1024))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// Fails every upload, like one which dies part-way through
+type failingUploader struct {
+	s3manageriface.UploaderAPI
+}
+
+func (failingUploader) Upload(
+	*s3manager.UploadInput,
+	...func(*s3manager.Uploader),
+) (*s3manager.UploadOutput, error) {
+	return nil, errors.New("connection reset")
+}
+
+var _ = Describe("Create", func() {
+	It("should close the temp file when the upload fails", func() {
+		fs := newFakeS3(nil).fileSystem()
+		fs.uploader = failingUploader{}
+
+		w, err := fs.Create("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte("hi, root"))
+		Expect(err).ToNot(HaveOccurred())
+
+		err = w.Close()
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "create",
+			Path: "/root.txt",
+			Err:  errors.New("connection reset"),
+		}))
+
+		_, err = w.(*s3File).tmp.Write([]byte("more"))
+		Expect(errors.Is(err, os.ErrClosed)).To(BeTrue())
+	})
+
+	It("should count the bytes uploaded with CopyCounted", func() {
+		fake := newFakeS3(map[string][]byte{})
+		fs := fake.fileSystem()
+		fs.uploader = fakeUploader{f: fake}
+
+		n, err := vfs.CopyCounted(fs, "/root.txt", strings.NewReader("hi, root"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(8))
+		Expect(fake.objects["root.txt"]).To(HaveLen(8))
+	})
+
+	It("should copy into the temp file with io.Copy's fast path", func() {
+		fake := newFakeS3(map[string][]byte{})
+		fs := fake.fileSystem()
+		fs.uploader = fakeUploader{f: fake}
+
+		w, err := fs.Create("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		_, ok := w.(io.ReaderFrom)
+		Expect(ok).To(BeTrue())
+		Expect(io.Copy(w, strings.NewReader("hi, root"))).To(BeEquivalentTo(8))
+		Expect(w.Close()).To(Succeed())
+		Expect(fake.objects["root.txt"]).To(Equal([]byte("hi, root")))
+	})
+
+	It("should not upload a file aborted by CreateLimited", func() {
+		// Without an uploader, an upload panics
+		fake := newFakeS3(map[string][]byte{})
+		fs := fake.fileSystem()
+
+		w, err := vfs.CreateLimited(fs, "/upload.bin", 4)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte("hi, root"))
+		Expect(errors.Is(err, vfs.ErrTooLarge)).To(BeTrue())
+		Expect(errors.Is(w.Close(), vfs.ErrTooLarge)).To(BeTrue())
+
+		Expect(fake.objects).To(BeEmpty())
+	})
+
+	It("should not create or copy to a path with a trailing slash", func() {
+		fake := newFakeS3(map[string][]byte{})
+		fs := fake.fileSystem()
+
+		_, err := fs.Create("/new/")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "create",
+			Path: "/new",
+			Err:  vfs.ErrIsDir,
+		}))
+
+		err = fs.Copy("/new/", strings.NewReader("new"))
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "copy",
+			Path: "/new",
+			Err:  vfs.ErrIsDir,
+		}))
+		Expect(fake.objects).To(BeEmpty())
+	})
+
+	It("should not create or copy over a directory", func() {
+		fake := newFakeS3(map[string][]byte{
+			"directory/":        {},
+			"implied/child.txt": []byte("hi, child"),
+		})
+		fs := fake.fileSystem()
+
+		_, err := fs.Create("/directory")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "create",
+			Path: "/directory",
+			Err:  vfs.ErrIsDir,
+		}))
+
+		err = fs.Copy("/implied", strings.NewReader("shadow"))
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "copy",
+			Path: "/implied",
+			Err:  vfs.ErrIsDir,
+		}))
+		Expect(fake.objects).ToNot(HaveKey("implied"))
+	})
+})
+
+var _ = Describe("CreateExclusive", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{"directory/": {}})
+		fs = fake.fileSystem()
+		fs.uploader = fakeUploader{f: fake}
+	})
+
+	It("should fail the second time for the same path", func() {
+		w, err := fs.CreateExclusive("/lock")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte("mine"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+
+		_, err = fs.CreateExclusive("/lock")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "create",
+			Path: "/lock",
+			Err:  vfs.ErrExist,
+		}))
+		Expect(fake.objects["lock"]).To(Equal([]byte("mine")))
+	})
+
+	It("should not create over a directory", func() {
+		_, err := vfs.CreateExclusive(fs, "/directory")
+		Expect(errors.Is(err, vfs.ErrExist)).To(BeTrue())
+	})
+})
+
+func gzipped(content string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	gz.Close()
+	return buf.Bytes()
+}
+
+var _ = Describe("GzipContent", func() {
+	tempFile := func(content string) *os.File {
+		tmp, err := unlinkedTempFile("", "gzip-test")
+		Expect(err).ToNot(HaveOccurred())
+		tmp.WriteString(content)
+		tmp.Seek(0, io.SeekStart)
+		return tmp
+	}
+
+	It("should set the minimum size on S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		GzipContent(1024)(s3FileSystem)
+		Expect(s3FileSystem.gzip).To(BeTrue())
+		Expect(s3FileSystem.gzipMin).To(Equal(int64(1024)))
+	})
+
+	It("should set decoding on S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		DecodeOnRead(true)(s3FileSystem)
+		Expect(s3FileSystem.decode).To(BeTrue())
+	})
+
+	It("should only compress text-like content types", func() {
+		for _, contentType := range []string{
+			"text/html; charset=utf-8",
+			"text/css",
+			"application/json",
+			"application/javascript",
+			"application/ld+json",
+			"image/svg+xml",
+		} {
+			Expect(compressible(contentType)).To(BeTrue(), contentType)
+		}
+		for _, contentType := range []string{
+			"",
+			"image/png",
+			"application/gzip",
+			"application/octet-stream",
+		} {
+			Expect(compressible(contentType)).To(BeFalse(), contentType)
+		}
+	})
+
+	It("should only gzip files bigger than the minimum size", func() {
+		small, big := tempFile("small"), tempFile("big enough to gzip")
+		defer small.Close()
+		defer big.Close()
+
+		fs := newFakeS3(nil).fileSystem(GzipContent(10))
+		Expect(fs.shouldGzip(small, "text/plain")).To(BeFalse())
+		Expect(fs.shouldGzip(big, "text/plain")).To(BeTrue())
+		Expect(fs.shouldGzip(big, "image/png")).To(BeFalse())
+
+		fs = newFakeS3(nil).fileSystem()
+		Expect(fs.shouldGzip(big, "text/plain")).To(BeFalse())
+	})
+
+	It("should gzip a file into a temp file", func() {
+		gz, err := gzipTempFile("", strings.NewReader("hi, root"))
+		Expect(err).ToNot(HaveOccurred())
+		defer gz.Close()
+
+		r, err := gzip.NewReader(gz)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("hi, root")))
+	})
+
+	It("should decode gzipped objects when streamed with DecodeOnRead", func() {
+		fake := newFakeS3(map[string][]byte{"root.txt": gzipped("hi, root")})
+		fake.encs = map[string]string{"root.txt": "gzip"}
+
+		r, err := fake.fileSystem(DecodeOnRead(true)).StreamOpen("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("hi, root")))
+		Expect(r.Close()).To(Succeed())
+
+		r, err = fake.fileSystem().StreamOpen("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal(gzipped("hi, root")))
+	})
+
+	It("should decode a downloaded object which is gzipped", func() {
+		fake := newFakeS3(map[string][]byte{
+			"root.txt":  gzipped("hi, root"),
+			"plain.txt": []byte("plain"),
+		})
+		fake.encs = map[string]string{"root.txt": "gzip"}
+		fs := fake.fileSystem(DecodeOnRead(true))
+
+		gzipHead := &s3.HeadObjectOutput{ContentEncoding: aws.String("gzip")}
+		decoded, err := fs.decodeTempFile("root.txt", gzipHead,
+			tempFile(string(gzipped("hi, root"))))
+		Expect(err).ToNot(HaveOccurred())
+		defer decoded.Close()
+		Expect(ioutil.ReadAll(decoded)).To(Equal([]byte("hi, root")))
+
+		plain, err := fs.decodeTempFile("plain.txt", &s3.HeadObjectOutput{}, tempFile("plain"))
+		Expect(err).ToNot(HaveOccurred())
+		defer plain.Close()
+		Expect(ioutil.ReadAll(plain)).To(Equal([]byte("plain")))
+	})
+})
+
+var _ = Describe("StreamOpen", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{"root.txt": []byte("hi, root")})
+		fs = fake.fileSystem()
+	})
+
+	It("should stream the body of an object", func() {
+		r, err := fs.StreamOpen("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("hi, root")))
+		Expect(r.Close()).To(Succeed())
+		Expect(fake.gets).To(Equal([]string{"root.txt"}))
+	})
+
+	It("should return ErrNoFile for a missing object", func() {
+		_, err := fs.StreamOpen("/missing.txt")
+		Expect(errors.Is(err, vfs.ErrNoFile)).To(BeTrue())
+	})
+})
+
+var _ = Describe("TmpDir", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "s3fs-tmp")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should set the temp dir on S3FileSystem", func() {
+		s3FileSystem, err := New(testSession(), "bucket", TmpDir(dir))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s3FileSystem.(*S3FileSystem).tmpDir).To(Equal(dir))
+	})
+
+	It("should not accept a missing directory", func() {
+		_, err := New(testSession(), "bucket", TmpDir(dir+"/missing"))
+		Expect(err).To(HaveOccurred())
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should not accept a file", func() {
+		file := dir + "/file"
+		Expect(ioutil.WriteFile(file, []byte{}, 0666)).To(Succeed())
+
+		_, err := New(testSession(), "bucket", TmpDir(file))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not a directory"))
+	})
+})
+
+var _ = Describe("Metadata", func() {
+	It("should add default metadata to S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		Metadata(map[string]string{"origin": "vfs"})(s3FileSystem)
+		Expect(*s3FileSystem.metadata["origin"]).To(Equal("vfs"))
+	})
+
+	It("should let per-write metadata override the defaults", func() {
+		s3FileSystem := &S3FileSystem{}
+		Metadata(map[string]string{
+			"origin": "vfs",
+			"owner":  "nobody",
+		})(s3FileSystem)
+
+		meta := s3FileSystem.objectMetadata(map[string]string{"owner": "me"})
+		Expect(meta).To(HaveLen(2))
+		Expect(*meta["origin"]).To(Equal("vfs"))
+		Expect(*meta["owner"]).To(Equal("me"))
+		Expect(*s3FileSystem.metadata["owner"]).To(Equal("nobody"))
+	})
+
+	It("should send no metadata when none is configured", func() {
+		s3FileSystem := &S3FileSystem{}
+		Expect(s3FileSystem.objectMetadata(nil)).To(BeNil())
+	})
+})
+
+var _ = Describe("ContentType", func() {
+	It("should consult the resolver for the key being written", func() {
+		var resolved []string
+		s3FileSystem := &S3FileSystem{}
+		ContentType(func(path string) string {
+			resolved = append(resolved, path)
+			return "application/x-vfs"
+		})(s3FileSystem)
+
+		input := s3FileSystem.uploadInput("directory/child.txt", nil)
+		Expect(resolved).To(Equal([]string{"directory/child.txt"}))
+		Expect(*input.ContentType).To(Equal("application/x-vfs"))
+	})
+
+	It("should guess from the extension when the resolver returns nothing", func() {
+		s3FileSystem := &S3FileSystem{}
+		ContentType(func(string) string { return "" })(s3FileSystem)
+
+		Expect(*s3FileSystem.contentType("data.json")).To(Equal("application/json"))
+	})
+
+	It("should omit the content type when it can't be determined", func() {
+		s3FileSystem := &S3FileSystem{}
+		Expect(s3FileSystem.contentType("directory/no-extension")).To(BeNil())
+	})
+})
+
+var _ = Describe("Endpoint", func() {
+	It("should add an endpoint override to S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		Endpoint("http://localhost:9000")(s3FileSystem)
+		Expect(s3FileSystem.configs).To(HaveLen(1))
+		Expect(*s3FileSystem.configs[0].Endpoint).To(Equal("http://localhost:9000"))
+	})
+
+	It("should add a path-style override to S3FileSystem", func() {
+		s3FileSystem := &S3FileSystem{}
+		ForcePathStyle(true)(s3FileSystem)
+		Expect(s3FileSystem.configs).To(HaveLen(1))
+		Expect(*s3FileSystem.configs[0].S3ForcePathStyle).To(BeTrue())
+	})
+
+	It("should build the client against the endpoint", func() {
+		s3FileSystem, err := New(testSession(), "bucket",
+			Endpoint("http://localhost:9000"),
+			ForcePathStyle(true),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		url, err := s3FileSystem.(*S3FileSystem).PresignURL("root.txt", time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(url).To(HavePrefix("http://localhost:9000/bucket/root.txt?"))
+	})
+})
+
+var _ = Describe("Presign", func() {
+	var fs *S3FileSystem
+
+	BeforeEach(func() {
+		s3FileSystem, err := New(testSession(), "bucket")
+		Expect(err).ToNot(HaveOccurred())
+		fs = s3FileSystem.(*S3FileSystem)
+	})
+
+	It("should sign a download URL for the key", func() {
+		url, err := fs.PresignURL("/directory/child.txt", 15*time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(url).To(ContainSubstring("/directory/child.txt?"))
+		Expect(url).To(ContainSubstring("X-Amz-Expires=900"))
+		Expect(url).To(ContainSubstring("X-Amz-Signature="))
+	})
+
+	It("should sign an upload URL for the key", func() {
+		url, err := fs.PresignUpload("upload.txt", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(url).To(ContainSubstring("/upload.txt?"))
+		Expect(url).To(ContainSubstring("X-Amz-Expires=3600"))
+		Expect(url).To(ContainSubstring("X-Amz-Signature="))
+	})
+})
+
+var _ = Describe("Open", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt": []byte("hi, root"),
+		})
+		fs = fake.fileSystem()
+		fs.downloader = s3manager.NewDownloaderWithClient(fake)
+	})
+
+	It("should download the whole object", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("hi, root")))
+	})
+
+	It("should copy out of the temp file with io.Copy's fast path", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		_, ok := r.(io.WriterTo)
+		Expect(ok).To(BeTrue())
+
+		var out bytes.Buffer
+		Expect(io.Copy(&out, r)).To(BeEquivalentTo(len("hi, root")))
+		Expect(out.String()).To(Equal("hi, root"))
+	})
+
+	It("should not expose the temp file it downloads into", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		_, ok := r.(vfs.Fder)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should fail when fewer bytes arrive than the object has", func() {
+		fake.truncated = map[string]int{"root.txt": 3}
+
+		_, err := fs.Open("/root.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/root.txt",
+			Err:  vfs.ErrShortDownload,
+		}))
+		Expect(errors.Is(err, io.ErrUnexpectedEOF)).To(BeTrue())
+	})
+
+	It("should not open a missing file", func() {
+		_, err := fs.Open("/missing.txt")
+		Expect(errors.Is(err, vfs.ErrNoFile)).To(BeTrue())
+	})
+
+	It("should not open a directory, with or without a trailing slash", func() {
+		fake.objects["directory/"] = []byte{}
+
+		for _, path := range []string{"/directory", "/directory/"} {
+			_, err := fs.Open(path)
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "open",
+				Path: "/directory",
+				Err:  vfs.ErrIsDir,
+			}))
+		}
+	})
+})
+
+var _ = Describe("OpenRange", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt": []byte("hi, root"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	read := func(off, length int64) string {
+		r, err := vfs.OpenRange(fs, "/root.txt", off, length)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		content, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		return string(content)
+	}
+
+	It("should only fetch the requested bytes", func() {
+		Expect(read(2, 3)).To(Equal(", r"))
+		Expect(fake.ranges).To(Equal([]string{"bytes=2-4"}))
+	})
+
+	It("should cut a range short at the end of the object", func() {
+		Expect(read(4, 100)).To(Equal("root"))
+		Expect(read(4, math.MaxInt64)).To(Equal("root"))
+		Expect(fake.ranges).To(Equal([]string{"bytes=4-103", "bytes=4-"}))
+	})
+
+	It("should read nothing past the end of the object", func() {
+		Expect(read(100, 3)).To(BeEmpty())
+		Expect(read(2, 0)).To(BeEmpty())
+	})
+
+	It("should not open a missing object", func() {
+		_, err := fs.OpenRange("/missing.txt", 0, 3)
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  vfs.ErrNoFile,
+		}))
+
+		_, err = fs.OpenRange("/missing.txt", 0, 0)
+		Expect(errors.Is(err, vfs.ErrNoFile)).To(BeTrue())
+	})
+})
+
+var _ = Describe("AsIOFS", func() {
+	It("should only fetch the bytes of a Range request", func() {
+		content := bytes.Repeat([]byte("0123456789"), 1000)
+		fake := newFakeS3(map[string][]byte{"media/large.bin": content})
+		fsys := vfs.AsIOFS(fake.fileSystem())
+
+		req := httptest.NewRequest("GET", "/media/large.bin", nil)
+		req.Header.Set("Range", "bytes=1000-2000")
+		resp := httptest.NewRecorder()
+		http.FileServer(http.FS(fsys)).ServeHTTP(resp, req)
+
+		Expect(resp.Code).To(Equal(http.StatusPartialContent))
+		Expect(resp.Body.Bytes()).To(Equal(content[1000:2001]))
+		Expect(fake.ranges).To(Equal([]string{"bytes=1000-2000"}))
+		Expect(fake.gets).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("LazyRange", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt": []byte("hi, root"),
+		})
+		fs = fake.fileSystem(LazyRange(true))
+	})
+
+	It("should only fetch the requested range on ReadAt", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+
+		buf := make([]byte, 5)
+		n, err := r.ReadAt(buf, 3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(5))
+		Expect(string(buf)).To(Equal(" root"))
+		Expect(fake.ranges).To(Equal([]string{"bytes=3-7"}))
+	})
+
+	It("should clamp reads to the end of the object", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := make([]byte, 10)
+		n, err := r.ReadAt(buf, 4)
+		Expect(err).To(Equal(io.EOF))
+		Expect(string(buf[:n])).To(Equal("root"))
+		Expect(fake.ranges).To(Equal([]string{"bytes=4-7"}))
+	})
+
+	It("should read from wherever it has been seeked to", func() {
+		r, err := fs.Open("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = r.Seek(-4, io.SeekEnd)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.ranges).To(BeEmpty())
+
+		bs, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(bs)).To(Equal("root"))
+	})
+
+	It("should not open a missing file", func() {
+		_, err := fs.Open("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  vfs.ErrNoFile,
+		}))
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ReadAhead", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"alphabet.txt": []byte("abcdefghijklmnopqrstuvwxyz"),
+		})
+		fs = fake.fileSystem(LazyRange(true), ReadAhead(10))
+	})
+
+	It("should read an object through in chunks", func() {
+		r, err := fs.Open("/alphabet.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+
+		buf := make([]byte, 3)
+		var read []byte
+		for {
+			n, err := r.Read(buf)
+			read = append(read, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(string(read)).To(Equal("abcdefghijklmnopqrstuvwxyz"))
+		Expect(fake.ranges).To(Equal([]string{
+			"bytes=0-9", "bytes=10-19", "bytes=20-25",
+		}))
+	})
+
+	It("should stop fetching once closed", func() {
+		r, err := fs.Open("/alphabet.txt")
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := make([]byte, 3)
+		Expect(r.Read(buf)).To(Equal(3))
+		Expect(r.Close()).To(Succeed())
+
+		// The first chunk and the one fetched ahead of it
+		Expect(fake.ranges).To(Equal([]string{"bytes=0-9", "bytes=10-19"}))
+	})
+
+	It("should cancel the chunk being fetched ahead when closed", func() {
+		fake.stalled = map[string]bool{"alphabet.txt": true}
+		r, err := fs.Open("/alphabet.txt")
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := make([]byte, 3)
+		Expect(r.Read(buf)).To(Equal(3))
+
+		closed := make(chan error)
+		go func() { closed <- r.Close() }()
+		Eventually(closed).Should(Receive(BeNil()))
+	})
+
+	It("should fetch from wherever it has been seeked to", func() {
+		r, err := fs.Open("/alphabet.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+
+		buf := make([]byte, 3)
+		Expect(r.Read(buf)).To(Equal(3))
+
+		_, err = r.Seek(-4, io.SeekEnd)
+		Expect(err).ToNot(HaveOccurred())
+		bs, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(bs)).To(Equal("wxyz"))
+		Expect(fake.ranges).To(ContainElement("bytes=22-25"))
+	})
+
+	It("should still fetch just what ReadAt asks for", func() {
+		r, err := fs.Open("/alphabet.txt")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+
+		buf := make([]byte, 2)
+		Expect(r.ReadAt(buf, 5)).To(Equal(2))
+		Expect(string(buf)).To(Equal("fg"))
+		Expect(fake.ranges).To(Equal([]string{"bytes=5-6"}))
+	})
+})
+
+var _ = Describe("Remove", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":          []byte("hi, root"),
+			"implied/only.txt":  []byte("only"),
+			"directory/a.txt":   []byte("a"),
+			"directory/b.txt":   []byte("b"),
+			"nested/sub/c.txt":  []byte("c"),
+			"marked/":           {},
+			"marked/marked.txt": []byte("marked"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	It("should keep a directory emptied of its last file", func() {
+		Expect(fs.Remove("/implied/only.txt")).To(Succeed())
+
+		Expect(fake.objects).To(HaveKey("implied/"))
+		info, err := fs.Stat("/implied")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+		Expect(fs.Readdir("/implied")).To(BeEmpty())
+	})
+
+	It("should not mark a directory which still has keys", func() {
+		Expect(fs.Remove("/directory/a.txt")).To(Succeed())
+		Expect(fake.objects).ToNot(HaveKey("directory/"))
+
+		Expect(fs.Remove("/marked/marked.txt")).To(Succeed())
+		Expect(fake.objects).To(HaveKey("marked/"))
+		Expect(fake.objects).To(HaveLen(5))
+	})
+
+	It("should not mark the root", func() {
+		Expect(fs.Remove("/root.txt")).To(Succeed())
+		Expect(fake.objects).ToNot(HaveKey("/"))
+		Expect(fake.objects).ToNot(HaveKey(""))
+	})
+
+	It("should keep the parent of a directory removed with RemoveAll", func() {
+		Expect(fs.RemoveAll("/nested/sub")).To(Succeed())
+
+		Expect(fake.objects).To(HaveKey("nested/"))
+		Expect(fs.Readdir("/nested")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("RemoveAll", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		objects := map[string][]byte{
+			"large_directory/":  {},
+			"large_directory1":  []byte("sibling"),
+			"root.txt":          []byte("hi, root"),
+			"directory/":        {},
+			"directory/a.txt":   []byte("a"),
+			"directory/sub/":    {},
+			"directory/sub/b/c": []byte("c"),
+		}
+		for i := 1; i <= 1500; i++ {
+			objects[fmt.Sprintf("large_directory/%04d", i)] = []byte{}
+		}
+		fake = newFakeS3(objects)
+		fs = fake.fileSystem()
+	})
+
+	It("should clear a prefix in batches of 1000", func() {
+		Expect(fs.RemoveAll("/large_directory")).To(Succeed())
+
+		Expect(fake.deletes).To(HaveLen(2))
+		Expect(fake.deletes[0]).To(HaveLen(1000))
+		Expect(fake.deletes[1]).To(HaveLen(501))
+		Expect(fake.objects).To(HaveLen(6))
+		Expect(fake.objects).To(HaveKey("large_directory1"))
+	})
+
+	It("should remove nested keys and the directory marker", func() {
+		Expect(fs.RemoveAll("directory")).To(Succeed())
+
+		Expect(fake.objects).NotTo(HaveKey("directory/"))
+		Expect(fake.objects).NotTo(HaveKey("directory/sub/b/c"))
+		Expect(fake.objects).To(HaveKey("root.txt"))
+	})
+
+	It("should remove a single file", func() {
+		Expect(fs.RemoveAll("root.txt")).To(Succeed())
+		Expect(fake.objects).NotTo(HaveKey("root.txt"))
+	})
+
+	It("should not fail on a missing path", func() {
+		Expect(fs.RemoveAll("missing")).To(Succeed())
+		Expect(fake.deletes).To(BeEmpty())
+	})
+
+	It("should report the keys which failed to delete", func() {
+		fake.undeletable = map[string]bool{"directory/a.txt": true}
+
+		err := fs.RemoveAll("directory")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("directory/a.txt"))
+		Expect(fake.objects).NotTo(HaveKey("directory/sub/b/c"))
+	})
+
+	It("should be used by vfs.RemoveAll", func() {
+		Expect(vfs.RemoveAll(fs, "directory")).To(Succeed())
+		Expect(fake.deletes).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("CopyFrom", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt": []byte("hi, root"),
+		})
+		fake.meta = map[string]map[string]string{"root.txt": {"origin": "vfs"}}
+		fs = fake.fileSystem()
+	})
+
+	It("should copy server-side and keep the source", func() {
+		Expect(fs.CopyFrom("/directory/root.json", "/root.txt")).To(Succeed())
+
+		Expect(fake.gets).To(BeEmpty())
+		Expect(fake.copies).To(HaveLen(1))
+		input := fake.copies[0]
+		Expect(*input.CopySource).To(Equal("bucket/root.txt"))
+		Expect(*input.Key).To(Equal("directory/root.json"))
+		Expect(*input.ContentType).To(Equal("application/json"))
+		Expect(*input.Metadata["origin"]).To(Equal("vfs"))
+
+		Expect(fake.objects["root.txt"]).To(Equal([]byte("hi, root")))
+		Expect(fake.objects["directory/root.json"]).To(Equal([]byte("hi, root")))
+	})
+
+	It("should not copy a missing file", func() {
+		err := fs.CopyFrom("/copied.txt", "/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "copy",
+			Path: "/missing.txt",
+			Err:  vfs.ErrNoFile,
+		}))
+		Expect(fake.copies).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Move", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":        []byte("hi, root"),
+			"blob":            []byte("{}"),
+			"directory/":      {},
+			"directory/a.txt": []byte("a"),
+		})
+		fake.types = map[string]string{"blob": "application/x-blob"}
+		fake.meta = map[string]map[string]string{"root.txt": {"origin": "vfs"}}
+		fs = fake.fileSystem()
+	})
+
+	It("should resolve the content type of the destination key", func() {
+		Expect(fs.Move("root.txt", "directory/root.json")).To(Succeed())
+
+		Expect(fake.copies).To(HaveLen(1))
+		input := fake.copies[0]
+		Expect(*input.CopySource).To(Equal("bucket/root.txt"))
+		Expect(*input.Key).To(Equal("directory/root.json"))
+		Expect(*input.ContentType).To(Equal("application/json"))
+		Expect(*input.MetadataDirective).To(Equal("REPLACE"))
+		Expect(*input.Metadata["origin"]).To(Equal("vfs"))
+
+		Expect(fake.objects).NotTo(HaveKey("root.txt"))
+		Expect(fake.objects).To(HaveKey("directory/root.json"))
+	})
+
+	It("should keep the source content type when nothing resolves", func() {
+		Expect(fs.Move("blob", "other-blob")).To(Succeed())
+
+		Expect(*fake.copies[0].ContentType).To(Equal("application/x-blob"))
+	})
+
+	It("should move a directory marker", func() {
+		Expect(fs.Move("/directory", "/renamed")).To(Succeed())
+
+		Expect(*fake.copies[0].CopySource).To(Equal("bucket/directory/"))
+		Expect(*fake.copies[0].Key).To(Equal("renamed/"))
+		Expect(fake.objects).To(HaveKey("renamed/"))
+		Expect(fake.objects).NotTo(HaveKey("directory/"))
+	})
+
+	It("should not move a directory without a marker", func() {
+		fake.objects["implied/a.txt"] = []byte("a")
+
+		err := fs.Move("/implied", "/renamed")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "move",
+			Path: "/implied",
+			Err:  vfs.ErrNotSupported,
+		}))
+		Expect(fake.copies).To(BeEmpty())
+		Expect(fake.objects).To(HaveKey("implied/a.txt"))
+	})
+
+	It("should not move a missing file", func() {
+		err := fs.Move("missing.txt", "moved.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "move",
+			Path: "/missing.txt",
+			Err:  vfs.ErrNoFile,
+		}))
+		Expect(fake.copies).To(BeEmpty())
+	})
+
+	It("should only copy the source it looked at", func() {
+		Expect(fs.Move("root.txt", "moved.txt")).To(Succeed())
+
+		Expect(*fake.copies[0].CopySourceIfMatch).To(Equal(fake.etag("moved.txt")))
+		Expect(fake.objects).NotTo(HaveKey("root.txt"))
+	})
+
+	It("should keep the source when the copy isn't confirmed", func() {
+		fake.copyResults = map[string]string{"moved.txt": `"other"`}
+
+		err := fs.Move("root.txt", "moved.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "move",
+			Path: "/moved.txt",
+			Err:  ErrUnconfirmedCopy,
+		}))
+		Expect(fake.objects).To(HaveKey("root.txt"))
+	})
+
+	It("should accept any ETag for a copy the bucket encrypts with KMS", func() {
+		for _, sse := range []string{"aws:kms", "aws:kms:dsse"} {
+			fake.objects["root.txt"] = []byte("hi, root")
+			fake.copySSE = sse
+			fake.copyResults = map[string]string{"moved.txt": `"def"`}
+
+			Expect(fs.Move("root.txt", "moved.txt")).To(Succeed(), sse)
+			Expect(fake.objects).NotTo(HaveKey("root.txt"))
+		}
+	})
+
+	It("should accept any ETag for a copy encrypted with a customer's key", func() {
+		src := &s3.HeadObjectOutput{ETag: aws.String(fake.etag("root.txt"))}
+		out := &s3.CopyObjectOutput{
+			CopyObjectResult:     &s3.CopyObjectResult{ETag: aws.String(`"def"`)},
+			SSECustomerAlgorithm: aws.String("AES256"),
+		}
+		Expect(fs.copyConfirmed(src, out)).To(BeTrue())
+
+		out.SSECustomerAlgorithm = nil
+		Expect(fs.copyConfirmed(src, out)).To(BeFalse())
+	})
+
+	It("should accept any ETag for a source uploaded in parts", func() {
+		fake.etags = map[string]string{"root.txt": `"abc-2"`}
+		fake.copyResults = map[string]string{"moved.txt": `"def"`}
+
+		Expect(fs.Move("root.txt", "moved.txt")).To(Succeed())
+		Expect(fake.objects).NotTo(HaveKey("root.txt"))
+	})
+
+	It("should keep a gzipped object's Content-Encoding", func() {
+		fake.objects["page.html"] = gzipped("<p>hi</p>")
+		fake.encs = map[string]string{"page.html": "gzip"}
+
+		Expect(fs.Move("page.html", "moved.html")).To(Succeed())
+
+		Expect(*fake.copies[0].ContentEncoding).To(Equal("gzip"))
+		Expect(fake.encs).To(HaveKeyWithValue("moved.html", "gzip"))
+	})
+
+	It("should keep the headers replacing the metadata would reset", func() {
+		fake.objects["page.html"] = []byte("<p>hi</p>")
+		fake.heads = map[string]*s3.HeadObjectOutput{"page.html": {
+			CacheControl:            aws.String("max-age=60"),
+			ContentDisposition:      aws.String("inline"),
+			ContentLanguage:         aws.String("en"),
+			Expires:                 aws.String("Wed, 21 Oct 2015 07:28:00 GMT"),
+			WebsiteRedirectLocation: aws.String("/elsewhere.html"),
+		}}
+
+		Expect(fs.Move("page.html", "moved.html")).To(Succeed())
+
+		input := fake.copies[0]
+		Expect(*input.CacheControl).To(Equal("max-age=60"))
+		Expect(*input.ContentDisposition).To(Equal("inline"))
+		Expect(*input.ContentLanguage).To(Equal("en"))
+		Expect(*input.Expires).To(BeTemporally("==",
+			time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)))
+		Expect(*input.WebsiteRedirectLocation).To(Equal("/elsewhere.html"))
+	})
+
+	It("should keep the source's directory", func() {
+		Expect(fs.Move("directory/a.txt", "a.txt")).To(Succeed())
+
+		Expect(fake.objects).NotTo(HaveKey("directory/a.txt"))
+		Expect(fake.objects).To(HaveKey("directory/"))
+	})
+})
+
+var _ = Describe("Stat", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		objects := map[string][]byte{
+			"root.txt":        []byte("hi, root"),
+			"directory/a.txt": []byte("a"),
+			"empty/":          {},
+		}
+		for i := 1; i <= 1100; i++ {
+			objects[fmt.Sprintf("directory%04d", i)] = []byte{}
+		}
+		fake = newFakeS3(objects)
+		fs = fake.fileSystem()
+	})
+
+	It("should stat a file without listing", func() {
+		info, err := fs.Stat("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeFalse())
+		Expect(info.Size()).To(Equal(int64(8)))
+		Expect(fake.lists).To(BeEmpty())
+	})
+
+	It("should find a directory with a single bounded list", func() {
+		info, err := fs.Stat("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Name()).To(Equal("directory"))
+		Expect(info.IsDir()).To(BeTrue())
+
+		Expect(fake.lists).To(HaveLen(1))
+		Expect(*fake.lists[0].Prefix).To(Equal("directory/"))
+		Expect(*fake.lists[0].MaxKeys).To(Equal(int64(1)))
+	})
+
+	It("should find an empty directory by its marker", func() {
+		info, err := fs.Stat("/empty/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+	})
+
+	It("should not find a missing path", func() {
+		_, err := fs.Stat("/dir")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "stat",
+			Path: "/dir",
+			Err:  vfs.ErrNoFile,
+		}))
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+		Expect(fake.lists).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Mkdir", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":        []byte("hi, root"),
+			"directory/a.txt": []byte("a"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	It("should write a directory marker", func() {
+		Expect(fs.Mkdir("/empty")).To(Succeed())
+		Expect(fake.objects).To(HaveKey("empty/"))
+	})
+
+	It("should not make a directory that already exists", func() {
+		err := fs.Mkdir("/directory")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "mkdir",
+			Path: "/directory",
+			Err:  vfs.ErrExist,
+		}))
+		Expect(errors.Is(err, os.ErrExist)).To(BeTrue())
+		Expect(fake.objects).ToNot(HaveKey("directory/"))
+	})
+
+	It("should not rewrite the marker of a directory made twice", func() {
+		Expect(fs.Mkdir("/empty")).To(Succeed())
+		fake.objects["empty/"] = []byte("marker")
+
+		err := fs.Mkdir("/empty")
+		Expect(errors.Is(err, vfs.ErrExist)).To(BeTrue())
+		Expect(fake.objects["empty/"]).To(Equal([]byte("marker")))
+	})
+
+	It("should not make a directory over a file", func() {
+		err := fs.Mkdir("/root.txt")
+		Expect(errors.Is(err, os.ErrExist)).To(BeTrue())
+		Expect(fake.objects).ToNot(HaveKey("root.txt/"))
+	})
+})
+
+var _ = Describe("ReaddirChan", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		objects := map[string][]byte{
+			"large/":            {},
+			"large/sub/a.txt":   []byte("a"),
+			"large/zzz/b.txt":   []byte("b"),
+			"empty/":            {},
+			"directory/a.txt":   []byte("a"),
+			"directory/b/c.txt": []byte("c"),
+		}
+		for i := 1; i <= 2500; i++ {
+			objects[fmt.Sprintf("large/%04d", i)] = []byte{}
+		}
+		fake = newFakeS3(objects)
+		fs = fake.fileSystem()
+	})
+
+	collect := func(entries <-chan os.FileInfo, errs <-chan error) ([]os.FileInfo, error) {
+		var infos []os.FileInfo
+		for info := range entries {
+			infos = append(infos, info)
+		}
+		return infos, <-errs
+	}
+
+	It("should stream every page of a large directory", func() {
+		infos, err := collect(fs.ReaddirChan("/large"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2502))
+		Expect(fake.lists).To(HaveLen(3))
+	})
+
+	It("should list sub-directories and files", func() {
+		infos, err := collect(fs.ReaddirChan("/directory"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+		Expect(infos[0].Name()).To(Equal("a.txt"))
+		Expect(infos[1].Name()).To(Equal("b"))
+		Expect(infos[1].IsDir()).To(BeTrue())
+	})
+
+	It("should stream an empty directory", func() {
+		infos, err := collect(fs.ReaddirChan("/empty"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+
+	It("should send an error for a missing directory", func() {
+		_, err := collect(fs.ReaddirChan("/missing"))
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Checksum", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{"root.txt": []byte("hi, root")})
+		fs = fake.fileSystem()
+	})
+
+	It("should use the ETag for an MD5", func() {
+		sum, err := vfs.Checksum(fs, "/root.txt", md5.New())
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := md5.Sum([]byte("hi, root"))
+		Expect(sum).To(Equal(expected[:]))
+		Expect(fake.gets).To(BeEmpty())
+	})
+
+	It("should download when the ETag is from a multipart upload", func() {
+		fake.etags = map[string]string{"root.txt": `"0123456789abcdef0123456789abcdef-2"`}
+
+		sum, err := vfs.Checksum(fs, "/root.txt", md5.New())
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := md5.Sum([]byte("hi, root"))
+		Expect(sum).To(Equal(expected[:]))
+		Expect(fake.gets).To(Equal([]string{"root.txt"}))
+	})
+
+	It("should checksum the decoded content of a gzipped object with DecodeOnRead", func() {
+		fake.objects["root.txt"] = gzipped("hi, root")
+		fake.encs = map[string]string{"root.txt": "gzip"}
+
+		sum, err := vfs.Checksum(fake.fileSystem(DecodeOnRead(true)), "/root.txt", md5.New())
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := md5.Sum([]byte("hi, root"))
+		Expect(sum).To(Equal(expected[:]))
+		Expect(fake.gets).To(Equal([]string{"root.txt"}))
+	})
+
+	It("should download for other hashes", func() {
+		sum, err := vfs.Checksum(fs, "/root.txt", sha256.New())
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := sha256.Sum256([]byte("hi, root"))
+		Expect(sum).To(Equal(expected[:]))
+		Expect(fake.gets).To(Equal([]string{"root.txt"}))
+	})
+
+	It("should not checksum a missing file", func() {
+		_, err := vfs.Checksum(fs, "/missing.txt", md5.New())
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ObjectInfo", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"directory/a.txt":   []byte("a"),
+			"directory/b/c.txt": []byte("c"),
+		})
+		fake.types = map[string]string{"directory/a.txt": "text/plain"}
+		fake.meta = map[string]map[string]string{
+			"directory/a.txt": {"Origin": "vfs"},
+		}
+		fs = fake.fileSystem()
+	})
+
+	It("should describe the object from Stat", func() {
+		info, err := fs.Stat("/directory/a.txt")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(info.Sys()).To(Equal(&ObjectInfo{
+			ETag:         fmt.Sprintf(`"%x"`, md5.Sum([]byte("a"))),
+			StorageClass: "STANDARD",
+			ContentType:  "text/plain",
+			Metadata:     map[string]string{"Origin": "vfs"},
+		}))
+	})
+
+	It("should describe the object from Readdir", func() {
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+
+		Expect(infos[0].Sys()).To(Equal(&ObjectInfo{
+			ETag:         fmt.Sprintf(`"%x"`, md5.Sum([]byte("a"))),
+			StorageClass: "STANDARD",
+		}))
+	})
+
+	It("should be ContentTyped", func() {
+		info, err := fs.Stat("/directory/a.txt")
+		Expect(err).ToNot(HaveOccurred())
+		_, ok := info.(vfs.ContentTyped)
+		Expect(ok).To(BeTrue())
+		Expect(vfs.ContentType(info)).To(Equal("text/plain"))
+
+		info, err = fs.Stat("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vfs.ContentType(info)).To(Equal(""))
+	})
+
+	It("should have nothing for a directory", func() {
+		info, err := fs.Stat("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Sys()).To(BeNil())
+
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos[1].Sys()).To(BeNil())
+	})
+})
+
+var _ = Describe("Touch", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":        []byte("hi, root"),
+			"directory/a.txt": []byte("a"),
+		})
+		fake.meta = map[string]map[string]string{"root.txt": {"Origin": "vfs"}}
+		fs = fake.fileSystem()
+	})
+
+	It("should copy an existing object over itself", func() {
+		Expect(vfs.Touch(fs, "/root.txt")).To(Succeed())
+
+		Expect(fake.copies).To(HaveLen(1))
+		Expect(*fake.copies[0].CopySource).To(Equal("bucket/root.txt"))
+		Expect(*fake.copies[0].Key).To(Equal("root.txt"))
+		Expect(*fake.copies[0].MetadataDirective).To(Equal("REPLACE"))
+		Expect(fake.copies[0].Metadata).To(HaveKeyWithValue("Origin", aws.String("vfs")))
+		Expect(fake.objects["root.txt"]).To(Equal([]byte("hi, root")))
+	})
+
+	It("should leave a directory alone", func() {
+		Expect(vfs.Touch(fs, "/directory")).To(Succeed())
+		Expect(fake.copies).To(BeEmpty())
+		Expect(fake.objects).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("Chtimes", func() {
+	var (
+		fake  *fakeS3
+		fs    *S3FileSystem
+		mtime time.Time
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":        []byte("hi, root"),
+			"directory/a.txt": []byte("a"),
+		})
+		fake.meta = map[string]map[string]string{"root.txt": {"Origin": "vfs"}}
+		fs = fake.fileSystem()
+		mtime = time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	})
+
+	It("should store the modTime in the object's metadata", func() {
+		Expect(fs.Chtimes("/root.txt", mtime, mtime)).To(Succeed())
+
+		Expect(fake.meta["root.txt"]).To(Equal(map[string]string{
+			"Origin": "vfs",
+			"Mtime":  "2015-10-21T16:29:00Z",
+		}))
+		info, err := fs.Stat("/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", mtime))
+	})
+
+	It("should be cleared by Touch", func() {
+		Expect(fs.Chtimes("/root.txt", mtime, mtime)).To(Succeed())
+		Expect(fs.Touch("/root.txt")).To(Succeed())
+
+		Expect(fake.meta["root.txt"]).ToNot(HaveKey("Mtime"))
+	})
+
+	It("should let CopyPreserving keep a source's modTime", func() {
+		src := vfs.Mem(vfs.FileWithModTime("copied.txt", []byte("copied"), mtime))
+		fs.uploader = fakeUploader{f: fake}
+
+		Expect(vfs.CopyPreserving(fs, "/copied.txt", src, "/copied.txt")).To(Succeed())
+
+		info, err := fs.Stat("/copied.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", mtime))
+	})
+
+	It("should let Sync skip what it synced before", func() {
+		empty := newFakeS3(map[string][]byte{})
+		dst := empty.fileSystem()
+		dst.uploader = fakeUploader{f: empty}
+		src := vfs.Mem(
+			vfs.Dir("directory",
+				vfs.FileWithModTime("a.txt", []byte("a"), mtime),
+			),
+			vfs.FileWithModTime("root.txt", []byte("hi, root"), mtime),
+		)
+
+		var reported []vfs.DiffEntry
+		opts := vfs.SyncOptions{Report: func(entry vfs.DiffEntry) {
+			reported = append(reported, entry)
+		}}
+		Expect(vfs.Sync(dst, src, opts)).To(Succeed())
+		Expect(reported).To(ConsistOf(
+			vfs.DiffEntry{Path: "directory", Kind: vfs.Added},
+			vfs.DiffEntry{Path: "directory/a.txt", Kind: vfs.Added},
+			vfs.DiffEntry{Path: "root.txt", Kind: vfs.Added},
+		))
+
+		reported = nil
+		Expect(vfs.Sync(dst, src, opts)).To(Succeed())
+		Expect(reported).To(BeEmpty())
+	})
+
+	It("should leave a directory alone", func() {
+		Expect(fs.Chtimes("/directory", mtime, mtime)).To(Succeed())
+		Expect(fake.copies).To(BeEmpty())
+	})
+
+	It("should fail for a missing file", func() {
+		err := fs.Chtimes("/missing.txt", mtime, mtime)
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "chtimes",
+			Path: "/missing.txt",
+			Err:  vfs.ErrNoFile,
+		}))
+	})
+})
+
+var _ = Describe("Glob", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"logs/2024/a.json":        []byte("{}"),
+			"logs/2024/b.json":        []byte("{}"),
+			"logs/2024/c.txt":         []byte("c"),
+			"logs/2024/nested/d.json": []byte("{}"),
+			"logs/2025/e.json":        []byte("{}"),
+			"logs/2025/archive/":      {},
+			"root.txt":                []byte("hi, root"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	It("should list only under the static prefix of the pattern", func() {
+		matches, err := fs.Glob("/logs/2024/*.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{
+			"/logs/2024/a.json",
+			"/logs/2024/b.json",
+		}))
+
+		Expect(fake.lists).To(HaveLen(1))
+		Expect(*fake.lists[0].Prefix).To(Equal("logs/2024/"))
+		Expect(fake.lists[0].Delimiter).To(BeNil())
+	})
+
+	It("should match directories, including ones implied by keys", func() {
+		matches, err := fs.Glob("logs/*/*")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{
+			"/logs/2024/a.json",
+			"/logs/2024/b.json",
+			"/logs/2024/c.txt",
+			"/logs/2024/nested",
+			"/logs/2025/archive",
+			"/logs/2025/e.json",
+		}))
+		Expect(*fake.lists[0].Prefix).To(Equal("logs/"))
+	})
+
+	It("should be used by vfs.Glob", func() {
+		matches, err := vfs.Glob(fs, "/logs/202?/e.*")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(Equal([]string{"/logs/2025/e.json"}))
+		Expect(*fake.lists[0].Prefix).To(Equal("logs/202"))
+	})
+
+	It("should match a literal path only if it exists", func() {
+		Expect(fs.Glob("/root.txt")).To(Equal([]string{"/root.txt"}))
+		Expect(fs.Glob("/root")).To(BeEmpty())
+	})
+
+	It("should reject a bad pattern", func() {
+		_, err := fs.Glob("/logs/[")
+		Expect(err).To(Equal(pathpkg.ErrBadPattern))
+		Expect(fake.lists).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ReaddirPage", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		objects := map[string][]byte{"large/": {}}
+		for i := 0; i < 25; i++ {
+			objects[fmt.Sprintf("large/%02d.txt", i)] = []byte("x")
+		}
+		objects["large/sub/child.txt"] = []byte("child")
+		fake = newFakeS3(objects)
+		fs = fake.fileSystem()
+	})
+
+	It("should enumerate every entry exactly once by chaining tokens", func() {
+		var names []string
+		var pages int
+		token := ""
+		for {
+			infos, next, err := fs.ReaddirPage("/large", token, 10)
+			Expect(err).ToNot(HaveOccurred())
+			pages++
+			for _, info := range infos {
+				names = append(names, info.Name())
+			}
+			if next == "" {
+				break
+			}
+			token = next
+		}
+
+		Expect(pages).To(Equal(3))
+		Expect(names).To(HaveLen(26))
+		Expect(names).To(ContainElement("sub"))
+		seen := map[string]bool{}
+		for _, name := range names {
+			Expect(seen).ToNot(HaveKey(name))
+			seen[name] = true
+		}
+	})
+
+	It("should list one page per call", func() {
+		infos, next, err := fs.ReaddirPage("/large", "", 5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(next).ToNot(BeEmpty())
+		Expect(fake.lists).To(HaveLen(1))
+		Expect(*fake.lists[0].MaxKeys).To(Equal(int64(5)))
+		Expect(*fake.lists[0].Delimiter).To(Equal("/"))
+		// The directory's own marker takes a slot but isn't listed
+		Expect(infos).To(HaveLen(4))
+	})
+
+	It("should fail for a missing directory", func() {
+		_, _, err := fs.ReaddirPage("/missing", "", 10)
+		Expect(errors.Is(err, vfs.ErrNoFile)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ReaddirUnsorted", func() {
+	It("should list a page's directories before its files", func() {
+		fs := newFakeS3(map[string][]byte{
+			"a.txt":     []byte("a"),
+			"b/c.txt":   []byte("c"),
+			"directory": []byte("d"),
+		}).fileSystem()
+
+		infos, err := fs.ReaddirUnsorted("/")
+		Expect(err).ToNot(HaveOccurred())
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		Expect(names).To(Equal([]string{"b", "a.txt", "directory"}))
+	})
+})
+
+var _ = Describe("ReaddirAll", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":                       []byte("hi, root"),
+			"directory/":                     {},
+			"directory/child.txt":            []byte("hi, child"),
+			"directory/empty/":               {},
+			"directory/sub_directory/a.txt":  []byte("a"),
+			"directory/sub_directory/bb.txt": []byte("bb"),
+			"directory2/other.txt":           []byte("other"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	names := func(infos []os.FileInfo) []string {
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+
+	It("should list every key beneath a prefix in one listing", func() {
+		infos, err := fs.ReaddirAll("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(infos)).To(Equal([]string{
+			"child.txt",
+			"empty",
+			"sub_directory/a.txt",
+			"sub_directory/bb.txt",
+		}))
+		Expect(infos[1].IsDir()).To(BeTrue())
+		Expect(infos[3].IsDir()).To(BeFalse())
+		Expect(infos[3].Size()).To(Equal(int64(2)))
+
+		Expect(fake.lists).To(HaveLen(1))
+		Expect(*fake.lists[0].Prefix).To(Equal("directory/"))
+		Expect(fake.lists[0].Delimiter).To(BeNil())
+	})
+
+	It("should list the whole bucket", func() {
+		infos, err := fs.ReaddirAll("/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(7))
+		Expect(infos[0].Name()).To(Equal("directory"))
+	})
+
+	It("should leave Readdir listing a single level", func() {
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(infos)).To(Equal([]string{
+			"child.txt",
+			"empty",
+			"sub_directory",
+		}))
+	})
+
+	It("should fail for a missing prefix", func() {
+		_, err := fs.ReaddirAll("/missing")
+		Expect(errors.Is(err, vfs.ErrNoFile)).To(BeTrue())
+	})
+})
+
+var _ = Describe("DiskUsage", func() {
+	var (
+		fake *fakeS3
+		fs   *S3FileSystem
+	)
+
+	BeforeEach(func() {
+		fake = newFakeS3(map[string][]byte{
+			"root.txt":                       []byte("hi, root"),
+			"directory/":                     {},
+			"directory/child.txt":            []byte("hi, child"),
+			"directory/sub_directory/a.txt":  []byte("a"),
+			"directory/sub_directory/bb.txt": []byte("bb"),
+			"directory2/other.txt":           []byte("other"),
+		})
+		fs = fake.fileSystem()
+	})
+
+	It("should total a directory with one delimiter-less listing", func() {
+		size, err := vfs.DiskUsage(fs, "/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(9 + 1 + 2)))
+
+		Expect(fake.lists).To(HaveLen(1))
+		Expect(*fake.lists[0].Prefix).To(Equal("directory/"))
+		Expect(fake.lists[0].Delimiter).To(BeNil())
+	})
+
+	It("should total the whole bucket", func() {
+		size, err := vfs.DiskUsage(fs, "/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(8 + 9 + 1 + 2 + 5)))
+	})
+
+	It("should give the size of a file", func() {
+		size, err := vfs.DiskUsage(fs, "/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(8)))
+	})
+
+	It("should fail for a missing path", func() {
+		_, err := vfs.DiskUsage(fs, "/missing")
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+})
+
+var _ = Describe("URL", func() {
+	var fs *S3FileSystem
+
+	BeforeEach(func() {
+		fs = newFakeS3(map[string][]byte{
+			"assets/":        {},
+			"assets/app.css": []byte("body {}"),
+		}).fileSystem()
+	})
+
+	It("should be the bucket", func() {
+		Expect(fs.URL().String()).To(Equal("s3://bucket/"))
+	})
+
+	It("should join a Subtree's root onto the bucket", func() {
+		for _, root := range []string{"/assets", "assets", "/assets/", "assets/"} {
+			tree, err := vfs.Subtree(fs, root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tree.URL().String()).To(Equal("s3://bucket/assets"), root)
+		}
+	})
+})
+
+var _ = Describe("Locker", func() {
+	It("should not be supported", func() {
+		fs := newFakeS3(map[string][]byte{}).fileSystem()
+
+		_, err := fs.Lock("/lock")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "lock",
+			Path: "/lock",
+			Err:  vfs.ErrNotSupported,
+		}))
+
+		_, ok, err := fs.TryLock("/lock")
+		Expect(ok).To(BeFalse())
+		Expect(errors.Is(err, vfs.ErrNotSupported)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Watch", func() {
+	It("should not be supported", func() {
+		fs := newFakeS3(map[string][]byte{}).fileSystem()
+
+		_, _, err := fs.Watch("/assets")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "watch",
+			Path: "/assets",
+			Err:  vfs.ErrNotSupported,
+		}))
+	})
+})
+
+var _ = Describe("Capabilities", func() {
+	It("should report presigning but not locking or watching", func() {
+		fs := newFakeS3(map[string][]byte{}).fileSystem()
+
+		Expect(vfs.Supports(fs, vfs.CapPresign)).To(BeTrue())
+		Expect(vfs.Supports(fs, vfs.CapGlob)).To(BeTrue())
+		Expect(vfs.Supports(fs, vfs.CapLock)).To(BeFalse())
+		Expect(vfs.Supports(fs, vfs.CapWatch)).To(BeFalse())
+	})
+
+	It("should report the same through a Subtree", func() {
+		fs := newFakeS3(map[string][]byte{
+			"assets/logo.png": []byte("png"),
+		}).fileSystem()
+		tree, err := vfs.Subtree(fs, "/assets")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(vfs.Capabilities(tree)).To(ConsistOf(vfs.Capabilities(fs)))
+	})
+})
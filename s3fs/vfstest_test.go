@@ -0,0 +1,22 @@
+package s3fs
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/vistarmedia/vfs/vfstest"
+)
+
+func TestFileSystem(t *testing.T) {
+	fake := newFakeS3(map[string][]byte{})
+	fs := fake.fileSystem()
+	fs.uploader = fakeUploader{f: fake}
+	fs.downloader = s3manager.NewDownloaderWithClient(fake)
+
+	vfstest.TestFileSystem(t, fs, vfstest.Skip(
+		vfstest.MissingParent,
+		vfstest.FileParent,
+		vfstest.OpenDir,
+	))
+}
@@ -0,0 +1,240 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// How `Sync` decides a file in dst is already the same as the one in src
+type SyncCompare int
+
+const (
+	// Files of the same size and modTime are the same. This needs only the
+	// listings of each, but relies on dst having its modTimes set by earlier
+	// syncs, which only happens when it supports `CapChtimes`.
+	CompareModTime SyncCompare = iota
+	// Files of the same size and MD5 are the same. Both are read through unless
+	// they're `Checksummer`s which already know, like S3 from an object's ETag.
+	CompareChecksum
+)
+
+type SyncOptions struct {
+	// Removes whatever is in dst but not src
+	Delete bool
+	// How files in both are compared
+	Compare SyncCompare
+	// Only reports what would be done, without changing dst
+	DryRun bool
+	// Called with each action before it's taken: Added and Changed paths are
+	// copied from src, and Removed paths are removed from dst
+	Report func(DiffEntry)
+	// Called as files are copied, with their paths as in `DiffEntry`, counting
+	// up to the size of every file which is added or changed
+	Progress ProgressFunc
+}
+
+// Makes the tree of dst match src, copying only the files which are new or
+// changed and, with `SyncOptions.Delete`, removing those which src doesn't
+// have. Copied files keep their modTime from src if dst supports `CapChtimes`,
+// so the next sync can tell they're unchanged. The `FileSystem`s can be
+// different backends, so this can back up a directory on disk to S3. If a
+// directory in either can't be read, nothing is copied or removed.
+func Sync(dst, src FileSystem, opts SyncOptions) error {
+	srcInfos, err := walkInfos(src)
+	if err != nil {
+		return err
+	}
+	// A dst whose root can't be found yet, like an empty S3 bucket, is empty.
+	// Any other directory which can't be read stops the sync before anything
+	// is copied or removed.
+	dstInfos, err := walkInfos(dst)
+	if errors.Is(err, ErrNoFile) && missingRoot(dst) {
+		dstInfos, err = map[string]os.FileInfo{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s := &syncer{dst: dst, src: src, opts: opts}
+
+	// Everything to copy is found first, so progress has a total to count to.
+	// Parents sort before their children, so they're made first.
+	var copies []DiffEntry
+	var total int64
+	for _, path := range sortedPaths(srcInfos) {
+		srcInfo := srcInfos[path]
+		kind := Added
+		if dstInfo, ok := dstInfos[path]; ok {
+			changed, err := s.changed(path, srcInfo, dstInfo)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			kind = Changed
+		}
+		copies = append(copies, DiffEntry{path, kind})
+		if !srcInfo.IsDir() {
+			total += srcInfo.Size()
+		}
+	}
+
+	if opts.Progress != nil {
+		s.progress = &progress{fn: opts.Progress, total: total}
+	}
+	for _, entry := range copies {
+		srcInfo := srcInfos[entry.Path]
+		if entry.Kind == Added {
+			err = s.add(entry.Path, srcInfo)
+		} else {
+			err = s.replace(entry.Path, srcInfo, dstInfos[entry.Path])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !opts.Delete {
+		return nil
+	}
+	for _, path := range sortedPaths(dstInfos) {
+		if _, ok := srcInfos[path]; ok || s.removedAbove(path) {
+			continue
+		}
+		if err := s.remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type syncer struct {
+	dst, src FileSystem
+	opts     SyncOptions
+	progress *progress
+
+	// Directories removed from dst, whose children are already gone
+	removed []string
+}
+
+func (s *syncer) report(path string, kind DiffKind) {
+	if s.opts.Report != nil {
+		s.opts.Report(DiffEntry{path, kind})
+	}
+}
+
+func (s *syncer) add(path string, info os.FileInfo) error {
+	s.report(path, Added)
+	if s.opts.DryRun {
+		return nil
+	}
+	return s.copy(path, info)
+}
+
+// Copies over a changed file, or what's there when it's a file in one and a
+// directory in the other
+func (s *syncer) replace(path string, srcInfo, dstInfo os.FileInfo) error {
+	s.report(path, Changed)
+	if s.opts.DryRun {
+		return nil
+	}
+	if srcInfo.IsDir() != dstInfo.IsDir() {
+		if err := RemoveAll(s.dst, "/"+path); err != nil {
+			return err
+		}
+		s.removed = append(s.removed, path)
+	}
+	return s.copy(path, srcInfo)
+}
+
+func (s *syncer) remove(path string) error {
+	s.report(path, Removed)
+	s.removed = append(s.removed, path)
+	if s.opts.DryRun {
+		return nil
+	}
+	return RemoveAll(s.dst, "/"+path)
+}
+
+func (s *syncer) copy(path string, info os.FileInfo) error {
+	if info.IsDir() {
+		return s.dst.Mkdir("/" + path)
+	}
+	var err error
+	if s.progress != nil {
+		err = s.progress.copyFile(s.dst, "/"+path, s.src, "/"+path, path)
+	} else {
+		err = copyFile(s.dst, "/"+path, s.src, "/"+path)
+	}
+	if err != nil {
+		return err
+	}
+	if ct, ok := s.dst.(Chtimer); ok && Supports(s.dst, CapChtimes) {
+		return ct.Chtimes("/"+path, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+func missingRoot(fs FileSystem) bool {
+	_, err := fs.Readdir("/")
+	return errors.Is(err, ErrNoFile)
+}
+
+func (s *syncer) changed(path string, srcInfo, dstInfo os.FileInfo) (bool, error) {
+	switch {
+	case srcInfo.IsDir() != dstInfo.IsDir():
+		return true, nil
+	case srcInfo.IsDir():
+		return false, nil
+	case srcInfo.Size() != dstInfo.Size():
+		return true, nil
+	case s.opts.Compare == CompareModTime:
+		return s.modTimeChanged(path, srcInfo, dstInfo)
+	}
+
+	srcSum, err := Checksum(s.src, "/"+path, md5.New())
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := Checksum(s.dst, "/"+path, md5.New())
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(srcSum, dstSum), nil
+}
+
+// Not every listing carries the modTime a `Chtimer` set, like S3's, which
+// only a Stat reads back, so a file which looks changed is stated to be sure
+func (s *syncer) modTimeChanged(path string, srcInfo, dstInfo os.FileInfo) (bool, error) {
+	if srcInfo.ModTime().Equal(dstInfo.ModTime()) {
+		return false, nil
+	}
+	info, err := s.dst.Stat("/" + path)
+	if err != nil {
+		return false, err
+	}
+	return !srcInfo.ModTime().Equal(info.ModTime()), nil
+}
+
+func (s *syncer) removedAbove(path string) bool {
+	for _, dir := range s.removed {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedPaths(infos map[string]os.FileInfo) []string {
+	paths := make([]string, 0, len(infos))
+	for path := range infos {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,212 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Counts the writes made to a `MemNode`
+type countingFS struct {
+	*MemNode
+	copies, removes int
+}
+
+func (fs *countingFS) Copy(path string, source io.Reader) error {
+	fs.copies++
+	return fs.MemNode.Copy(path, source)
+}
+
+func (fs *countingFS) Remove(path string) error {
+	fs.removes++
+	return fs.MemNode.Remove(path)
+}
+
+var _ = Describe("Sync", func() {
+	var (
+		original *MemNode
+		modified *MemNode
+		reported []DiffEntry
+	)
+
+	report := func(entry DiffEntry) {
+		reported = append(reported, entry)
+	}
+
+	BeforeEach(func() {
+		mtime := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+		original = Mem(
+			Dir("directory",
+				Dir("sub_directory",
+					FileWithModTime("deep.txt", []byte("deep"), mtime),
+				),
+				FileWithModTime("child.txt", []byte("hi, child"), mtime),
+			),
+			Dir("empty_directory"),
+			FileWithModTime("root.txt", []byte("hi, root"), mtime),
+		).(*MemNode)
+		reported = nil
+
+		modified = original.Clone()
+		Expect(modified.Copy("/directory/new.txt", bytes.NewReader([]byte("new")))).To(Succeed())
+		Expect(modified.Copy("/root.txt", bytes.NewReader([]byte("hi, ROOT")))).To(Succeed())
+		Expect(RemoveAll(modified, "/directory/sub_directory")).To(Succeed())
+		Expect(modified.Mkdir("/added_directory")).To(Succeed())
+	})
+
+	It("should only copy what's new or changed", func() {
+		dst := &countingFS{MemNode: original}
+		Expect(Sync(dst, modified, SyncOptions{Report: report})).To(Succeed())
+
+		Expect(reported).To(Equal([]DiffEntry{
+			{"added_directory", Added},
+			{"directory/new.txt", Added},
+			{"root.txt", Changed},
+		}))
+		Expect(dst.copies).To(Equal(2))
+		Expect(dst.removes).To(BeZero())
+		Expect(ReadString(original, "/root.txt")).To(Equal("hi, ROOT"))
+		Expect(ReadString(original, "/directory/sub_directory/deep.txt")).To(Equal("deep"))
+	})
+
+	It("should report progress up to the size of what's copied", func() {
+		var done []int64
+		var paths []string
+		progress := func(path string, bytesDone, bytesTotal int64) {
+			Expect(bytesTotal).To(Equal(int64(len("new") + len("hi, ROOT"))))
+			done = append(done, bytesDone)
+			paths = append(paths, path)
+		}
+		Expect(Sync(original, modified, SyncOptions{Progress: progress})).To(Succeed())
+
+		for i := 1; i < len(done); i++ {
+			Expect(done[i]).To(BeNumerically(">=", done[i-1]))
+		}
+		Expect(done[len(done)-1]).To(Equal(int64(len("new") + len("hi, ROOT"))))
+		Expect(paths).To(ContainElement("directory/new.txt"))
+		Expect(paths).To(ContainElement("root.txt"))
+	})
+
+	It("should not report progress in a dry run", func() {
+		called := false
+		progress := func(path string, bytesDone, bytesTotal int64) {
+			called = true
+		}
+		opts := SyncOptions{DryRun: true, Progress: progress}
+		Expect(Sync(original, modified, opts)).To(Succeed())
+		Expect(called).To(BeFalse())
+	})
+
+	It("should remove what src doesn't have when asked", func() {
+		dst := &countingFS{MemNode: original}
+		opts := SyncOptions{Delete: true, Report: report}
+		Expect(Sync(dst, modified, opts)).To(Succeed())
+
+		Expect(reported).To(Equal([]DiffEntry{
+			{"added_directory", Added},
+			{"directory/new.txt", Added},
+			{"root.txt", Changed},
+			{"directory/sub_directory", Removed},
+		}))
+		Expect(dst.copies).To(Equal(2))
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+	})
+
+	It("should change nothing when a directory in src can't be read", func() {
+		dst := &countingFS{MemNode: original}
+		src := &failingReaddir{modified, "/directory"}
+
+		Expect(Sync(dst, src, SyncOptions{Delete: true})).ToNot(Succeed())
+		Expect(dst.copies).To(BeZero())
+		Expect(dst.removes).To(BeZero())
+		Expect(ReadString(original, "/directory/child.txt")).To(Equal("hi, child"))
+	})
+
+	It("should change nothing when a directory in dst can't be read", func() {
+		counting := &countingFS{MemNode: original}
+		dst := &failingReaddir{counting, "/directory"}
+
+		Expect(Sync(dst, modified, SyncOptions{Delete: true})).ToNot(Succeed())
+		Expect(counting.copies).To(BeZero())
+		Expect(counting.removes).To(BeZero())
+	})
+
+	It("should sync into an empty Subtree which can't set times", func() {
+		dst, err := Subtree(RateLimited(Mem(Dir("backup")), 1<<30), "/backup")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Sync(dst, modified, SyncOptions{})).To(Succeed())
+		Expect(ReadString(dst, "/root.txt")).To(Equal("hi, ROOT"))
+	})
+
+	It("should copy nothing on a second sync", func() {
+		Expect(Sync(original, modified, SyncOptions{Delete: true})).To(Succeed())
+
+		dst := &countingFS{MemNode: original}
+		Expect(Sync(dst, modified, SyncOptions{Delete: true, Report: report})).To(Succeed())
+		Expect(reported).To(BeEmpty())
+		Expect(dst.copies).To(BeZero())
+	})
+
+	It("should compare by checksum when asked", func() {
+		// Same size and content, but a new modTime
+		Expect(Touch(modified, "/directory/child.txt")).To(Succeed())
+
+		dst := &countingFS{MemNode: original}
+		opts := SyncOptions{Compare: CompareChecksum, Report: report}
+		Expect(Sync(dst, modified, opts)).To(Succeed())
+
+		Expect(reported).To(Equal([]DiffEntry{
+			{"added_directory", Added},
+			{"directory/new.txt", Added},
+			{"root.txt", Changed},
+		}))
+		Expect(dst.copies).To(Equal(2))
+	})
+
+	It("should replace a file with a directory", func() {
+		Expect(modified.Remove("/root.txt")).To(Succeed())
+		Expect(MkdirAll(modified, "/root.txt/inner")).To(Succeed())
+
+		Expect(Sync(original, modified, SyncOptions{Delete: true})).To(Succeed())
+
+		diffs, err := Diff(original, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+	})
+
+	It("should only report in a dry run", func() {
+		dst := &countingFS{MemNode: original}
+		opts := SyncOptions{Delete: true, DryRun: true, Report: report}
+		Expect(Sync(dst, modified, opts)).To(Succeed())
+
+		Expect(reported).To(HaveLen(4))
+		Expect(dst.copies).To(BeZero())
+		Expect(dst.removes).To(BeZero())
+		Expect(ReadString(original, "/root.txt")).To(Equal("hi, root"))
+	})
+
+	It("should sync from memory to disk", func() {
+		root, err := ioutil.TempDir("", "vfs-sync")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(root)
+		dst, err := OS(root)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Sync(dst, modified, SyncOptions{})).To(Succeed())
+		Expect(Sync(dst, modified, SyncOptions{Report: report})).To(Succeed())
+		Expect(reported).To(BeEmpty())
+
+		diffs, err := Diff(dst, modified)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+	})
+})
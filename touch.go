@@ -0,0 +1,54 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// Implemented by `FileSystem`s which can set the times of a path
+type Chtimer interface {
+	Chtimes(path string, atime, mtime time.Time) error
+}
+
+// Implemented by `FileSystem`s which have their own way to touch a path, for
+// when they can't set arbitrary times
+type Toucher interface {
+	Touch(path string) error
+}
+
+// Creates an empty file at path if nothing is there, or updates the modTime of
+// what is there to now. If the `FileSystem` is a `Toucher` its implementation
+// is used instead. A `FileSystem` which is neither a `Toucher` nor a `Chtimer`
+// has an existing file's content read and written back.
+func Touch(fs FileSystem, path string) error {
+	if t, ok := fs.(Toucher); ok {
+		return t.Touch(path)
+	}
+
+	info, err := fs.Stat(path)
+	if errors.Is(err, ErrNoFile) {
+		w, err := fs.Create(path)
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if ct, ok := fs.(Chtimer); ok {
+		return ct.Chtimes(path, now, now)
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	content, err := ReadFile(fs, path)
+	if err != nil {
+		return err
+	}
+	return fs.Copy(path, bytes.NewReader(content))
+}
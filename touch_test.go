@@ -0,0 +1,53 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Hides everything but the `FileSystem` interface of what it wraps
+type plainFS struct {
+	FileSystem
+}
+
+var _ = Describe("Touch", func() {
+	var mem *MemNode
+	var hour = time.Now().Add(-time.Hour)
+
+	BeforeEach(func() {
+		mem = Dir("",
+			FileWithModTime("root.txt", []byte("hi, root"), hour),
+		)
+	})
+
+	It("should set the modTime with Chtimes", func() {
+		Expect(Touch(mem, "/root.txt")).To(Succeed())
+
+		info, _ := mem.Stat("/root.txt")
+		Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("should rewrite the file when times can't be set", func() {
+		fs := plainFS{mem}
+		Expect(Touch(fs, "/root.txt")).To(Succeed())
+
+		info, _ := fs.Stat("/root.txt")
+		Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Second))
+
+		r, _ := fs.Open("/root.txt")
+		bs, _ := ioutil.ReadAll(r)
+		Expect(string(bs)).To(Equal("hi, root"))
+	})
+
+	It("should create missing parent directories", func() {
+		Expect(Touch(mem, "/new/file.txt")).To(Succeed())
+
+		info, err := mem.Stat("/new/file.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Size()).To(Equal(int64(0)))
+	})
+
+})
@@ -0,0 +1,89 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	pathpkg "path"
+	"strings"
+)
+
+type treePrinter struct {
+	fs     FileSystem
+	w      io.Writer
+	indent int
+	sizes  bool
+}
+
+// Sets how many columns each level of the tree is indented. The minimum is 2.
+func TreeIndent(indent int) func(*treePrinter) {
+	return func(tp *treePrinter) {
+		if indent < 2 {
+			indent = 2
+		}
+		tp.indent = indent
+	}
+}
+
+// Sets whether file sizes are shown after their names
+func TreeSizes(sizes bool) func(*treePrinter) {
+	return func(tp *treePrinter) {
+		tp.sizes = sizes
+	}
+}
+
+// Writes the tree of a `FileSystem` to w, like the `tree` command. Directories
+// end in a slash, and files are followed by their size in bytes. Entries are in
+// the order `Readdir` gives them.
+func Tree(fs FileSystem, w io.Writer, opts ...func(*treePrinter)) error {
+	tp := &treePrinter{
+		fs:     fs,
+		w:      w,
+		indent: 4,
+		sizes:  true,
+	}
+	for _, opt := range opts {
+		opt(tp)
+	}
+
+	if _, err := fmt.Fprintln(w, "/"); err != nil {
+		return err
+	}
+	return tp.print("/", "")
+}
+
+func (tp *treePrinter) print(dir, prefix string) error {
+	infos, err := tp.fs.Readdir(dir)
+	if err != nil {
+		return err
+	}
+
+	branch := "├" + strings.Repeat("─", tp.indent-2) + " "
+	last := "└" + strings.Repeat("─", tp.indent-2) + " "
+	trunk := "│" + strings.Repeat(" ", tp.indent-1)
+	space := strings.Repeat(" ", tp.indent)
+
+	for i, info := range infos {
+		connector, childPrefix := branch, prefix+trunk
+		if i == len(infos)-1 {
+			connector, childPrefix = last, prefix+space
+		}
+
+		name := info.Name()
+		switch {
+		case info.IsDir():
+			name += "/"
+		case tp.sizes:
+			name = fmt.Sprintf("%s (%d)", name, info.Size())
+		}
+		if _, err := fmt.Fprintln(tp.w, prefix+connector+name); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if err := tp.print(pathpkg.Join(dir, info.Name()), childPrefix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package vfs
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tree", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory",
+				Dir("sub_directory",
+					File("deep.txt", []byte("deep")),
+				),
+				File("child.txt", []byte("hi, child")),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+		)
+	})
+
+	It("should draw the tree", func() {
+		var out bytes.Buffer
+		Expect(Tree(fs, &out)).To(Succeed())
+
+		Expect(out.String()).To(Equal(`/
+├── directory/
+│   ├── child.txt (9)
+│   └── sub_directory/
+│       └── deep.txt (4)
+├── empty_directory/
+└── root.txt (8)
+`))
+	})
+
+	It("should change the indentation and hide sizes", func() {
+		var out bytes.Buffer
+		Expect(Tree(fs, &out, TreeIndent(2), TreeSizes(false))).To(Succeed())
+
+		Expect(out.String()).To(Equal(`/
+├ directory/
+│ ├ child.txt
+│ └ sub_directory/
+│   └ deep.txt
+├ empty_directory/
+└ root.txt
+`))
+	})
+
+	It("should draw an empty filesystem", func() {
+		var out bytes.Buffer
+		Expect(Tree(Mem(), &out)).To(Succeed())
+		Expect(out.String()).To(Equal("/\n"))
+	})
+
+	It("should return a write error", func() {
+		err := Tree(fs, failingWriter{})
+		Expect(err).To(MatchError("disk full"))
+	})
+
+})
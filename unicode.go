@@ -0,0 +1,222 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Wraps a `FileSystem` so paths match entries whose names are spelled with a
+// different Unicode normalization, like the NFD names macOS gives files next to
+// the NFC ones most systems use. Each element of a path is matched against the
+// entries of its directory once both are normalized to form, and the
+// underlying `FileSystem` is handed the entries' real names. An exact match is
+// always taken first; otherwise, two entries which normalize the same are
+// `ErrAmbiguous`. Names which don't exist yet are created normalized to form,
+// and Stat and Readdir return names normalized to it.
+func UnicodeNormalized(fs FileSystem, form norm.Form) FileSystem {
+	return &unicodeNormalized{fs, form}
+}
+
+type unicodeNormalized struct {
+	fs   FileSystem
+	form norm.Form
+}
+
+func (un *unicodeNormalized) resolve(op, path string) (string, error) {
+	exists := func(path string) bool {
+		_, err := un.fs.Stat(path)
+		return err == nil
+	}
+	readdirnames := func(dir string) ([]string, error) {
+		infos, err := un.fs.Readdir(dir)
+		names := make([]string, len(infos))
+		for i, info := range infos {
+			names[i] = info.Name()
+		}
+		return names, err
+	}
+	return resolveNormalized(op, path, un.form, exists, readdirnames)
+}
+
+// The real path of an existing entry matching path once both are normalized to
+// form. Elements which can't be found are normalized, so they're created in
+// that form or reported missing.
+func resolveNormalized(
+	op, path string,
+	form norm.Form,
+	exists func(string) bool,
+	readdirnames func(string) ([]string, error),
+) (string, error) {
+	path = pathpkg.Clean("/" + path)
+	if exists(path) {
+		return path, nil
+	}
+
+	resolved := "/"
+	parts := strings.Split(path[1:], "/")
+	for i, part := range parts {
+		name, err := matchNormalized(resolved, part, form, readdirnames)
+		if err != nil {
+			return "", &os.PathError{Op: op, Path: path, Err: err}
+		}
+		if name == "" {
+			rest := form.String(strings.Join(parts[i:], "/"))
+			return pathpkg.Join(resolved, rest), nil
+		}
+		resolved = pathpkg.Join(resolved, name)
+	}
+	return resolved, nil
+}
+
+// The entry of dir which normalizes to the same name, or "" if there isn't one
+func matchNormalized(
+	dir, name string,
+	form norm.Form,
+	readdirnames func(string) ([]string, error),
+) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	// A directory which doesn't exist, like the root of an `OS` which hasn't
+	// been made, has nothing to match
+	names, err := readdirnames(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	want := form.String(name)
+	var match string
+	for _, entry := range names {
+		switch {
+		case entry == name:
+			return name, nil
+		case form.String(entry) != want:
+		case match != "":
+			return "", ErrAmbiguous
+		default:
+			match = entry
+		}
+	}
+	return match, nil
+}
+
+// An `os.FileInfo` with its name normalized
+type normalizedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (ni *normalizedInfo) Name() string {
+	return ni.name
+}
+
+func (ni *normalizedInfo) ContentType() string {
+	return ContentType(ni.FileInfo)
+}
+
+func normalizeInfo(info os.FileInfo, form norm.Form) os.FileInfo {
+	name := form.String(info.Name())
+	if name == info.Name() {
+		return info
+	}
+	return &normalizedInfo{info, name}
+}
+
+func (un *unicodeNormalized) URL() *url.URL {
+	return un.fs.URL()
+}
+
+func (un *unicodeNormalized) Open(path string) (ReadSeekCloser, error) {
+	path, err := un.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return un.fs.Open(path)
+}
+
+func (un *unicodeNormalized) Create(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path, err := un.resolve("create", path)
+	if err != nil {
+		return nil, err
+	}
+	return un.fs.Create(path)
+}
+
+func (un *unicodeNormalized) Copy(path string, source io.Reader) error {
+	if err := checkFilePath("create", path); err != nil {
+		return err
+	}
+	path, err := un.resolve("create", path)
+	if err != nil {
+		return err
+	}
+	return un.fs.Copy(path, source)
+}
+
+func (un *unicodeNormalized) Move(srcPath, destPath string) error {
+	srcPath, err := un.resolve("move", srcPath)
+	if err != nil {
+		return err
+	}
+	destPath, err = un.resolve("move", destPath)
+	if err != nil {
+		return err
+	}
+	return un.fs.Move(srcPath, destPath)
+}
+
+func (un *unicodeNormalized) Remove(path string) error {
+	path, err := un.resolve("remove", path)
+	if err != nil {
+		return err
+	}
+	return un.fs.Remove(path)
+}
+
+func (un *unicodeNormalized) Stat(path string) (os.FileInfo, error) {
+	path, err := un.resolve("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := un.fs.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeInfo(info, un.form), nil
+}
+
+func (un *unicodeNormalized) Readdir(path string) ([]os.FileInfo, error) {
+	path, err := un.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := un.fs.Readdir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		infos[i] = normalizeInfo(info, un.form)
+	}
+	sortFileInfos(infos)
+	return infos, nil
+}
+
+func (un *unicodeNormalized) Mkdir(path string) error {
+	path, err := un.resolve("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return un.fs.Mkdir(path)
+}
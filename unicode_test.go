@@ -0,0 +1,98 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ = Describe("UnicodeNormalized", func() {
+	// "é" as a single code point, and as "e" with a combining accent
+	const nfc, nfd = "caf\u00e9", "cafe\u0301"
+
+	var backend, fs FileSystem
+
+	BeforeEach(func() {
+		backend = Mem(
+			Dir(nfd,
+				File(nfd+".txt", []byte("hi, cafe")),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+		fs = UnicodeNormalized(backend, norm.NFC)
+	})
+
+	It("should open a file stored under NFD by its NFC name", func() {
+		Expect(ReadString(fs, "/"+nfc+"/"+nfc+".txt")).To(Equal("hi, cafe"))
+		Expect(ReadString(fs, "/"+nfd+"/"+nfd+".txt")).To(Equal("hi, cafe"))
+		Expect(ReadString(fs, "/root.txt")).To(Equal("hi, root"))
+	})
+
+	It("should stat and list names in NFC", func() {
+		info, err := fs.Stat("/" + nfc + "/" + nfc + ".txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Name()).To(Equal(nfc + ".txt"))
+
+		infos, err := fs.Readdir("/" + nfc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Name()).To(Equal(nfc + ".txt"))
+	})
+
+	It("should create new names in NFC in an existing directory", func() {
+		Expect(fs.Copy("/"+nfc+"/new-"+nfd, strings.NewReader("new"))).To(Succeed())
+		Expect(ReadString(backend, "/"+nfd+"/new-"+nfc)).To(Equal("new"))
+
+		Expect(fs.Mkdir("/" + nfd + "/sub-" + nfd)).To(Succeed())
+		info, err := backend.Stat("/" + nfd + "/sub-" + nfc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+	})
+
+	It("should move and remove by either form", func() {
+		Expect(fs.Move("/"+nfc+"/"+nfc+".txt", "/moved.txt")).To(Succeed())
+		Expect(ReadString(backend, "/moved.txt")).To(Equal("hi, cafe"))
+
+		Expect(fs.Remove("/" + nfc)).To(Succeed())
+		_, err := backend.Stat("/" + nfd)
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should return ErrAmbiguous for names normalizing the same", func() {
+		// Two spellings of "e" with a dot below and an acute accent, which
+		// differ from a third only in the order of the accents
+		const composed, decomposed, unordered = "\u1eb9\u0301", "e\u0323\u0301", "e\u0301\u0323"
+		Expect(WriteFile(backend, "/"+composed, []byte("composed"))).To(Succeed())
+		Expect(WriteFile(backend, "/"+decomposed, []byte("decomposed"))).To(Succeed())
+
+		Expect(ReadString(fs, "/"+decomposed)).To(Equal("decomposed"))
+		_, err := fs.Open("/" + unordered)
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/" + unordered,
+			Err:  ErrAmbiguous,
+		}))
+	})
+
+	It("should return ErrNoFile for a missing path", func() {
+		_, err := fs.Open("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+	It("should return the error of a directory it can't read", func() {
+		fs = UnicodeNormalized(&failingReaddir{backend, "/" + nfd}, norm.NFC)
+
+		_, err := fs.Open("/" + nfc + "/" + nfc + ".txt")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("nope"))
+		Expect(errors.Is(err, ErrNoFile)).To(BeFalse())
+	})
+})
@@ -0,0 +1,51 @@
+package vfs
+
+import (
+	pathpkg "path"
+)
+
+// Implemented by `FileSystem`s which can total the size of a tree without
+// listing it one directory at a time
+type DiskUsager interface {
+	DiskUsage(path string) (int64, error)
+}
+
+// Sums the sizes of all the files at or beneath path. Directories contribute
+// nothing. If the `FileSystem` is a `DiskUsager` its implementation is used
+// instead.
+func DiskUsage(fs FileSystem, path string) (int64, error) {
+	if du, ok := fs.(DiskUsager); ok {
+		return du.DiskUsage(path)
+	}
+
+	info, err := fs.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+	return diskUsage(fs, path)
+}
+
+func diskUsage(fs FileSystem, dir string) (int64, error) {
+	infos, err := fs.Readdir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, info := range infos {
+		if !info.IsDir() {
+			total += info.Size()
+			continue
+		}
+
+		size, err := diskUsage(fs, pathpkg.Join(dir, info.Name()))
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
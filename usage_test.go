@@ -0,0 +1,65 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiskUsage", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory",
+				Dir("sub_directory",
+					File("deep.txt", []byte("deep")),
+				),
+				File("child.txt", []byte("hi, child")),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+		)
+	})
+
+	It("should total every file", func() {
+		size, err := DiskUsage(fs, "/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(4 + 9 + 8)))
+	})
+
+	It("should total a sub-directory", func() {
+		size, err := DiskUsage(fs, "/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(4 + 9)))
+	})
+
+	It("should give the size of a file", func() {
+		size, err := DiskUsage(fs, "/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(8)))
+	})
+
+	It("should be zero for an empty directory", func() {
+		size, err := DiskUsage(fs, "/empty_directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(BeZero())
+	})
+
+	It("should fail for a missing path", func() {
+		_, err := DiskUsage(fs, "/missing")
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should use a Subtree's underlying FileSystem", func() {
+		tree, err := Subtree(fs, "/directory")
+		Expect(err).ToNot(HaveOccurred())
+
+		size, err := DiskUsage(tree, "/sub_directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(size).To(Equal(int64(4)))
+	})
+
+})
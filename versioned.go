@@ -0,0 +1,310 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Implemented by `FileSystem`s which keep the history of their files
+type Versioner interface {
+	// Every version of a file, oldest first, including removals
+	ListVersions(path string) ([]Version, error)
+
+	// Reads a version of a file, which needn't be the current one
+	OpenVersion(path, id string) (ReadSeekCloser, error)
+
+	// Makes an earlier version of a file the current one. A removed file can be
+	// brought back by restoring a version from before it was removed.
+	Restore(path, id string) error
+}
+
+// One revision of a file kept by a `Versioner`
+type Version struct {
+	// Ordered like the versions were written
+	ID      string
+	ModTime time.Time
+	Size    int64
+
+	// The file was removed at this point in its history. A removal has no
+	// content, so it can't be opened or restored.
+	Deleted bool
+}
+
+// Wraps a backend so writing a file keeps what was there before. Every Create
+// and Copy writes a new version rather than overwriting, and the file points
+// at its current version. Remove leaves the history in place, adding a
+// version which marks the removal, unless `VersionedHardDelete` is set. Moving
+// a file writes its current content as a new version at the destination and
+// removes the source. Directories aren't versioned.
+//
+// The backend is laid out as:
+//
+//	/current/...          the id of the current version of each file
+//	/versions/.../<id>    every version of each file, named by when it was written
+func Versioned(backend FileSystem, opts ...func(*versioned)) FileSystem {
+	// Without it an empty backend can't list its root
+	MkdirAll(backend, "/current")
+
+	v := &versioned{
+		backend:  backend,
+		current:  &subtree{backend, "/current"},
+		versions: &subtree{backend, "/versions"},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Whether Remove deletes a file's history along with it, rather than marking
+// the removal as a new version
+func VersionedHardDelete(hardDelete bool) func(*versioned) {
+	return func(v *versioned) {
+		v.hardDelete = hardDelete
+	}
+}
+
+type versioned struct {
+	backend    FileSystem
+	current    *subtree
+	versions   *subtree
+	hardDelete bool
+
+	now  func() time.Time
+	mu   sync.Mutex
+	last time.Time // when the last version was written
+}
+
+// Timestamps sort the same as strings, so `Readdir` lists versions in order
+const (
+	versionFormat   = "20060102T150405.000000000Z"
+	tombstoneSuffix = ".deleted"
+)
+
+// The id for a new version. Versions written within the same clock tick are
+// spaced a nanosecond apart so every id is distinct.
+func (v *versioned) newID() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now().UTC()
+	if !now.After(v.last) {
+		now = v.last.Add(time.Nanosecond)
+	}
+	v.last = now
+	return now.Format(versionFormat)
+}
+
+func (v *versioned) versionPath(path, id string) string {
+	return pathpkg.Join(pathpkg.Clean("/"+path), id)
+}
+
+// The id of the current version of a file
+func (v *versioned) currentID(path string) (string, error) {
+	id, err := ReadFile(v.current, path)
+	return string(id), err
+}
+
+func (v *versioned) URL() *url.URL {
+	return v.backend.URL()
+}
+
+func (v *versioned) Open(path string) (ReadSeekCloser, error) {
+	id, err := v.currentID(path)
+	if err != nil {
+		return nil, err
+	}
+	return v.OpenVersion(path, id)
+}
+
+// Writes a new version, which becomes current on Close
+func (v *versioned) Create(path string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", path); err != nil {
+		return nil, err
+	}
+	path = pathpkg.Clean("/" + path)
+	id := v.newID()
+
+	w, err := v.versions.Create(v.versionPath(path, id))
+	if err != nil {
+		return nil, err
+	}
+	return &versionFile{WriteCloser: w, v: v, path: path, id: id}, nil
+}
+
+func (v *versioned) Copy(path string, source io.Reader) error {
+	dest, err := v.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := copyBuffer(dest, source); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (v *versioned) Remove(path string) error {
+	path = pathpkg.Clean("/" + path)
+	info, err := v.current.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := v.current.Remove(path); err != nil || info.IsDir() {
+		return err
+	}
+
+	if v.hardDelete {
+		return RemoveAll(v.versions, path)
+	}
+	tombstone := v.versionPath(path, v.newID()+tombstoneSuffix)
+	return v.versions.Copy(tombstone, bytes.NewReader(nil))
+}
+
+func (v *versioned) Move(srcPath, destPath string) error {
+	srcPath = pathpkg.Clean("/" + srcPath)
+	destPath = pathpkg.Clean("/" + destPath)
+	if srcPath == destPath {
+		_, err := v.Stat(srcPath)
+		return err
+	}
+
+	r, err := v.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := v.Copy(destPath, r); err != nil {
+		return err
+	}
+	return v.Remove(srcPath)
+}
+
+// A file takes the size and modTime of its current version
+func (v *versioned) Stat(path string) (os.FileInfo, error) {
+	info, err := v.current.Stat(path)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	return v.fileInfo(pathpkg.Clean("/"+path), info.Name())
+}
+
+func (v *versioned) Readdir(path string) ([]os.FileInfo, error) {
+	infos, err := v.current.Readdir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		infos[i], err = v.fileInfo(pathpkg.Join("/", path, info.Name()), info.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (v *versioned) Mkdir(path string) error {
+	return v.current.Mkdir(path)
+}
+
+func (v *versioned) fileInfo(path, name string) (os.FileInfo, error) {
+	id, err := v.currentID(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := v.versions.Stat(v.versionPath(path, id))
+	if err != nil {
+		return nil, err
+	}
+	return &namedFileInfo{info, name}, nil
+}
+
+func (v *versioned) ListVersions(path string) ([]Version, error) {
+	path = pathpkg.Clean("/" + path)
+	infos, err := v.versions.Readdir(path)
+	if err != nil && !errors.Is(err, ErrNoFile) {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		versions = append(versions, Version{
+			ID:      strings.TrimSuffix(info.Name(), tombstoneSuffix),
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Deleted: strings.HasSuffix(info.Name(), tombstoneSuffix),
+		})
+	}
+	if len(versions) == 0 {
+		return nil, &os.PathError{
+			Op:   "listversions",
+			Path: path,
+			Err:  ErrNoFile,
+		}
+	}
+	return versions, nil
+}
+
+func (v *versioned) OpenVersion(path, id string) (ReadSeekCloser, error) {
+	return v.versions.Open(v.versionPath(path, id))
+}
+
+func (v *versioned) Restore(path, id string) error {
+	path = pathpkg.Clean("/" + path)
+	info, err := v.versions.Stat(v.versionPath(path, id))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &os.PathError{
+			Op:   "restore",
+			Path: path,
+			Err:  fmt.Errorf("%s is not a version", id),
+		}
+	}
+	return v.current.Copy(path, strings.NewReader(id))
+}
+
+// Makes its version current once it's been written
+type versionFile struct {
+	io.WriteCloser
+	v      *versioned
+	path   string
+	id     string
+	closed bool
+}
+
+func (vf *versionFile) Close() error {
+	if vf.closed {
+		return os.ErrClosed
+	}
+	vf.closed = true
+
+	if err := vf.WriteCloser.Close(); err != nil {
+		vf.v.versions.Remove(vf.v.versionPath(vf.path, vf.id))
+		return err
+	}
+	if err := vf.v.current.Copy(vf.path, strings.NewReader(vf.id)); err != nil {
+		vf.v.versions.Remove(vf.v.versionPath(vf.path, vf.id))
+		return err
+	}
+	return nil
+}
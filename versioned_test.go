@@ -0,0 +1,152 @@
+package vfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Versioned", func() {
+	var backend, fs FileSystem
+	var versioner Versioner
+	var clock time.Time
+
+	BeforeEach(func() {
+		backend = Mem()
+		fs = Versioned(backend)
+		versioner = fs.(Versioner)
+
+		clock = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		fs.(*versioned).now = func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}
+	})
+
+	readVersion := func(path, id string) string {
+		r, err := versioner.OpenVersion(path, id)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+		content, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		return string(content)
+	}
+
+	writeThree := func() []Version {
+		for _, content := range []string{"one", "two", "three"} {
+			Expect(fs.Copy("/config.txt", strings.NewReader(content))).To(Succeed())
+		}
+		versions, err := versioner.ListVersions("/config.txt")
+		Expect(err).ToNot(HaveOccurred())
+		return versions
+	}
+
+	It("should keep every version written", func() {
+		versions := writeThree()
+		Expect(versions).To(HaveLen(3))
+		Expect(versions[0].ID).To(Equal("20200102T030406.000000000Z"))
+		Expect(versions[2].ID).To(Equal("20200102T030408.000000000Z"))
+		Expect(versions[2].Size).To(Equal(int64(5)))
+
+		Expect(readVersion("/config.txt", versions[0].ID)).To(Equal("one"))
+		Expect(readVersion("/config.txt", versions[1].ID)).To(Equal("two"))
+		Expect(readVersion("/config.txt", versions[2].ID)).To(Equal("three"))
+		Expect(ReadFile(fs, "/config.txt")).To(Equal([]byte("three")))
+	})
+
+	It("should give versions written in the same tick distinct ids", func() {
+		fs.(*versioned).now = func() time.Time { return clock }
+		versions := writeThree()
+		Expect(versions[0].ID).To(Equal("20200102T030405.000000000Z"))
+		Expect(versions[1].ID).To(Equal("20200102T030405.000000001Z"))
+		Expect(versions[2].ID).To(Equal("20200102T030405.000000002Z"))
+	})
+
+	It("should restore an old version", func() {
+		versions := writeThree()
+		Expect(versioner.Restore("/config.txt", versions[0].ID)).To(Succeed())
+		Expect(ReadFile(fs, "/config.txt")).To(Equal([]byte("one")))
+
+		info, err := fs.Stat("/config.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Name()).To(Equal("config.txt"))
+		Expect(info.Size()).To(Equal(int64(3)))
+	})
+
+	It("should not restore a missing version", func() {
+		writeThree()
+		err := versioner.Restore("/config.txt", "missing")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should tombstone removed files", func() {
+		versions := writeThree()
+		Expect(fs.Remove("/config.txt")).To(Succeed())
+
+		_, err := fs.Stat("/config.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+
+		history, err := versioner.ListVersions("/config.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(history).To(HaveLen(4))
+		Expect(history[3].Deleted).To(BeTrue())
+
+		Expect(versioner.Restore("/config.txt", versions[1].ID)).To(Succeed())
+		Expect(ReadFile(fs, "/config.txt")).To(Equal([]byte("two")))
+	})
+
+	It("should delete history when removing hard", func() {
+		fs = Versioned(backend, VersionedHardDelete(true))
+		versioner = fs.(Versioner)
+		writeThree()
+
+		Expect(fs.Remove("/config.txt")).To(Succeed())
+		_, err := versioner.ListVersions("/config.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "listversions",
+			Path: "/config.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+	It("should move the current content as a new version", func() {
+		writeThree()
+		Expect(fs.Move("/config.txt", "/directory/moved.txt")).To(Succeed())
+
+		Expect(ReadFile(fs, "/directory/moved.txt")).To(Equal([]byte("three")))
+		_, err := fs.Open("/config.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+
+		infos, err := fs.Readdir("/directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Name()).To(Equal("moved.txt"))
+		Expect(infos[0].Size()).To(Equal(int64(5)))
+	})
+
+	It("should pass directories through", func() {
+		Expect(fs.Mkdir("/directory")).To(Succeed())
+		Expect(fs.Copy("/root.txt", strings.NewReader("hi"))).To(Succeed())
+
+		infos, err := fs.Readdir("/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+		Expect(infos[0].IsDir()).To(BeTrue())
+		Expect(infos[1].Name()).To(Equal("root.txt"))
+	})
+
+	It("should return ErrNoFile for a missing file", func() {
+		_, err := fs.Open("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+})
@@ -3,8 +3,10 @@
 package vfs
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/url"
 	"os"
@@ -12,11 +14,52 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
-var ErrNoFile = errors.New("No such file")
+// Returned, wrapped in an `*os.PathError`, when a path doesn't exist. It
+// matches `os.ErrNotExist` with `errors.Is`; `os.IsNotExist` predates
+// `errors.Is` and only recognizes the `os` package's own errors.
+var ErrNoFile error = &fsError{"No such file", os.ErrNotExist}
+var ErrIsDir = errors.New("Is a directory")
+
+// Returned, wrapped in an `*os.PathError`, when creating something where a
+// path already exists. It matches `os.ErrExist` with `errors.Is`.
+var ErrExist error = &fsError{"File exists", os.ErrExist}
+
+// Returned, wrapped in an `*os.PathError`, when fewer bytes of a file could be
+// read than it's meant to have. It matches `io.ErrUnexpectedEOF` with
+// `errors.Is`.
+var ErrShortDownload error = &fsError{"Short download", io.ErrUnexpectedEOF}
+
+// A sentinel error which also matches one of the `os` package's sentinels, so
+// callers can use the standard `errors.Is` checks against any `FileSystem`.
+type fsError struct {
+	msg string
+	os  error
+}
+
+func (e *fsError) Error() string {
+	return e.msg
+}
+
+func (e *fsError) Is(target error) bool {
+	return target == e.os
+}
 
 // Easily testable interface for accessing the FileSystem.
+//
+// Every backend treats directories the same way: one exists from when it's
+// made, whether by Mkdir or by creating a file beneath it, until it's removed
+// itself. An empty directory is listed by `Readdir` of its parent as a single
+// entry, and lists nothing itself. Backends without real directories, like
+// S3, keep a marker to hold a directory open once it's empty, but never list
+// the marker.
+//
+// A trailing slash is ignored when looking a path up, so "directory/" stats
+// and lists like "directory", and Open fails on it with `ErrIsDir`. A path to
+// create with Create or Copy can't have one: it names a directory, so they fail
+// with `ErrIsDir` rather than creating a file without the slash.
 type FileSystem interface {
 	Open(name string) (ReadSeekCloser, error)
 	Create(path string) (io.WriteCloser, error)
@@ -29,7 +72,26 @@ type FileSystem interface {
 	URL() *url.URL
 }
 
+// Implemented by the `os.FileInfo`s of `FileSystem`s which know the MIME type
+// of their files
+type ContentTyped interface {
+	ContentType() string
+}
+
+// The MIME type of a file, if its `FileSystem` knows it. `FileInfo`s which
+// aren't `ContentTyped`, like those from the OS `FileSystem`, give "".
+func ContentType(info os.FileInfo) string {
+	if ct, ok := info.(ContentTyped); ok {
+		return ct.ContentType()
+	}
+	return ""
+}
+
 // A ReadSeekCloser can Read, Seek, and Close.
+//
+// `io.Copy` takes a fast path out of those which have one: files from `OS` are
+// `*os.File`s, and files from `Mem` and S3 are `io.WriterTo`s. The writers from
+// Create of those backends are `io.ReaderFrom`s, for copying into them.
 type ReadSeekCloser interface {
 	io.Reader
 	io.ReaderAt
@@ -37,8 +99,75 @@ type ReadSeekCloser interface {
 	io.Closer
 }
 
-// Recursively creates a directory. If it fails part-way through creating the
-// directories, it will not attempt to clean up.
+// Implemented by files from Open which are files on disk, so callers can hand
+// the descriptor to another syscall or find the file by name. Those from `OS`
+// are `*os.File`s.
+type Fder interface {
+	Fd() uintptr
+	Name() string
+}
+
+// Reads the whole content of a file
+func ReadFile(fs FileSystem, path string) ([]byte, error) {
+	r, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Hides the buffer's ReadFrom, so it's filled through a pooled buffer
+	// rather than reading into its own spare capacity
+	content := bytes.NewBuffer([]byte{})
+	_, err = copyBuffer(struct{ io.Writer }{content}, r)
+	return content.Bytes(), err
+}
+
+// Reads the whole content of a file as a string
+func ReadString(fs FileSystem, path string) (string, error) {
+	content, err := ReadFile(fs, path)
+	return string(content), err
+}
+
+// Writes data to a file, replacing whatever was there
+func WriteFile(fs FileSystem, path string, data []byte) error {
+	return fs.Copy(path, bytes.NewReader(data))
+}
+
+// Copies source to path like the `FileSystem`'s Copy, returning how many bytes
+// it read from source. No backend reports what it wrote, so this counts what
+// it reads, which for S3 is what was uploaded.
+func CopyCounted(fs FileSystem, path string, source io.Reader) (int64, error) {
+	counter := &countingReader{r: source}
+	err := fs.Copy(path, counter)
+	return counter.n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Keeps the fast paths `io.Copy` would take with the source
+func (c *countingReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.Copy(w, c.r)
+	c.n += n
+	return n, err
+}
+
+// Writes a string to a file, replacing whatever was there
+func WriteString(fs FileSystem, path, content string) error {
+	return fs.Copy(path, strings.NewReader(content))
+}
+
+// Recursively creates a directory. Directories which already exist are left
+// alone. If it fails part-way through creating the directories, it will not
+// attempt to clean up.
 func MkdirAll(fs FileSystem, path string) error {
 	clean := pathpkg.Clean("/" + path)[1:]
 	parts := strings.Split(clean, "/")
@@ -46,13 +175,250 @@ func MkdirAll(fs FileSystem, path string) error {
 	for i := 1; i <= len(parts); i++ {
 		dirName := "/" + pathpkg.Join(parts[0:i]...)
 		if err := fs.Mkdir(dirName); err != nil {
+			if !errors.Is(err, ErrExist) {
+				return err
+			}
+			if info, statErr := fs.Stat(dirName); statErr != nil || !info.IsDir() {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Implemented by `FileSystem`s which can remove a whole tree at once more
+// cheaply than one path at a time.
+type RemoveAller interface {
+	RemoveAll(path string) error
+}
+
+// Removes a path and, if it's a directory, everything beneath it. Like
+// `os.RemoveAll`, a path that doesn't exist is not an error. If the
+// `FileSystem` is a `RemoveAller` its implementation is used instead.
+func RemoveAll(fs FileSystem, path string) error {
+	if ra, ok := fs.(RemoveAller); ok {
+		return ra.RemoveAll(path)
+	}
+
+	info, err := fs.Stat(path)
+	if err != nil {
+		if pe, ok := err.(*os.PathError); ok && pe.Err == ErrNoFile {
+			return nil
+		}
+		return err
+	}
+
+	if info.IsDir() {
+		infos, err := fs.Readdir(path)
+		if err != nil {
 			return err
 		}
+		for _, child := range infos {
+			if err := RemoveAll(fs, pathpkg.Join(path, child.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fs.Remove(path)
+}
+
+// Reports whether a directory has no entries. A missing path is an error.
+func Empty(fs FileSystem, path string) (bool, error) {
+	infos, err := fs.Readdir(path)
+	if err != nil {
+		return false, err
 	}
+	return len(infos) == 0, nil
+}
 
+// Removes everything in a directory with `RemoveAll`, leaving the directory
+// itself. If it fails part-way through, whatever was already removed stays
+// removed.
+func Clear(fs FileSystem, path string) error {
+	infos, err := fs.Readdir(path)
+	if err != nil {
+		return err
+	}
+	for _, child := range infos {
+		if err := RemoveAll(fs, pathpkg.Join(path, child.Name())); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Writes the whole tree of a `FileSystem` onto disk beneath osRoot, creating
+// directories as needed. Files which already exist on disk are overwritten. A
+// directory which can't be read fails the export.
+func ExportToDir(fs FileSystem, osRoot string) error {
+	if err := os.MkdirAll(osRoot, 0755); err != nil {
+		return err
+	}
+	dest, err := OS(osRoot)
+	if err != nil {
+		return err
+	}
+
+	return Walk(fs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return exportPath(fs, dest, osRoot, path, info)
+	})
+}
+
+func exportPath(
+	fs, dest FileSystem, osRoot, path string, info os.FileInfo) error {
+
+	if info.IsDir() {
+		return os.MkdirAll(filepath.Join(osRoot, filepath.FromSlash(path)), 0755)
+	}
+
+	src, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return dest.Copy(path, src)
+}
+
+// Implemented by `FileSystem`s which can sometimes produce a file's checksum
+// without reading the whole file, for example from stored metadata
+type Checksummer interface {
+	Checksum(path string, h hash.Hash) ([]byte, error)
+}
+
+// Streams a file through h and returns the digest, without reading the whole
+// file into memory. If the `FileSystem` is a `Checksummer` its implementation
+// is used instead.
+func Checksum(fs FileSystem, path string, h hash.Hash) ([]byte, error) {
+	if cs, ok := fs.(Checksummer); ok {
+		return cs.Checksum(path, h)
+	}
+
+	r, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if _, err := copyBuffer(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Implemented by `FileSystem`s which can list a directory without holding the
+// whole listing in memory
+type ReaddirStreamer interface {
+	ReaddirChan(path string) (<-chan os.FileInfo, <-chan error)
+}
+
+// Streams the entries of a directory over a channel. If the listing fails, the
+// error is sent on the error channel after the entries are closed. When the
+// `FileSystem` is a `ReaddirStreamer` entries are sent as they're read, and
+// may not be sorted by name; otherwise the result of `Readdir` is sent. The
+// entries must be drained.
+func ReaddirChan(fs FileSystem, path string) (<-chan os.FileInfo, <-chan error) {
+	if rs, ok := fs.(ReaddirStreamer); ok {
+		return rs.ReaddirChan(path)
+	}
+
+	entries := make(chan os.FileInfo)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(entries)
+
+		infos, err := fs.Readdir(path)
+		if err != nil {
+			errs <- err
+			return
+		}
+		for _, info := range infos {
+			entries <- info
+		}
+	}()
+
+	return entries, errs
+}
+
+// Implemented by `FileSystem`s which can list a directory faster when they
+// don't have to sort it
+type UnsortedReaddirer interface {
+	ReaddirUnsorted(path string) ([]os.FileInfo, error)
+}
+
+// Lists a directory like Readdir, but in whatever order the `FileSystem` finds
+// its entries, for when the order doesn't matter and the directory is huge.
+// If the `FileSystem` isn't an `UnsortedReaddirer` its Readdir is used.
+func ReaddirUnsorted(fs FileSystem, path string) ([]os.FileInfo, error) {
+	if ur, ok := fs.(UnsortedReaddirer); ok {
+		return ur.ReaddirUnsorted(path)
+	}
+	return fs.Readdir(path)
+}
+
+// Implemented by `FileSystem`s which can list the entries of a directory they
+// could read even when others can't be
+type BestEffortReaddirer interface {
+	ReaddirBestEffort(path string) ([]os.FileInfo, error)
+}
+
+// Returned by `ReaddirBestEffort` along with the entries which could be read,
+// holding an error for each entry which couldn't
+type ReaddirError struct {
+	Errs []error
+}
+
+func (e *ReaddirError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d entries could not be read: %s",
+		len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// Lists a directory like Readdir, but when some of its entries can't be read,
+// returns the rest along with a `*ReaddirError` for those, rather than nothing.
+// Any other error returns no entries. This is for scanning directories which
+// change underneath the scan. If the `FileSystem` isn't a
+// `BestEffortReaddirer` its Readdir is used.
+func ReaddirBestEffort(fs FileSystem, path string) ([]os.FileInfo, error) {
+	if br, ok := fs.(BestEffortReaddirer); ok {
+		return br.ReaddirBestEffort(path)
+	}
+	return fs.Readdir(path)
+}
+
+// Lists a directory sorted by less rather than by name, like by modification
+// time or size. Entries less considers equal keep their order by name.
+func ReaddirSorted(
+	fs FileSystem,
+	path string,
+	less func(a, b os.FileInfo) bool,
+) ([]os.FileInfo, error) {
+	infos, err := ReaddirUnsorted(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		switch {
+		case less(infos[i], infos[j]):
+			return true
+		case less(infos[j], infos[i]):
+			return false
+		default:
+			return infos[i].Name() < infos[j].Name()
+		}
+	})
+	return infos, nil
+}
+
 // Create a `FileSystem` where the root is some directory in another
 // `FileSystem`. Filenames will be qualified so the underlying `FileSystem` can
 // deal with absolute paths. A reasonable attempt is made to un-qualify
@@ -64,7 +430,9 @@ type subtree struct {
 }
 
 // Creates a `FileSystem` from the mount point of another `FileSystem`. This
-// will check to make sure the mount point is a directory on creation.
+// will check to make sure the mount point is a directory on creation. A
+// `Subtree` of a `Subtree` is flattened into a single `Subtree` of the
+// underlying `FileSystem`.
 func Subtree(fs FileSystem, root string) (FileSystem, error) {
 	if root == "" {
 		return fs, nil
@@ -81,12 +449,18 @@ func Subtree(fs FileSystem, root string) (FileSystem, error) {
 		}
 	}
 
+	if parent, ok := fs.(*subtree); ok {
+		return &subtree{parent.fs, parent.mapPath(root)}, nil
+	}
 	return &subtree{fs, root}, nil
 }
 
+// The URL of the underlying `FileSystem` with the root joined onto its path.
+// The scheme and host are kept, and the path always starts with a single slash.
 func (s *subtree) URL() *url.URL {
 	url := s.fs.URL()
-	url.Path = pathpkg.Join(url.Path, s.root)
+	url.Path = pathpkg.Join("/", url.Path, s.root)
+	url.RawPath = ""
 	return url
 }
 
@@ -96,22 +470,48 @@ func (s *subtree) Open(name string) (ReadSeekCloser, error) {
 }
 
 func (s *subtree) Create(name string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", name); err != nil {
+		return nil, err
+	}
 	w, err := s.fs.Create(s.mapPath(name))
 	return w, s.unmapError(err)
 }
 
+func (s *subtree) CreateAtomic(name string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", name); err != nil {
+		return nil, err
+	}
+	w, err := CreateAtomic(s.fs, s.mapPath(name))
+	return w, s.unmapError(err)
+}
+
+func (s *subtree) CreateExclusive(name string) (io.WriteCloser, error) {
+	if err := checkFilePath("create", name); err != nil {
+		return nil, err
+	}
+	w, err := CreateExclusive(s.fs, s.mapPath(name))
+	return w, s.unmapError(err)
+}
+
 func (s *subtree) Copy(destPath string, source io.Reader) error {
-	return s.fs.Copy(s.mapPath(destPath), source)
+	if err := checkFilePath("create", destPath); err != nil {
+		return err
+	}
+	return s.unmapError(s.fs.Copy(s.mapPath(destPath), source))
 }
 
 func (s *subtree) Move(srcPath, destPath string) error {
-	return s.fs.Move(s.mapPath(srcPath), s.mapPath(destPath))
+	return s.unmapError(s.fs.Move(s.mapPath(srcPath), s.mapPath(destPath)))
 }
 
 func (s *subtree) Remove(path string) error {
 	return s.unmapError(s.fs.Remove(s.mapPath(path)))
 }
 
+func (s *subtree) RemoveAll(path string) error {
+	return s.unmapError(RemoveAll(s.fs, s.mapPath(path)))
+}
+
 func (s *subtree) Stat(path string) (os.FileInfo, error) {
 	info, err := s.fs.Stat(s.mapPath(path))
 	return info, s.unmapError(err)
@@ -122,16 +522,107 @@ func (s *subtree) Readdir(path string) ([]os.FileInfo, error) {
 	return infos, s.unmapError(err)
 }
 
+func (s *subtree) ReaddirUnsorted(path string) ([]os.FileInfo, error) {
+	infos, err := ReaddirUnsorted(s.fs, s.mapPath(path))
+	return infos, s.unmapError(err)
+}
+
+func (s *subtree) ReaddirBestEffort(path string) ([]os.FileInfo, error) {
+	infos, err := ReaddirBestEffort(s.fs, s.mapPath(path))
+	if re, ok := err.(*ReaddirError); ok {
+		errs := make([]error, len(re.Errs))
+		for i, err := range re.Errs {
+			errs[i] = s.unmapError(err)
+		}
+		return infos, &ReaddirError{errs}
+	}
+	return infos, s.unmapError(err)
+}
+
+func (s *subtree) Checksum(path string, h hash.Hash) ([]byte, error) {
+	sum, err := Checksum(s.fs, s.mapPath(path), h)
+	return sum, s.unmapError(err)
+}
+
+func (s *subtree) DiskUsage(path string) (int64, error) {
+	size, err := DiskUsage(s.fs, s.mapPath(path))
+	return size, s.unmapError(err)
+}
+
+func (s *subtree) ReaddirChan(path string) (<-chan os.FileInfo, <-chan error) {
+	entries, errs := ReaddirChan(s.fs, s.mapPath(path))
+	unmapped := make(chan error, 1)
+
+	go func() {
+		defer close(unmapped)
+		for err := range errs {
+			unmapped <- s.unmapError(err)
+		}
+	}()
+
+	return entries, unmapped
+}
+
+func (s *subtree) Glob(pattern string) ([]string, error) {
+	pattern = pathpkg.Join(quoteMeta(s.root), pathpkg.Clean("/"+pattern))
+	matches, err := Glob(s.fs, pattern)
+	for i, match := range matches {
+		matches[i] = s.unmapPath(match)
+	}
+	return matches, err
+}
+
+// Sets times on the underlying `FileSystem`, if it's a `Chtimer`
+func (s *subtree) Chtimes(path string, atime, mtime time.Time) error {
+	ct, ok := s.fs.(Chtimer)
+	if !ok {
+		return &os.PathError{
+			Op:   "chtimes",
+			Path: pathpkg.Clean("/" + path),
+			Err:  ErrNotSupported,
+		}
+	}
+	return s.unmapError(ct.Chtimes(s.mapPath(path), atime, mtime))
+}
+
+func (s *subtree) Touch(path string) error {
+	return s.unmapError(Touch(s.fs, s.mapPath(path)))
+}
+
 func (s *subtree) Mkdir(path string) error {
 	return s.unmapError(s.fs.Mkdir(s.mapPath(path)))
 }
 
+// Fails with `ErrIsDir` for a path ending in a slash, which names a directory
+// rather than a file to create
+func checkFilePath(op, path string) error {
+	if strings.HasSuffix(path, "/") {
+		return &os.PathError{Op: op, Path: pathpkg.Clean("/" + path), Err: ErrIsDir}
+	}
+	return nil
+}
+
+// Paths are rooted before they're joined, so "../" can't climb out of the root
 func (s *subtree) mapPath(path string) string {
-	return filepath.Join(s.root, pathpkg.Clean(path))
+	return filepath.Join(s.root, pathpkg.Clean("/"+path))
 }
 
+// Strips the root from a path, but only when the path is the root or beneath
+// it, so a root of "/foo" leaves "/foobar" alone
 func (s *subtree) unmapPath(path string) string {
-	return strings.TrimPrefix(path, s.root)
+	root := pathpkg.Clean("/" + s.root)
+	clean := pathpkg.Clean("/" + path)
+
+	switch {
+	case root == "/":
+		return path
+	case clean == root:
+		return "/"
+	case strings.HasPrefix(clean, root+"/"):
+		return clean[len(root):]
+	default:
+		return path
+	}
 }
 
 func (s *subtree) unmapError(err error) error {
@@ -3,7 +3,12 @@ package vfs
 import (
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -96,13 +101,165 @@ var _ = Describe("Subtree", func() {
 			Expect(err).To(MatchError(&os.PathError{
 				Op:   "stat",
 				Path: "/braap-braap-braaaaap.txt",
-				Err:  errors.New("No such file"),
+				Err:  ErrNoFile,
 			}))
 		})
 
 	})
 })
 
+var _ = Describe("Nested Subtree", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("a",
+				Dir("b",
+					File("c.txt", []byte("hi, c")),
+				),
+			),
+		)
+	})
+
+	It("should flatten into one Subtree of the underlying FileSystem", func() {
+		outer, err := Subtree(fs, "/a")
+		Expect(err).ToNot(HaveOccurred())
+		nested, err := Subtree(outer, "/b")
+		Expect(err).ToNot(HaveOccurred())
+
+		direct, err := Subtree(fs, "/a/b")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(nested.(*subtree).fs).To(BeIdenticalTo(fs))
+		Expect(nested.(*subtree).root).To(Equal("/a/b"))
+		Expect(nested.URL()).To(Equal(direct.URL()))
+	})
+
+	It("should behave like a Subtree of the joined root", func() {
+		outer, _ := Subtree(fs, "a")
+		nested, err := Subtree(outer, "b")
+		Expect(err).ToNot(HaveOccurred())
+
+		info, err := nested.Stat("/c.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Size()).To(Equal(int64(5)))
+
+		_, err = nested.Stat("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "stat",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+	It("should still check the nested root is a directory", func() {
+		outer, _ := Subtree(fs, "/a")
+		_, err := Subtree(outer, "/b/c.txt")
+		Expect(err).To(HaveOccurred())
+	})
+
+})
+
+var _ = Describe("Subtree URL", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(Dir("a", Dir("b")))
+	})
+
+	It("should join the root onto a mem URL", func() {
+		tree, err := Subtree(fs, "/a/b")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tree.URL().String()).To(Equal("mem:///a/b"))
+	})
+
+	It("should treat roots with and without slashes the same", func() {
+		for _, root := range []string{"a", "/a", "a/", "/a/", "//a//"} {
+			tree, err := Subtree(fs, root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tree.URL().String()).To(Equal("mem:///a"), root)
+		}
+	})
+
+	It("should join the root onto a file URL", func() {
+		dir, err := ioutil.TempDir("", "vfs-url")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		osFS, err := OS(dir + "/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(osFS.URL().String()).To(Equal("file://" + dir))
+	})
+
+})
+
+var _ = Describe("Subtree paths", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("foo", File("a.txt", []byte("a"))),
+			Dir("foobar", File("b.txt", []byte("b"))),
+		)
+	})
+
+	It("should strip the root from paths beneath it", func() {
+		s := &subtree{fs, "/foo"}
+		Expect(s.unmapPath("/foo/a.txt")).To(Equal("/a.txt"))
+		Expect(s.unmapPath("/foo")).To(Equal("/"))
+	})
+
+	It("should strip a root given without a leading slash", func() {
+		s := &subtree{fs, "foo/"}
+		Expect(s.unmapPath("/foo/a.txt")).To(Equal("/a.txt"))
+	})
+
+	It("should leave a sibling sharing the root's prefix alone", func() {
+		s := &subtree{fs, "/foo"}
+		Expect(s.unmapPath("/foobar/b.txt")).To(Equal("/foobar/b.txt"))
+		Expect(s.unmapPath("/foobar")).To(Equal("/foobar"))
+	})
+
+	It("should clamp .. at the root", func() {
+		s := &subtree{fs, "/foo"}
+		Expect(s.mapPath("../foobar/b.txt")).To(Equal("/foo/foobar/b.txt"))
+
+		tree, err := Subtree(fs, "/foo")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ReadString(tree, "../a.txt")).To(Equal("a"))
+
+		_, err = tree.Stat("../foobar/b.txt")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should report errors beneath the root", func() {
+		tree, err := Subtree(fs, "/foo")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = tree.Stat("/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "stat",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+
+})
+
+var _ = Describe("Subtree Chtimes", func() {
+	It("should not be supported over a FileSystem which can't set times", func() {
+		tree, err := Subtree(&failingCopyFS{FileSystem: Mem(Dir("foo"))}, "/foo")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = tree.(Chtimer).Chtimes("/a.txt", time.Now(), time.Now())
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "chtimes",
+			Path: "/a.txt",
+			Err:  ErrNotSupported,
+		}))
+	})
+})
+
 var _ = Describe("MkdirAll", func() {
 
 	It("should create all directories", func() {
@@ -125,4 +282,382 @@ var _ = Describe("MkdirAll", func() {
 		Expect(infos).To(HaveLen(0))
 	})
 
+	It("should leave existing directories alone", func() {
+		fs := Mem(Dir("party", File("hard.txt", []byte("hard"))))
+
+		Expect(MkdirAll(fs, "/party/every/day")).To(Succeed())
+
+		infos, _ := fs.Readdir("/party")
+		Expect(infos).To(HaveLen(2))
+	})
+
+	It("should fail when a file is in the way", func() {
+		fs := Mem(File("party", []byte("hard")))
+
+		err := MkdirAll(fs, "/party/every/day")
+		Expect(err).To(HaveOccurred())
+	})
+
+})
+
+var _ = Describe("RemoveAll", func() {
+
+	It("should remove a directory and everything beneath it", func() {
+		fs := Mem(
+			Dir("party",
+				Dir("every",
+					Dir("day"),
+					File("night.txt", []byte("all night")),
+				),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+
+		Expect(RemoveAll(fs, "/party")).To(Succeed())
+
+		infos, _ := fs.Readdir("/")
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Name()).To(Equal("root.txt"))
+	})
+
+	It("should not fail on a missing path", func() {
+		Expect(RemoveAll(Mem(), "/missing")).To(Succeed())
+	})
+
+	It("should remove through a Subtree", func() {
+		fs := Mem(Dir("integration", Dir("directory", File("child.txt", nil))))
+		st, err := Subtree(fs, "/integration")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(RemoveAll(st, "/directory")).To(Succeed())
+
+		infos, _ := fs.Readdir("/integration")
+		Expect(infos).To(BeEmpty())
+	})
+
+})
+
+var _ = Describe("Empty", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory", File("child.txt", nil)),
+			Dir("empty_directory"),
+		)
+	})
+
+	It("should tell empty directories from ones with entries", func() {
+		Expect(Empty(fs, "/empty_directory")).To(BeTrue())
+		Expect(Empty(fs, "/directory")).To(BeFalse())
+	})
+
+	It("should fail on a missing path", func() {
+		_, err := Empty(fs, "/missing")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("Clear", func() {
+
+	It("should remove everything in a directory but the directory", func() {
+		fs := Mem(Dir("integration",
+			Dir("directory",
+				Dir("sub_directory", File("deep.txt", nil)),
+				File("child.txt", []byte("hi, child")),
+			),
+			File("root.txt", []byte("hi, root")),
+		))
+
+		Expect(Clear(fs, "/integration")).To(Succeed())
+
+		info, err := fs.Stat("/integration")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+		Expect(fs.Readdir("/integration")).To(HaveLen(0))
+	})
+
+	It("should clear through a Subtree", func() {
+		fs := Mem(Dir("integration", Dir("directory", File("child.txt", nil))))
+		st, err := Subtree(fs, "/integration")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(Clear(st, "/directory")).To(Succeed())
+		Expect(Empty(fs, "/integration/directory")).To(BeTrue())
+	})
+
+	It("should fail on a missing path", func() {
+		err := Clear(Mem(), "/missing")
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("ExportToDir", func() {
+	var fs FileSystem
+	var root string
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				File("child.txt", []byte("hi, child")),
+			),
+			Dir("empty_directory"),
+			File("root.txt", []byte("hi, root")),
+		)
+
+		var err error
+		root, err = ioutil.TempDir("", "vfs-export")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should write the tree to disk", func() {
+		Expect(ExportToDir(fs, root)).To(Succeed())
+
+		info, err := os.Stat(filepath.Join(root, "directory", "sub_directory"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+
+		info, err = os.Stat(filepath.Join(root, "empty_directory"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+
+		content, err := ioutil.ReadFile(filepath.Join(root, "directory", "child.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("hi, child"))
+	})
+
+	It("should create a missing root", func() {
+		dest := filepath.Join(root, "new", "root")
+		Expect(ExportToDir(fs, dest)).To(Succeed())
+
+		_, err := os.Stat(filepath.Join(dest, "root.txt"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should overwrite existing files", func() {
+		err := ioutil.WriteFile(filepath.Join(root, "root.txt"), []byte("old, longer content"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ExportToDir(fs, root)).To(Succeed())
+
+		content, err := ioutil.ReadFile(filepath.Join(root, "root.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("hi, root"))
+	})
+
+	It("should fail when a directory is in the way of a file", func() {
+		Expect(os.Mkdir(filepath.Join(root, "root.txt"), 0755)).To(Succeed())
+
+		Expect(ExportToDir(fs, root)).ToNot(Succeed())
+	})
+
+	It("should fail when the root can't be read", func() {
+		Expect(ExportToDir(&failingReaddir{fs, "/"}, root)).ToNot(Succeed())
+	})
+
+	It("should fail when a directory can't be read", func() {
+		failing := &failingReaddir{fs, "/directory"}
+		Expect(ExportToDir(failing, root)).ToNot(Succeed())
+	})
+
+})
+
+var _ = Describe("ReadFile", func() {
+	It("should read a whole file", func() {
+		fs := Mem(File("root.txt", []byte("hi, root")))
+
+		content, err := ReadFile(fs, "/root.txt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("hi, root"))
+	})
+
+	It("should return the error from Open", func() {
+		_, err := ReadFile(Mem(), "/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+})
+
+var _ = Describe("CopyCounted", func() {
+	content := strings.Repeat("hi, counted ", 10000)
+
+	It("should return how many bytes were copied", func() {
+		fs := Mem()
+		n, err := CopyCounted(fs, "/counted.txt", strings.NewReader(content))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(len(content)))
+		Expect(ReadString(fs, "/counted.txt")).To(Equal(content))
+	})
+
+	It("should count a source without a fast path", func() {
+		fs := Mem()
+		n, err := CopyCounted(fs, "/counted.txt", struct{ io.Reader }{strings.NewReader(content)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(len(content)))
+	})
+
+	It("should return the error from Copy with what was read", func() {
+		fs := WithQuota(Mem(), 100)
+		n, err := CopyCounted(fs, "/counted.txt", strings.NewReader(content))
+		Expect(errors.Is(err, ErrQuotaExceeded)).To(BeTrue())
+		Expect(n).To(BeNumerically("<", len(content)))
+	})
+})
+
+var _ = Describe("WriteString and ReadString", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-string")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	roundTrip := func(fs FileSystem) {
+		Expect(WriteString(fs, "/root.txt", "hi, root")).To(Succeed())
+		Expect(ReadString(fs, "/root.txt")).To(Equal("hi, root"))
+
+		Expect(WriteString(fs, "/root.txt", "bye")).To(Succeed())
+		Expect(ReadString(fs, "/root.txt")).To(Equal("bye"))
+
+		Expect(WriteFile(fs, "/bytes.txt", []byte("hi, bytes"))).To(Succeed())
+		Expect(ReadString(fs, "/bytes.txt")).To(Equal("hi, bytes"))
+	}
+
+	It("should round-trip through mem", func() {
+		roundTrip(Mem())
+	})
+
+	It("should round-trip through the OS", func() {
+		fs, err := OS(root)
+		Expect(err).ToNot(HaveOccurred())
+		roundTrip(fs)
+	})
+
+	It("should return the error from Open", func() {
+		_, err := ReadString(Mem(), "/missing.txt")
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing.txt",
+			Err:  ErrNoFile,
+		}))
+	})
+})
+
+var _ = Describe("ReaddirSorted", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		// Names run the opposite way to modification times
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		files := make([]*MemNode, 1100)
+		for i := range files {
+			mtime := start.Add(time.Duration(len(files)-i) * time.Minute)
+			files[i] = FileWithModTime(fmt.Sprintf("%04d", i+1), make([]byte, i%7), mtime)
+		}
+		fs = Mem(Dir("large_directory", files...))
+	})
+
+	It("should sort by modification time", func() {
+		infos, err := ReaddirSorted(fs, "/large_directory", func(a, b os.FileInfo) bool {
+			return a.ModTime().Before(b.ModTime())
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1100))
+		Expect(infos[0].Name()).To(Equal("1100"))
+		Expect(infos[1099].Name()).To(Equal("0001"))
+		for i := 1; i < len(infos); i++ {
+			Expect(infos[i-1].ModTime().Before(infos[i].ModTime())).To(BeTrue())
+		}
+	})
+
+	It("should keep entries of equal sort by name", func() {
+		infos, err := ReaddirSorted(fs, "/large_directory", func(a, b os.FileInfo) bool {
+			return a.Size() < b.Size()
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos[0].Name()).To(Equal("0001"))
+		Expect(infos[1].Name()).To(Equal("0008"))
+		Expect(infos[1099].Size()).To(Equal(int64(6)))
+	})
+
+	It("should return the error from listing", func() {
+		_, err := ReaddirSorted(fs, "/missing", func(a, b os.FileInfo) bool {
+			return false
+		})
+		Expect(errors.Is(err, ErrNoFile)).To(BeTrue())
+	})
+
+	It("should list everything without sorting", func() {
+		infos, err := ReaddirUnsorted(fs, "/large_directory")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1100))
+
+		st, err := Subtree(fs, "/large_directory")
+		Expect(err).ToNot(HaveOccurred())
+		infos, err = ReaddirUnsorted(st, "/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1100))
+	})
+})
+
+var _ = Describe("ReaddirChan", func() {
+	var fs FileSystem
+
+	BeforeEach(func() {
+		fs = Mem(
+			Dir("directory",
+				Dir("sub_directory"),
+				File("child.txt", []byte("hi, child")),
+			),
+			File("root.txt", []byte("hi, root")),
+		)
+	})
+
+	collect := func(entries <-chan os.FileInfo, errs <-chan error) ([]string, error) {
+		var names []string
+		for info := range entries {
+			names = append(names, info.Name())
+		}
+		return names, <-errs
+	}
+
+	It("should stream the entries of a directory", func() {
+		names, err := collect(ReaddirChan(fs, "/directory"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(Equal([]string{"child.txt", "sub_directory"}))
+	})
+
+	It("should send an error for a missing directory", func() {
+		names, err := collect(ReaddirChan(fs, "/missing"))
+		Expect(names).To(BeEmpty())
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should unmap errors through a Subtree", func() {
+		tree, err := Subtree(fs, "/directory")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = collect(ReaddirChan(tree, "/missing"))
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "open",
+			Path: "/missing",
+			Err:  ErrNoFile,
+		}))
+	})
+
 })
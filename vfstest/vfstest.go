@@ -0,0 +1,346 @@
+// Checks that implementations of `vfs.FileSystem` keep its contract, in the
+// spirit of `testing/fstest`. A backend's own tests can call `TestFileSystem`
+// with a fresh instance to be checked the same way the built-in backends are.
+package vfstest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vistarmedia/vfs"
+)
+
+// A part of the contract which some backends can't keep, and which
+// `TestFileSystem` can be told to skip
+type Check string
+
+const (
+	// Mkdir and Move fail when the parent directory is missing. S3 has no real
+	// directories, so it can put a key anywhere.
+	MissingParent Check = "MissingParent"
+
+	// Create fails beneath a path which is a file
+	FileParent Check = "FileParent"
+
+	// Open fails with `vfs.ErrIsDir` on a directory. S3 only opens objects, so
+	// a directory is `vfs.ErrNoFile` there.
+	OpenDir Check = "OpenDir"
+
+	// A file from Create can't be seen until it's closed. Files on disk appear
+	// as soon as they're opened.
+	CreateOnClose Check = "CreateOnClose"
+)
+
+type config struct {
+	skip map[Check]bool
+}
+
+// Skips checks the `FileSystem` isn't expected to pass
+func Skip(checks ...Check) func(*config) {
+	return func(c *config) {
+		for _, check := range checks {
+			c.skip[check] = true
+		}
+	}
+}
+
+// The directory the fixtures are written to, and removed along with afterwards
+const root = "/vfstest"
+
+// Runs fs through the `vfs.FileSystem` contract, reporting each part as a
+// subtest of t. It writes its own fixtures beneath /vfstest, which mustn't
+// already exist, and removes them when it's done.
+func TestFileSystem(t *testing.T, fs vfs.FileSystem, opts ...func(*config)) {
+	c := &config{skip: map[Check]bool{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if _, err := fs.Stat(root); err == nil {
+		t.Fatalf("%s already exists", root)
+	}
+	if err := vfs.MkdirAll(fs, root); err != nil {
+		t.Fatalf("mkdir %s: %v", root, err)
+	}
+	defer vfs.RemoveAll(fs, root)
+
+	tree, err := vfs.Subtree(fs, root)
+	if err != nil {
+		t.Fatalf("subtree %s: %v", root, err)
+	}
+	setup(t, tree)
+
+	t.Run("Open", func(t *testing.T) { testOpen(t, tree, c) })
+	t.Run("Create", func(t *testing.T) { testCreate(t, tree, c) })
+	t.Run("Copy", func(t *testing.T) { testCopy(t, tree) })
+	t.Run("Stat", func(t *testing.T) { testStat(t, tree) })
+	t.Run("Readdir", func(t *testing.T) { testReaddir(t, tree) })
+	t.Run("Mkdir", func(t *testing.T) { testMkdir(t, tree, c) })
+	t.Run("Move", func(t *testing.T) { testMove(t, tree, c) })
+	t.Run("Remove", func(t *testing.T) { testRemove(t, tree) })
+}
+
+// Lays out:
+//
+//  - /
+//    + directory/
+//    | + child.txt content:(hi, child)
+//    + empty_directory/
+//    + root.txt content:(hi, root)
+func setup(t *testing.T, fs vfs.FileSystem) {
+	t.Helper()
+	if err := vfs.WriteString(fs, "/root.txt", "hi, root"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := vfs.MkdirAll(fs, "/directory"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := vfs.WriteString(fs, "/directory/child.txt", "hi, child"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := fs.Mkdir("/empty_directory"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+}
+
+func testOpen(t *testing.T, fs vfs.FileSystem, c *config) {
+	expectContent(t, fs, "/root.txt", "hi, root")
+	expectContent(t, fs, "directory/child.txt", "hi, child")
+
+	_, err := fs.Open("/missing.txt")
+	expectError(t, "open missing file", err, vfs.ErrNoFile)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("open missing file: %v doesn't match os.ErrNotExist", err)
+	}
+
+	if !c.skip[OpenDir] {
+		_, err = fs.Open("/directory")
+		expectError(t, "open directory", err, vfs.ErrIsDir)
+	}
+}
+
+func testCreate(t *testing.T, fs vfs.FileSystem, c *config) {
+	w, err := fs.Create("/created.txt")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := w.Write([]byte("Party city")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !c.skip[CreateOnClose] {
+		if _, err := fs.Stat("/created.txt"); err == nil {
+			t.Errorf("create: file can be seen before Close")
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	expectContent(t, fs, "/created.txt", "Party city")
+
+	if err := vfs.WriteString(fs, "/created.txt", "Big"); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	expectContent(t, fs, "/created.txt", "Big")
+
+	if err := vfs.WriteString(fs, "/new/deep/file.txt", "deep"); err != nil {
+		t.Fatalf("create with missing parents: %v", err)
+	}
+	expectContent(t, fs, "/new/deep/file.txt", "deep")
+	expectDir(t, fs, "/new/deep")
+
+	_, err = fs.Create("/directory")
+	expectError(t, "create over directory", err, vfs.ErrIsDir)
+
+	if !c.skip[FileParent] {
+		if _, err := fs.Create("/root.txt/child.txt"); err == nil {
+			t.Errorf("create beneath a file: expected an error")
+		}
+	}
+}
+
+func testCopy(t *testing.T, fs vfs.FileSystem) {
+	if err := fs.Copy("/copied.txt", strings.NewReader("Jamesway")); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	expectContent(t, fs, "/copied.txt", "Jamesway")
+
+	if err := fs.Copy("/copied.txt", strings.NewReader("Ames")); err != nil {
+		t.Fatalf("copy over a file: %v", err)
+	}
+	expectContent(t, fs, "/copied.txt", "Ames")
+}
+
+func testStat(t *testing.T, fs vfs.FileSystem) {
+	info, err := fs.Stat("/root.txt")
+	switch {
+	case err != nil:
+		t.Errorf("stat file: %v", err)
+	case info.Name() != "root.txt":
+		t.Errorf("stat file: name %q, want %q", info.Name(), "root.txt")
+	case info.Size() != int64(len("hi, root")):
+		t.Errorf("stat file: size %d, want %d", info.Size(), len("hi, root"))
+	case info.IsDir():
+		t.Errorf("stat file: is a directory")
+	}
+
+	expectDir(t, fs, "/directory")
+	expectDir(t, fs, "directory/")
+
+	_, err = fs.Stat("/missing.txt")
+	expectError(t, "stat missing file", err, vfs.ErrNoFile)
+}
+
+func testReaddir(t *testing.T, fs vfs.FileSystem) {
+	infos, err := fs.Readdir("/directory")
+	if err != nil {
+		t.Fatalf("readdir: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "child.txt" {
+		t.Errorf("readdir: got %v, want [child.txt]", names(infos))
+	}
+
+	infos, err = fs.Readdir("/")
+	if err != nil {
+		t.Fatalf("readdir root: %v", err)
+	}
+	for i := 1; i < len(infos); i++ {
+		if infos[i-1].Name() >= infos[i].Name() {
+			t.Errorf("readdir root: %v isn't sorted", names(infos))
+			break
+		}
+	}
+
+	infos, err = fs.Readdir("/empty_directory")
+	if err != nil {
+		t.Errorf("readdir empty directory: %v", err)
+	} else if len(infos) != 0 {
+		t.Errorf("readdir empty directory: got %v", names(infos))
+	}
+
+	// Not every backend wraps the `os` package's own error for this
+	_, err = fs.Readdir("/missing")
+	expectError(t, "readdir missing directory", err, os.ErrNotExist)
+}
+
+func testMkdir(t *testing.T, fs vfs.FileSystem, c *config) {
+	if err := fs.Mkdir("/made"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	expectDir(t, fs, "/made")
+
+	expectError(t, "mkdir existing directory", fs.Mkdir("/made"), vfs.ErrExist)
+	expectError(t, "mkdir over a file", fs.Mkdir("/root.txt"), vfs.ErrExist)
+
+	if !c.skip[MissingParent] {
+		err := fs.Mkdir("/missing/made")
+		expectError(t, "mkdir with missing parent", err, nil)
+	}
+}
+
+func testMove(t *testing.T, fs vfs.FileSystem, c *config) {
+	if err := vfs.WriteString(fs, "/moving.txt", "moving"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := fs.Move("/moving.txt", "/directory/moved.txt"); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	expectContent(t, fs, "/directory/moved.txt", "moving")
+	_, err := fs.Stat("/moving.txt")
+	expectError(t, "stat moved file", err, vfs.ErrNoFile)
+
+	err = fs.Move("/missing.txt", "/moved.txt")
+	expectError(t, "move missing file", err, vfs.ErrNoFile)
+
+	if !c.skip[MissingParent] {
+		if err := fs.Move("/directory/moved.txt", "/missing/moved.txt"); err == nil {
+			t.Errorf("move to missing parent: expected an error")
+		}
+	}
+}
+
+func testRemove(t *testing.T, fs vfs.FileSystem) {
+	if err := vfs.WriteString(fs, "/removing.txt", "removing"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := fs.Remove("/removing.txt"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	_, err := fs.Stat("/removing.txt")
+	expectError(t, "stat removed file", err, vfs.ErrNoFile)
+
+	if err := fs.Mkdir("/removing"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := fs.Remove("/removing"); err != nil {
+		t.Errorf("remove empty directory: %v", err)
+	}
+
+	expectError(t, "remove missing file", fs.Remove("/missing.txt"), vfs.ErrNoFile)
+
+	// A directory outlives its last file, even where it was only implied by it
+	if err := vfs.WriteString(fs, "/emptied/only.txt", "only"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := fs.Remove("/emptied/only.txt"); err != nil {
+		t.Fatalf("remove last file: %v", err)
+	}
+	expectDir(t, fs, "/emptied")
+	infos, err := fs.Readdir("/emptied")
+	if err != nil {
+		t.Errorf("readdir emptied directory: %v", err)
+	} else if len(infos) != 0 {
+		t.Errorf("readdir emptied directory: got %v", names(infos))
+	}
+}
+
+func expectContent(t *testing.T, fs vfs.FileSystem, path, content string) {
+	t.Helper()
+	r, err := fs.Open(path)
+	if err != nil {
+		t.Errorf("open %s: %v", path, err)
+		return
+	}
+	defer r.Close()
+
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("read %s: %v", path, err)
+	} else if string(bs) != content {
+		t.Errorf("read %s: got %q, want %q", path, bs, content)
+	}
+}
+
+func expectDir(t *testing.T, fs vfs.FileSystem, path string) {
+	t.Helper()
+	info, err := fs.Stat(path)
+	if err != nil {
+		t.Errorf("stat %s: %v", path, err)
+	} else if !info.IsDir() {
+		t.Errorf("stat %s: not a directory", path)
+	}
+}
+
+// Errors must be an `*os.PathError`, wrapping the sentinel if there is one
+func expectError(t *testing.T, what string, err, sentinel error) {
+	t.Helper()
+	var pe *os.PathError
+	switch {
+	case err == nil:
+		t.Errorf("%s: expected an error", what)
+	case !errors.As(err, &pe):
+		t.Errorf("%s: expected *os.PathError, got %T: %v", what, err, err)
+	case sentinel != nil && !errors.Is(err, sentinel):
+		t.Errorf("%s: got %v, want %v", what, err, sentinel)
+	}
+}
+
+func names(infos []os.FileInfo) []string {
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names
+}
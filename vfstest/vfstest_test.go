@@ -0,0 +1,27 @@
+package vfstest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/vistarmedia/vfs"
+)
+
+func TestMem(t *testing.T) {
+	TestFileSystem(t, vfs.Mem())
+}
+
+func TestOS(t *testing.T) {
+	root, err := ioutil.TempDir("", "vfstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	fs, err := vfs.OS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	TestFileSystem(t, fs, Skip(CreateOnClose))
+}
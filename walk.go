@@ -1,25 +1,376 @@
 package vfs
 
 import (
+	"errors"
+	iofs "io/fs"
 	"os"
+	pathpkg "path"
+	"sort"
+	"sync"
 )
 
-type WalkFunc func(fs FileSystem, info os.FileInfo, err error) error
+// Returned, wrapped in an `*os.PathError`, by `Walk` when a directory is inside
+// itself, so walking into it would never end
+var ErrCycle = errors.New("Directory cycle")
 
+// Called for each file and directory visited by `Walk`. The path is relative
+// to the root of the `FileSystem` the walk was started on, so it can be handed
+// straight back to that `FileSystem`.
+type WalkFunc func(path string, info os.FileInfo, err error) error
+
+// Walks the tree of a `FileSystem`, calling walkFn for every file and
+// directory. A directory the walk is already inside, reached again through a
+// mem tree sharing nodes or a directory on disk with the same inode, stops the
+// walk with `ErrCycle` instead of being walked into.
+//
+// As with `WalkDir`, returning `fs.SkipDir` from walkFn for a directory skips
+// its contents, and for a file skips the remaining entries in its directory.
+// Any other error stops the walk and is returned. A directory which can't be
+// read is passed to walkFn a second time with the error, which stops the walk
+// unless walkFn returns nil or `fs.SkipDir`. The root failing to read is
+// returned as it is.
 func Walk(fs FileSystem, walkFn WalkFunc) error {
+	return walk(fs, "", 0, -1, walkFn)
+}
+
+// Walks the tree like `Walk`, but won't descend past maxDepth. A maxDepth of 0
+// only visits the immediate children of the root. Directories at the maximum
+// depth are still passed to walkFn, their contents just aren't read.
+func WalkDepth(fs FileSystem, maxDepth int, walkFn WalkFunc) error {
+	return walk(fs, "", 0, maxDepth, walkFn)
+}
+
+// Walks the tree like `Walk`, but only calls walkFn for files, and for the
+// directories which can't be read. Directories are still descended into.
+func WalkFiles(fs FileSystem, walkFn WalkFunc) error {
+	return Walk(fs, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && err == nil {
+			return nil
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// Walks the tree like `Walk`, but only calls walkFn for directories
+func WalkDirs(fs FileSystem, walkFn WalkFunc) error {
+	return Walk(fs, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			return nil
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// Walks the tree beneath root and returns the paths pred matches, sorted. Paths
+// are joined to root, both when handed to pred and when returned. A directory
+// which can't be read fails the search.
+func Find(
+	fs FileSystem,
+	root string,
+	pred func(path string, info os.FileInfo) bool,
+) ([]string, error) {
+	tree, err := Subtree(fs, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	err = Walk(tree, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		path = pathpkg.Join(root, path)
+		if pred(path, info) {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(found)
+	return found, nil
+}
+
+func walk(fs FileSystem, dir string, depth, maxDepth int, walkFn WalkFunc) error {
+	infos, err := fs.Readdir(".")
+	if err != nil {
+		return err
+	}
+	return walkTree(fs, dir, infos, depth, maxDepth, walkFn, rootAncestry(fs))
+}
+
+// Walks the entries of a directory, given the directories it's inside
+func walkTree(
+	fs FileSystem,
+	dir string,
+	infos []os.FileInfo,
+	depth, maxDepth int,
+	walkFn WalkFunc,
+	ancestors *ancestry,
+) error {
+	for _, info := range infos {
+		path := pathpkg.Join(dir, info.Name())
+		if err := walkFn(path, info, nil); err != nil {
+			if err != iofs.SkipDir {
+				return err
+			}
+			if info.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if !info.IsDir() || (maxDepth >= 0 && depth >= maxDepth) {
+			continue
+		}
+
+		inside, err := ancestors.enter(path, info)
+		if err != nil {
+			return err
+		}
+		tree, err := Subtree(fs, info.Name())
+		var children []os.FileInfo
+		if err == nil {
+			children, err = tree.Readdir(".")
+		}
+		if err != nil {
+			// Give walkFn a second look at the directory it couldn't read
+			if err = walkFn(path, info, err); err != nil && err != iofs.SkipDir {
+				return err
+			}
+			continue
+		}
+		err = walkTree(tree, path, children, depth+1, maxDepth, walkFn, inside)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// What identifies a directory however it's reached, when the backend says: the
+// node itself in a mem tree, or the device and inode of a directory on disk
+func dirIdentity(info os.FileInfo) (interface{}, bool) {
+	if node, ok := info.(*MemNode); ok {
+		return node, true
+	}
+	return fileIdentity(info)
+}
+
+// The identities of the directories a walk is inside, innermost first. Each
+// directory links to its parent's, so walkers on several goroutines can share
+// what's above them.
+type ancestry struct {
+	id     interface{}
+	parent *ancestry
+}
+
+// The ancestry of a walk starting at the root of fs, which is nil when the
+// root has no identity
+func rootAncestry(fs FileSystem) *ancestry {
+	info, err := fs.Stat("/")
+	if err != nil {
+		return nil
+	}
+	if id, ok := dirIdentity(info); ok {
+		return &ancestry{id: id}
+	}
+	return nil
+}
+
+// The ancestry inside the directory at path, or `ErrCycle` if the walk is
+// already inside it. A directory without an identity can't be checked, so it's
+// always entered.
+func (a *ancestry) enter(path string, info os.FileInfo) (*ancestry, error) {
+	id, ok := dirIdentity(info)
+	if !ok {
+		return a, nil
+	}
+	for above := a; above != nil; above = above.parent {
+		if above.id == id {
+			return nil, &os.PathError{Op: "walk", Path: "/" + path, Err: ErrCycle}
+		}
+	}
+	return &ancestry{id: id, parent: a}, nil
+}
+
+// Walks the tree of a `FileSystem` like `Walk`, but hands walkFn an
+// `fs.DirEntry` instead of creating a `Subtree` (and its `Stat`) for every
+// directory. The entries are built from the `os.FileInfo`s `Readdir` already
+// returned, so calling `Info()` on them costs nothing extra.
+//
+// Returning `fs.SkipDir` from walkFn for a directory skips its contents, and
+// for a file skips the remaining entries in its directory. Any other error
+// stops the walk and is returned, as does `ErrCycle` like in `Walk`.
+func WalkDir(fs FileSystem, walkFn iofs.WalkDirFunc) error {
 	infos, err := fs.Readdir(".")
 	if err != nil {
 		return err
 	}
+	return walkDir(fs, ".", infos, walkFn, rootAncestry(fs))
+}
+
+func walkDir(
+	fs FileSystem,
+	dir string,
+	infos []os.FileInfo,
+	walkFn iofs.WalkDirFunc,
+	ancestors *ancestry,
+) error {
 	for _, info := range infos {
-		walkFn(fs, info, err)
-		if info.IsDir() {
-			if tree, err := Subtree(fs, info.Name()); err == nil {
-				Walk(tree, walkFn)
-			} else {
+		path := pathpkg.Join(dir, info.Name())
+		entry := dirEntry{info}
+
+		if err := walkFn(path, entry, nil); err != nil {
+			if err != iofs.SkipDir {
+				return err
+			}
+			if info.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			continue
+		}
+
+		inside, err := ancestors.enter(path, info)
+		if err != nil {
+			return err
+		}
+		children, err := fs.Readdir(path)
+		if err != nil {
+			// Give walkFn a second look at the directory it couldn't read
+			if err = walkFn(path, entry, err); err != nil && err != iofs.SkipDir {
 				return err
 			}
+			continue
+		}
+		if err := walkDir(fs, path, children, walkFn, inside); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// Adapts an `os.FileInfo` returned from `Readdir` to an `fs.DirEntry`
+type dirEntry struct {
+	info os.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.Name() }
+func (d dirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d dirEntry) Info() (os.FileInfo, error) { return d.info, nil }
+
+func (d dirEntry) Type() os.FileMode {
+	// Not every backend sets `os.ModeDir` on its directories
+	if d.info.IsDir() {
+		return os.ModeDir
+	}
+	return d.info.Mode().Type()
+}
+
+// Walks the tree like `Walk`, but reads directories on up to `workers`
+// goroutines at once. This helps on backends like S3 where every `Readdir` is a
+// round-trip.
+//
+// walkFn may be called from several goroutines at the same time, so it must be
+// safe for concurrent use. Entries are visited in no particular order. The
+// first error returned by walkFn or a `Readdir`, or an `ErrCycle` like in
+// `Walk`, stops the walk and is returned.
+func WalkConcurrent(fs FileSystem, workers int, walkFn WalkFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		pending sync.WaitGroup
+		running sync.WaitGroup
+		once    sync.Once
+		walkErr error
+		dirs    = make(chan queuedDir)
+		done    = make(chan struct{})
+	)
+
+	fail := func(err error) {
+		once.Do(func() {
+			walkErr = err
+			close(done)
+		})
+	}
+
+	// Queueing happens off the worker's goroutine so a worker can never block on
+	// handing a directory to itself
+	enqueue := func(dir queuedDir) {
+		pending.Add(1)
+		go func() {
+			select {
+			case dirs <- dir:
+			case <-done:
+				pending.Done()
+			}
+		}()
+	}
+
+	running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer running.Done()
+			for dir := range dirs {
+				walkConcurrentDir(fs, dir, walkFn, done, fail, enqueue)
+				pending.Done()
+			}
+		}()
+	}
+
+	enqueue(queuedDir{".", rootAncestry(fs)})
+	pending.Wait()
+	close(dirs)
+	running.Wait()
+
+	return walkErr
+}
+
+// A directory waiting to be read by `WalkConcurrent`
+type queuedDir struct {
+	path      string
+	ancestors *ancestry
+}
+
+func walkConcurrentDir(
+	fs FileSystem,
+	dir queuedDir,
+	walkFn WalkFunc,
+	done <-chan struct{},
+	fail func(error),
+	enqueue func(queuedDir),
+) {
+	select {
+	case <-done:
+		return
+	default:
+	}
+
+	infos, err := fs.Readdir(dir.path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, info := range infos {
+		path := pathpkg.Join(dir.path, info.Name())
+		if err := walkFn(path, info, nil); err != nil {
+			fail(err)
+			return
+		}
+		if !info.IsDir() {
+			continue
+		}
+		inside, err := dir.ancestors.enter(path, info)
+		if err != nil {
+			fail(err)
+			return
+		}
+		enqueue(queuedDir{path, inside})
+	}
+}
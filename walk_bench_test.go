@@ -0,0 +1,46 @@
+package vfs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"testing"
+)
+
+func largeDirFS() FileSystem {
+	files := make([]*MemNode, 1100)
+	for i := range files {
+		files[i] = File(fmt.Sprintf("%04d", i+1), []byte{})
+	}
+	return Mem(Dir("large_directory", files...))
+}
+
+func BenchmarkWalk(b *testing.B) {
+	fs := largeDirFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Walk(fs, func(path string, info os.FileInfo, err error) error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkWalkDir(b *testing.B) {
+	fs := largeDirFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkWalkConcurrent(b *testing.B) {
+	fs := largeDirFS()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		WalkConcurrent(fs, 8, func(path string, info os.FileInfo, err error) error {
+			return nil
+		})
+	}
+}
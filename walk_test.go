@@ -1,12 +1,25 @@
 package vfs
 
 import (
+	"errors"
+	iofs "io/fs"
 	"os"
+	pathpkg "path"
+	"sync"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+// A mem tree whose only directory holds the root again. The root is named so
+// it's listed under that name in the directory.
+func cyclicMem() *MemNode {
+	root := Mem(Dir("parent")).(*MemNode)
+	root.name = "root"
+	root.children["parent"].children["root"] = root
+	return root
+}
+
 var _ = Describe("Walk", func() {
 
 	var fs FileSystem
@@ -48,7 +61,7 @@ var _ = Describe("Walk", func() {
 
 	It("should call walkFn for each directory & file", func() {
 		count := 0
-		err := Walk(fs, func(fs FileSystem, info os.FileInfo, err error) error {
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
 			count = count + 1
 			return err
 		})
@@ -57,14 +70,426 @@ var _ = Describe("Walk", func() {
 		Expect(count).To(Equal(20))
 	})
 
-	It("should be able to Stat each file by name and subtree", func() {
-		err := Walk(fs, func(tree FileSystem, info os.FileInfo, err error) error {
-			_, err = tree.Stat(info.Name())
+	It("should agree with the statistics of the tree", func() {
+		var files, dirs int
+		var size int64
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			if info.IsDir() {
+				dirs++
+			} else {
+				files++
+				size += info.Size()
+			}
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		root := fs.(*MemNode)
+		Expect(root.FileCount()).To(Equal(6))
+		Expect(root.DirCount()).To(Equal(14))
+		Expect(root.TotalSize()).To(Equal(int64(38)))
+		Expect(root.FileCount()).To(Equal(files))
+		Expect(root.DirCount()).To(Equal(dirs))
+		Expect(root.TotalSize()).To(Equal(size))
+	})
+
+	It("should be able to Stat each file by path", func() {
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			stat, err := fs.Stat(path)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(stat.Name()).To(Equal(info.Name()))
+			return nil
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should pass the path from the root of the walk", func() {
+		var paths []string
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return nil
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(ContainElement("tree-3/1/2/3/4/5.txt"))
+		Expect(paths).To(ContainElement("integration/directory/sub_directory"))
+	})
+
+	It("should only call walkFn for files with WalkFiles", func() {
+		var paths []string
+		err := WalkFiles(fs, func(path string, info os.FileInfo, err error) error {
+			Expect(info.IsDir()).To(BeFalse())
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(HaveLen(6))
+		Expect(paths).To(ContainElement("tree-3/1/2/3/4/5.txt"))
+	})
+
+	It("should only call walkFn for directories with WalkDirs", func() {
+		var paths []string
+		err := WalkDirs(fs, func(path string, info os.FileInfo, err error) error {
+			Expect(info.IsDir()).To(BeTrue())
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(HaveLen(14))
+		Expect(paths).To(ContainElement("tree-3/1/2/3/4"))
+	})
+
+	It("should only visit the children of the root at depth 0", func() {
+		var paths []string
+		err := WalkDepth(fs, 0, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"integration", "tree-3", "tree-two"}))
+	})
+
+	It("should report but not descend directories at the max depth", func() {
+		var paths []string
+		err := WalkDepth(fs, 2, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(ContainElement("tree-3/1"))
+		Expect(paths).To(ContainElement("tree-3/1/2"))
+		Expect(paths).NotTo(ContainElement("tree-3/1/2/3"))
+		Expect(paths).NotTo(ContainElement("tree-3/1/2/6"))
+		Expect(paths).To(ContainElement("integration/directory/sub_directory"))
+	})
+
+	It("should return ErrCycle for a directory inside itself", func() {
+		child := Dir("child", File("child.txt", []byte("hi, child")))
+		parent := Dir("parent", child)
+		child.children["parent"] = parent
+
+		var paths []string
+		err := Walk(Mem(parent), func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "walk",
+			Path: "/parent/child/parent",
+			Err:  ErrCycle,
+		}))
+		Expect(paths).To(Equal([]string{
+			"parent",
+			"parent/child",
+			"parent/child/child.txt",
+			"parent/child/parent",
+		}))
+	})
+
+	It("should return ErrCycle as soon as a directory leads back to the root", func() {
+		var paths []string
+		err := Walk(cyclicMem(), func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+
+		Expect(err).To(MatchError(&os.PathError{
+			Op:   "walk",
+			Path: "/parent/root",
+			Err:  ErrCycle,
+		}))
+		Expect(paths).To(Equal([]string{"parent", "parent/root"}))
+	})
+
+	It("should stop and return the error from walkFn", func() {
+		boom := errors.New("boom")
+		var paths []string
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			if path == "integration/directory" {
+				return boom
+			}
+			return nil
+		})
+
+		Expect(err).To(Equal(boom))
+		Expect(paths).To(Equal([]string{"integration", "integration/directory"}))
+	})
+
+	It("should not descend into a directory when told to skip it", func() {
+		var paths []string
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			if path == "tree-3" {
+				return iofs.SkipDir
+			}
+			return nil
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(ContainElement("tree-3"))
+		Expect(paths).NotTo(ContainElement("tree-3/1"))
+		Expect(paths).To(HaveLen(13))
+	})
+
+	It("should skip the rest of a directory when skipping from a file", func() {
+		var paths []string
+		err := Walk(fs, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			if path == "integration/directory/child.txt" {
+				return iofs.SkipDir
+			}
+			return nil
+		})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(ContainElement("integration/empty_directory"))
+		Expect(paths).NotTo(ContainElement("integration/directory/sub_directory"))
+	})
+
+	It("should hand walkFn a directory it couldn't read", func() {
+		failing := &failingReaddir{fs, "/tree-3/1"}
+		var failed []string
+		err := Walk(failing, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				failed = append(failed, path)
+			}
+			return err
+		})
+
+		Expect(err).To(HaveOccurred())
+		Expect(failed).To(Equal([]string{"tree-3/1"}))
+
+		err = Walk(failing, func(path string, info os.FileInfo, err error) error {
 			return nil
 		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should walk a directory shared by two others twice", func() {
+		shared := Dir("shared", File("file.txt", []byte("hi")))
+		tree := Mem(Dir("a", shared), Dir("b", shared))
+
+		var paths []string
+		err := Walk(tree, func(path string, info os.FileInfo, err error) error {
+			paths = append(paths, path)
+			return err
+		})
 
 		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(ContainElement("a/shared/file.txt"))
+		Expect(paths).To(ContainElement("b/shared/file.txt"))
+	})
+
+	Describe("WalkConcurrent", func() {
+
+		It("should call walkFn for each directory & file", func() {
+			var lock sync.Mutex
+			var paths []string
+			err := WalkConcurrent(fs, 4, func(path string, info os.FileInfo, err error) error {
+				lock.Lock()
+				defer lock.Unlock()
+				paths = append(paths, path)
+				return err
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(HaveLen(20))
+			Expect(paths).To(ContainElement("tree-3/1/2/3/4/5.txt"))
+		})
+
+		It("should return the first error from walkFn", func() {
+			boom := errors.New("boom")
+			err := WalkConcurrent(fs, 4, func(path string, info os.FileInfo, err error) error {
+				if path == "tree-3/1/2" {
+					return boom
+				}
+				return nil
+			})
+
+			Expect(err).To(Equal(boom))
+		})
+
+		It("should return the error from a failed Readdir", func() {
+			err := WalkConcurrent(Mem(File("file", nil)), 2,
+				func(path string, info os.FileInfo, err error) error {
+					return nil
+				})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = WalkConcurrent(&failingReaddir{fs, "/tree-3/1"}, 2,
+				func(path string, info os.FileInfo, err error) error {
+					return nil
+				})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return ErrCycle for a directory inside itself", func() {
+			err := WalkConcurrent(cyclicMem(), 2,
+				func(path string, info os.FileInfo, err error) error {
+					return nil
+				})
+			Expect(errors.Is(err, ErrCycle)).To(BeTrue())
+		})
+
+	})
+
+	Describe("WalkDir", func() {
+
+		It("should call walkFn for each directory & file", func() {
+			count := 0
+			err := WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+				count = count + 1
+				return err
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(20))
+		})
+
+		It("should be able to Stat each entry by path", func() {
+			err := WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+				info, err := d.Info()
+				Expect(err).NotTo(HaveOccurred())
+
+				stat, err := fs.Stat(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stat.Name()).To(Equal(info.Name()))
+				Expect(stat.IsDir()).To(Equal(d.IsDir()))
+				return nil
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not descend into a directory when told to skip it", func() {
+			var paths []string
+			err := WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+				paths = append(paths, path)
+				if path == "tree-3" {
+					return iofs.SkipDir
+				}
+				return nil
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(ContainElement("tree-3"))
+			Expect(paths).NotTo(ContainElement("tree-3/1"))
+			Expect(paths).To(HaveLen(13))
+		})
+
+		It("should skip the rest of a directory when skipping from a file", func() {
+			var paths []string
+			err := WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+				paths = append(paths, path)
+				if path == "integration/directory/child.txt" {
+					return iofs.SkipDir
+				}
+				return nil
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(ContainElement("integration/empty_directory"))
+			Expect(paths).NotTo(ContainElement("integration/directory/sub_directory"))
+		})
+
+		It("should stop and return the error from walkFn", func() {
+			boom := errors.New("boom")
+			count := 0
+			err := WalkDir(fs, func(path string, d iofs.DirEntry, err error) error {
+				count = count + 1
+				return boom
+			})
+
+			Expect(err).To(Equal(boom))
+			Expect(count).To(Equal(1))
+		})
+
+		It("should return ErrCycle for a directory inside itself", func() {
+			var paths []string
+			err := WalkDir(cyclicMem(), func(path string, d iofs.DirEntry, err error) error {
+				paths = append(paths, path)
+				return err
+			})
+
+			Expect(err).To(MatchError(&os.PathError{
+				Op:   "walk",
+				Path: "/parent/root",
+				Err:  ErrCycle,
+			}))
+			Expect(paths).To(Equal([]string{"parent", "parent/root"}))
+		})
+
 	})
 
+	Describe("Find", func() {
+
+		named := func(name string) func(string, os.FileInfo) bool {
+			return func(path string, info os.FileInfo) bool {
+				return info.Name() == name
+			}
+		}
+
+		It("should find every file with a name", func() {
+			paths, err := Find(fs, "/", named("child.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths).To(Equal([]string{
+				"/integration/directory/child.txt",
+				"/tree-two/directory/child.txt",
+			}))
+		})
+
+		It("should only look beneath root", func() {
+			paths, err := Find(fs, "tree-two", named("child.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths).To(Equal([]string{"tree-two/directory/child.txt"}))
+		})
+
+		It("should hand pred the full path", func() {
+			paths, err := Find(fs, "/", func(path string, info os.FileInfo) bool {
+				return info.IsDir() && pathpkg.Base(pathpkg.Dir(path)) == "directory"
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths).To(Equal([]string{
+				"/integration/directory/sub_directory",
+				"/tree-two/directory/sub_directory",
+			}))
+		})
+
+		It("should find nothing", func() {
+			paths, err := Find(fs, "/", named("missing.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(paths).To(BeEmpty())
+		})
+
+		It("should fail for a missing root", func() {
+			_, err := Find(fs, "/missing", named("child.txt"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail for a directory it can't read", func() {
+			_, err := Find(&failingReaddir{fs, "/tree-3/1"}, "/", named("5.txt"))
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
 })
+
+// Fails to list one directory, as a flaky backend might
+type failingReaddir struct {
+	FileSystem
+	dir string
+}
+
+func (f *failingReaddir) Readdir(path string) ([]os.FileInfo, error) {
+	if pathpkg.Clean("/"+path) == f.dir {
+		return nil, &os.PathError{Op: "open", Path: path, Err: errors.New("nope")}
+	}
+	return f.FileSystem.Readdir(path)
+}
@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package vfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// A file on disk, which hard links and bind mounts can make reachable by more
+// than one path
+type inode struct {
+	dev, ino uint64
+}
+
+func fileIdentity(info os.FileInfo) (interface{}, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, false
+	}
+	return inode{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OS directory identity", func() {
+	var fs FileSystem
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "vfs-walk")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs, err = OS(root)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fs.Mkdir("/a")).To(Succeed())
+		Expect(fs.Mkdir("/b")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should identify a directory by its inode however it's found", func() {
+		stated, err := fs.Stat("/a")
+		Expect(err).ToNot(HaveOccurred())
+		infos, err := fs.Readdir("/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+
+		a, ok := dirIdentity(stated)
+		Expect(ok).To(BeTrue())
+		listed, _ := dirIdentity(infos[0])
+		Expect(listed).To(Equal(a))
+		other, _ := dirIdentity(infos[1])
+		Expect(other).ToNot(Equal(a))
+	})
+})
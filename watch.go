@@ -0,0 +1,158 @@
+package vfs
+
+import (
+	"os"
+	pathpkg "path"
+	"sync"
+)
+
+// What happened to a path reported by a `Watcher`
+type EventOp int
+
+const (
+	// A file or directory was created
+	EventCreate EventOp = iota
+	// An existing file's content was replaced or written to
+	EventWrite
+	// A file or directory was removed
+	EventRemove
+	// A file or directory was moved away from the path. Its new path gets an
+	// EventCreate.
+	EventRename
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case EventCreate:
+		return "Create"
+	case EventWrite:
+		return "Write"
+	case EventRemove:
+		return "Remove"
+	case EventRename:
+		return "Rename"
+	default:
+		return "Unknown"
+	}
+}
+
+type Event struct {
+	Op   EventOp
+	Path string
+}
+
+// Implemented by `FileSystem`s which can report changes as they happen.
+// Watching a directory reports changes to it and its immediate children, not
+// anything deeper.
+type Watcher interface {
+	// Starts watching path, which must exist. Calling cancel stops the watch and
+	// closes the channel of events.
+	Watch(path string) (events <-chan Event, cancel func() error, err error)
+}
+
+// A watch on a memory `FileSystem`, kept on the node it was started from.
+// Mutators notify it while holding that node's watchMu, so cancelling waits out
+// any event being delivered before closing the channel.
+type memWatch struct {
+	path   string
+	events chan Event
+	once   sync.Once
+}
+
+// Unread events a memory watch buffers. Once it's full, further events are
+// dropped rather than holding up the mutators.
+const memWatchBuffer = 64
+
+func (mn *MemNode) Watch(path string) (<-chan Event, func() error, error) {
+	path = pathpkg.Clean("/" + path)
+	if mn.childByPath(path) == nil {
+		return nil, nil, &os.PathError{Op: "watch", Path: path, Err: ErrNoFile}
+	}
+
+	w := &memWatch{
+		path:   path,
+		events: make(chan Event, memWatchBuffer),
+	}
+	mn.watchMu.Lock()
+	mn.watches = append(mn.watches, w)
+	mn.watchMu.Unlock()
+
+	cancel := func() error {
+		err := os.ErrClosed
+		w.once.Do(func() {
+			mn.unwatch(w)
+			close(w.events)
+			err = nil
+		})
+		return err
+	}
+	return w.events, cancel, nil
+}
+
+func (mn *MemNode) unwatch(w *memWatch) {
+	mn.watchMu.Lock()
+	defer mn.watchMu.Unlock()
+
+	for i, watch := range mn.watches {
+		if watch == w {
+			mn.watches = append(mn.watches[:i:i], mn.watches[i+1:]...)
+			break
+		}
+	}
+}
+
+// Sends an event for path to every watch on it or its parent, dropping it for
+// any watch whose buffer is full
+func (mn *MemNode) notify(op EventOp, path string) {
+	mn.watchMu.Lock()
+	defer mn.watchMu.Unlock()
+
+	for _, w := range mn.watches {
+		if w.path != path && w.path != pathpkg.Dir(path) {
+			continue
+		}
+		select {
+		case w.events <- Event{Op: op, Path: path}:
+		default:
+		}
+	}
+}
+
+func (s *subtree) Watch(path string) (<-chan Event, func() error, error) {
+	watcher, ok := s.fs.(Watcher)
+	if !ok {
+		return nil, nil, &os.PathError{
+			Op:   "watch",
+			Path: pathpkg.Clean("/" + path),
+			Err:  ErrNotSupported,
+		}
+	}
+	inner, innerCancel, err := watcher.Watch(s.mapPath(path))
+	if err != nil {
+		return nil, nil, s.unmapError(err)
+	}
+
+	events := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		for event := range inner {
+			event.Path = s.unmapPath(event.Path)
+			select {
+			case events <- event:
+			case <-done:
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() error {
+		err := os.ErrClosed
+		once.Do(func() {
+			close(done)
+			err = innerCancel()
+		})
+		return err
+	}
+	return events, cancel, nil
+}